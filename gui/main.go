@@ -31,6 +31,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/creack/pty"
@@ -40,6 +42,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/gofiber/websocket/v2"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/sys/unix"
@@ -105,6 +108,10 @@ type RegistryModule struct {
 	Submodules    []RegistryModule `json:"submodules,omitempty"`
 	Version       string           `json:"version,omitempty"`
 	Author        string           `json:"author,omitempty"`
+	Concurrency   *ConcurrencyInfo `json:"concurrency,omitempty"`
+	Timeouts      *TimeoutInfo     `json:"timeouts,omitempty"`
+	Environment   *EnvironmentInfo `json:"environment,omitempty"`
+	Resources     *ResourceLimits  `json:"resources,omitempty"`
 }
 
 type ModuleCategory struct {
@@ -167,17 +174,47 @@ type SessionManager struct {
 }
 
 type ModuleSession struct {
-	ID          string
-	Module      string
-	ModuleName  string
-	CreatedAt   time.Time
-	Status      string
-	Process     *exec.Cmd
-	PTY         *os.File
-	Done        chan bool
-	Output      chan string
-	Buffer      []string
-	BufferMutex sync.RWMutex
+	ID         string
+	Module     string
+	ModuleName string
+	CreatedAt  time.Time
+	Status     string
+	Language   string // Language requested for the module
+	User       string // Authenticated user who started the session and owns it
+	Process    *exec.Cmd
+	PTY        *os.File
+	Done       chan struct{}     // Closed once the module process has exited
+	Stream     *OutputStream     // Fan-out of PTY output to WebSocket subscribers
+	Transcript *TranscriptWriter // On-disk recording of the output, nil when disabled
+	readerDone chan struct{}     // Closed when readPTYOutput returns
+	doneOnce   sync.Once
+	Rows       uint16 // Current PTY height
+	Cols       uint16 // Current PTY width
+	Term       string // TERM value exported to the module
+	sizeMutex  sync.Mutex
+
+	ModuleVersion string   // Registry version of the module at start
+	runLock       *RunLock // Concurrency lock, released when the module exits
+
+	StatusReason string        // Why a stopped session ended, e.g. "user" or "idle_timeout"
+	IdleTimeout  time.Duration // Stop after this long without input or output (0 = never)
+	MaxRuntime   time.Duration // Stop after this long in total (0 = never)
+	lastActivity atomic.Int64  // Unix nanoseconds of the last input or output
+
+	events   *guiEventParser               // Extracts lib_ui.sh prompt events from the output
+	recorder atomic.Pointer[macroRecorder] // Records inputs as a macro while set
+	redactor sessionRedactor               // Removes secrets before logging and recording
+
+	rootHelper *rootHelperClient   // Set when the root helper runs the module instead of Process
+	exitStatus *syscall.WaitStatus // Set once the module has exited, if known
+	resources  *sessionResources   // Cgroup or priority of the module
+	stats      sessionStats        // Usage of the process tree, sampled by watchStats
+
+	needsInput atomic.Pointer[NeedsInputEvent] // Set while the module waits for input, see watchInput
+
+	accessMutex sync.Mutex
+	grants      map[string]bool // Users the owner granted access
+	controlUser string          // Holds the input rights if not the owner
 }
 
 type SessionInfo struct {
@@ -186,17 +223,82 @@ type SessionInfo struct {
 	ModuleName string    `json:"module_name"`
 	CreatedAt  time.Time `json:"created_at"`
 	Status     string    `json:"status"`
+	Rows       uint16    `json:"rows,omitempty"`
+	Cols       uint16    `json:"cols,omitempty"`
+	Language   string    `json:"language,omitempty"`
+	User       string    `json:"user,omitempty"`
+
+	StatusReason       string `json:"status_reason,omitempty"`
+	IdleTimeoutSeconds int    `json:"idle_timeout_seconds,omitempty"`
+	MaxRuntimeSeconds  int    `json:"max_runtime_seconds,omitempty"`
+	Privileged         bool   `json:"privileged,omitempty"` // Started as root by the root helper
+
+	Resources *SessionResources `json:"resources,omitempty"`
+	Stats     *SessionStats     `json:"stats,omitempty"` // Usage of the process tree while running
+
+	SharedWith []string `json:"shared_with,omitempty"` // Users the owner granted access
+	Controller string   `json:"controller,omitempty"`  // User who holds the input rights
+	Role       string   `json:"role"`                  // "control" or "observe" for the requesting user
 }
 
 type Message struct {
-	Type    string      `json:"type"`
-	Content interface{} `json:"content"`
+	Type       string      `json:"type"`
+	Content    interface{} `json:"content"`
+	Offset     int64       `json:"offset,omitempty"`      // Stream offset of the first output byte (absent means 0)
+	NextOffset int64       `json:"next_offset,omitempty"` // Stream offset right after the last output byte
+	Snapshot   bool        `json:"snapshot,omitempty"`    // Content starts with a redraw of the screen as of Offset
+}
+
+// SubscribeRequest is the object form of a "subscribe" WebSocket message
+type SubscribeRequest struct {
+	SessionID   string `json:"session_id"`
+	SinceOffset *int64 `json:"since_offset,omitempty"` // Resume after this offset instead of replaying everything
+}
+
+// ClientMessage is a WebSocket message received from the frontend. Content is
+// decoded lazily because its shape depends on the message type.
+type ClientMessage struct {
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ResizeRequest is the content of a "resize" WebSocket message
+type ResizeRequest struct {
+	SessionID string `json:"session_id,omitempty"` // Defaults to the subscribed session
+	Rows      int    `json:"rows"`
+	Cols      int    `json:"cols"`
+}
+
+// RawInputRequest is the object form of an "input" WebSocket message. Data is
+// written to the PTY verbatim; set Encoding to "base64" for arbitrary bytes.
+type RawInputRequest struct {
+	SessionID string `json:"session_id,omitempty"` // Defaults to the subscribed session
+	Data      string `json:"data"`
+	Encoding  string `json:"encoding,omitempty"`
 }
 
 type StartModuleRequest struct {
 	Language string `json:"language"`
+	Rows     int    `json:"rows,omitempty"` // Initial terminal height (defaults to 40)
+	Cols     int    `json:"cols,omitempty"` // Initial terminal width (defaults to 120)
+	Term     string `json:"term,omitempty"` // TERM for the module (defaults to xterm-256color)
+
+	Resources *ResourceLimits `json:"resources,omitempty"` // Overrides the module's resource settings
 }
 
+// maxInputSize limits a single input write to a session (bytes)
+const maxInputSize = 4096
+
+const (
+	defaultTerminalRows = 40
+	defaultTerminalCols = 120
+	defaultTerminalType = "xterm-256color"
+	maxTerminalRows     = 500
+	maxTerminalCols     = 1000
+)
+
+var terminalTypePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_-]{0,63}$`)
+
 type DocMetadata struct {
 	ID             string `json:"id"`
 	Name           string `json:"name"`
@@ -329,9 +431,37 @@ var (
 
 // Config holds GUI configuration
 type Config struct {
-	Port       string
-	Host       string
-	ReleaseTag string
+	Port            string
+	Host            string
+	ReleaseTag      string
+	ScrollbackBytes int
+
+	TranscriptsEnabled      bool
+	TranscriptRetentionDays int
+	TranscriptMaxBytes      int64
+
+	MaxSessions int
+
+	IdleTimeoutMinutes    int
+	MaxRuntimeMinutes     int
+	TimeoutWarningSeconds int
+
+	StatsIntervalSeconds int
+
+	InputWaitSeconds   int
+	InputNotify        bool
+	InputPromptPattern *regexp.Regexp
+
+	RootHelperSocket string
+
+	EnvAllow []string
+	EnvDeny  []string
+
+	CgroupMode string
+
+	LogTerminalIO       bool
+	SecretPromptPattern *regexp.Regexp
+	RedactPattern       *regexp.Regexp
 }
 
 var configDisplayNames = map[string]string{
@@ -964,6 +1094,147 @@ func applyGeneralConfigKey(config *Config, key, value string) {
 		if value != "" {
 			config.ReleaseTag = value
 		}
+	case "CFG_LH_GUI_SCROLLBACK_BYTES":
+		if value == "" {
+			return
+		}
+		size, err := strconv.Atoi(value)
+		if err != nil || size < minScrollbackBytes || size > maxScrollbackBytes {
+			log.Printf("Warning: invalid CFG_LH_GUI_SCROLLBACK_BYTES %q (must be between %d and %d), using %d",
+				value, minScrollbackBytes, maxScrollbackBytes, config.ScrollbackBytes)
+			return
+		}
+		config.ScrollbackBytes = size
+	case "CFG_LH_GUI_TRANSCRIPTS":
+		if value != "" {
+			config.TranscriptsEnabled = strings.EqualFold(value, "true")
+		}
+	case "CFG_LH_GUI_TRANSCRIPT_RETENTION_DAYS":
+		if value == "" {
+			return
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_TRANSCRIPT_RETENTION_DAYS %q, using %d", value, config.TranscriptRetentionDays)
+			return
+		}
+		config.TranscriptRetentionDays = days
+	case "CFG_LH_GUI_TRANSCRIPT_MAX_BYTES":
+		if value == "" {
+			return
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_TRANSCRIPT_MAX_BYTES %q, using %d", value, config.TranscriptMaxBytes)
+			return
+		}
+		config.TranscriptMaxBytes = size
+	case "CFG_LH_MODULES_MAX_SESSIONS":
+		if value == "" {
+			return
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			log.Printf("Warning: invalid CFG_LH_MODULES_MAX_SESSIONS %q, using %d", value, config.MaxSessions)
+			return
+		}
+		config.MaxSessions = limit
+	case "CFG_LH_GUI_IDLE_TIMEOUT_MINUTES":
+		if value == "" {
+			return
+		}
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_IDLE_TIMEOUT_MINUTES %q, using %d", value, config.IdleTimeoutMinutes)
+			return
+		}
+		config.IdleTimeoutMinutes = minutes
+	case "CFG_LH_GUI_MAX_RUNTIME_MINUTES":
+		if value == "" {
+			return
+		}
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_MAX_RUNTIME_MINUTES %q, using %d", value, config.MaxRuntimeMinutes)
+			return
+		}
+		config.MaxRuntimeMinutes = minutes
+	case "CFG_LH_GUI_TIMEOUT_WARNING_SECONDS":
+		if value == "" {
+			return
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_TIMEOUT_WARNING_SECONDS %q, using %d", value, config.TimeoutWarningSeconds)
+			return
+		}
+		config.TimeoutWarningSeconds = seconds
+	case "CFG_LH_GUI_STATS_INTERVAL_SECONDS":
+		if value == "" {
+			return
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_STATS_INTERVAL_SECONDS %q, using %d", value, config.StatsIntervalSeconds)
+			return
+		}
+		config.StatsIntervalSeconds = seconds
+	case "CFG_LH_GUI_INPUT_WAIT_SECONDS":
+		if value == "" {
+			return
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			log.Printf("Warning: invalid CFG_LH_GUI_INPUT_WAIT_SECONDS %q, using %d", value, config.InputWaitSeconds)
+			return
+		}
+		config.InputWaitSeconds = seconds
+	case "CFG_LH_GUI_INPUT_NOTIFY":
+		if value != "" {
+			config.InputNotify = strings.EqualFold(value, "true")
+		}
+	case "CFG_LH_GUI_ROOT_HELPER_SOCKET":
+		config.RootHelperSocket = value
+	case "CFG_LH_GUI_CGROUPS":
+		switch mode := strings.ToLower(value); mode {
+		case "":
+		case cgroupModeAuto, cgroupModeOn, cgroupModeOff:
+			config.CgroupMode = mode
+		default:
+			log.Printf("Warning: invalid CFG_LH_GUI_CGROUPS %q (auto, on or off), using %s", value, config.CgroupMode)
+		}
+	case "CFG_LH_GUI_LOG_TERMINAL_IO":
+		if value != "" {
+			config.LogTerminalIO = strings.EqualFold(value, "true")
+		}
+	case "CFG_LH_GUI_SECRET_PROMPT_PATTERN", "CFG_LH_GUI_REDACT_PATTERN", "CFG_LH_GUI_INPUT_PROMPT_PATTERN":
+		if value == "" {
+			return
+		}
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			log.Printf("Warning: invalid %s: %v", key, err)
+			return
+		}
+		switch key {
+		case "CFG_LH_GUI_SECRET_PROMPT_PATTERN":
+			config.SecretPromptPattern = pattern
+		case "CFG_LH_GUI_REDACT_PATTERN":
+			config.RedactPattern = pattern
+		default:
+			config.InputPromptPattern = pattern
+		}
+	case "CFG_LH_GUI_MODULE_ENV_ALLOW", "CFG_LH_GUI_MODULE_ENV_DENY":
+		patterns, err := parseEnvPatterns(value)
+		if err != nil {
+			log.Printf("Warning: invalid %s: %v", key, err)
+			return
+		}
+		if key == "CFG_LH_GUI_MODULE_ENV_ALLOW" {
+			config.EnvAllow = patterns
+		} else {
+			config.EnvDeny = patterns
+		}
 	case "LLH_GUI_AUTH_MODE",
 		"LLH_GUI_USER",
 		"LLH_GUI_PASS_HASH",
@@ -1017,9 +1288,23 @@ func readGeneralConfigFile(path string, config *Config) {
 // loadConfig reads configuration fragments from config/general.d/*.conf (legacy general.conf)
 func loadConfig() *Config {
 	config := &Config{
-		Port:       "3000",      // default port
-		Host:       "localhost", // default host (secure)
-		ReleaseTag: "",
+		Port:            "3000",      // default port
+		Host:            "localhost", // default host (secure)
+		ReleaseTag:      "",
+		ScrollbackBytes: defaultScrollbackBytes,
+
+		TranscriptsEnabled:      true,
+		TranscriptRetentionDays: defaultTranscriptRetentionDays,
+		TranscriptMaxBytes:      defaultTranscriptMaxBytes,
+
+		TimeoutWarningSeconds: defaultTimeoutWarningSeconds,
+
+		StatsIntervalSeconds: defaultStatsIntervalSeconds,
+
+		InputWaitSeconds: defaultInputWaitSeconds,
+		InputNotify:      true,
+
+		CgroupMode: cgroupModeAuto,
 	}
 
 	fragmentDir := filepath.Join(lhRootDir, "config", "general.d")
@@ -1204,6 +1489,9 @@ func main() {
 	var helpFlag = flag.Bool("help", false, "Show help information")
 	var helpFlagShort = flag.Bool("h", false, "Show help information (shorthand for --help)")
 	var hashPasswordFlag = flag.String("hash-password", "", "Generate bcrypt hash for the provided password and exit")
+	var rootHelperFlag = flag.Bool("root-helper", false, "Run as root helper that starts modules requiring root for the GUI")
+	var rootHelperSocketFlag = flag.String("root-helper-socket", "", "Socket of the root helper (overrides config file)")
+	var guiUserFlag = flag.String("gui-user", "", "User (name or uid) the GUI runs as; only it may use the root helper")
 	flag.Parse()
 
 	if *hashPasswordFlag != "" {
@@ -1224,6 +1512,8 @@ func main() {
 		fmt.Println("  -p, --port      Port to run the server on (overrides config)")
 		fmt.Println("  -h, --help      Show this help information")
 		fmt.Println("      --hash-password <value>  Generate bcrypt hash for <value> and exit")
+		fmt.Println("      --root-helper --gui-user <user>  Run as root helper for modules that require root")
+		fmt.Println("      --root-helper-socket <path>      Socket of the root helper (default: " + defaultRootHelperSocket + ")")
 		fmt.Println("\nConfiguration:")
 		fmt.Println("  Default settings are read from config/general.d/*.conf (legacy config/general.conf)")
 		fmt.Println("  Default port: 3000")
@@ -1235,12 +1525,62 @@ func main() {
 		fmt.Println("  ./little-linux-helper-gui --network          # Network access: 0.0.0.0:3000")
 		fmt.Println("  ./little-linux-helper-gui -n                 # Network access: 0.0.0.0:3000")
 		fmt.Println("  ./little-linux-helper-gui -n -p 80           # Network access: 0.0.0.0:80")
+		fmt.Println("  sudo ./little-linux-helper-gui --root-helper --gui-user alice  # Root helper for alice's GUI")
 		return
 	}
 
 	// Load configuration
 	config := loadConfig()
+	moduleEnvAllow = config.EnvAllow
+	moduleEnvDeny = config.EnvDeny
+	logTerminalIO = config.LogTerminalIO
+	if config.SecretPromptPattern != nil {
+		secretPromptPattern = config.SecretPromptPattern
+	}
+	redactPattern = config.RedactPattern
+	if logTerminalIO {
+		log.Println("WARNING: CFG_LH_GUI_LOG_TERMINAL_IO is enabled; terminal input and output are written to the log (after redaction)")
+	}
+	if *rootHelperSocketFlag != "" {
+		config.RootHelperSocket = *rootHelperSocketFlag
+	}
+
+	initCgroups(config.CgroupMode)
+
+	if *rootHelperFlag {
+		socketPath := config.RootHelperSocket
+		if socketPath == "" {
+			socketPath = defaultRootHelperSocket
+		}
+		if err := runRootHelper(socketPath, *guiUserFlag); err != nil {
+			log.Fatalf("Root helper: %v", err)
+		}
+		return
+	}
+	rootHelperSocket = config.RootHelperSocket
 	configFormSchemas = loadConfigFormSchemas()
+	scrollbackBytes = config.ScrollbackBytes
+	transcriptsEnabled = config.TranscriptsEnabled
+	transcriptRetentionDays = config.TranscriptRetentionDays
+	transcriptMaxBytes = config.TranscriptMaxBytes
+	maxConcurrentSessions = config.MaxSessions
+	idleTimeoutMinutes = config.IdleTimeoutMinutes
+	maxRuntimeMinutes = config.MaxRuntimeMinutes
+	timeoutWarningSeconds = config.TimeoutWarningSeconds
+	statsIntervalSeconds = config.StatsIntervalSeconds
+	inputWaitSeconds = config.InputWaitSeconds
+	inputNotify = config.InputNotify
+	if config.InputPromptPattern != nil {
+		inputPromptPattern = config.InputPromptPattern
+	}
+	go pruneTranscriptsPeriodically()
+
+	if err := sessionHistory.Load(sessionHistoryPath()); err != nil {
+		log.Printf("Warning: could not load session history: %v", err)
+	}
+	if err := scheduleHistory.Load(scheduleHistoryPath()); err != nil {
+		log.Printf("Warning: could not load schedule history: %v", err)
+	}
 
 	// Load module registry
 	log.Println("Loading module registry...")
@@ -1255,6 +1595,10 @@ func main() {
 		log.Println("Module registry loaded successfully")
 	}
 
+	// Start recurring module runs
+	scheduler.Load()
+	go scheduler.Run()
+
 	// Load documentation registry
 	log.Println("Loading documentation registry...")
 	docRegistry, err := loadDocumentationRegistry(lhRootDir)
@@ -1327,7 +1671,7 @@ func main() {
 	})
 
 	// Middleware
-	app.Use(logger.New())
+	app.Use(logger.New(logger.Config{CustomTags: shareTokenLogTags}))
 	app.Use(helmet.New())
 
 	if len(authSettings.AllowedOrigins) > 0 {
@@ -1383,6 +1727,11 @@ func main() {
 			switch c.Path() {
 			case "/health", "/api/health":
 				return c.Next()
+			case "/ws":
+				// Observers with a share token watch without logging in
+				if _, valid := lookupShareToken(c.Query("share")); valid {
+					return c.Next()
+				}
 			}
 			return basicGuard(c)
 		})
@@ -1461,15 +1810,81 @@ func main() {
 	// Start a module session
 	protectedAPI.Post("/modules/:id/start", startModule)
 
+	// Run a module unattended with an answer script
+	protectedAPI.Post("/modules/:id/run", runModule)
+
+	// Macros recorded from live sessions
+	protectedAPI.Get("/macros", getMacros)
+	protectedAPI.Get("/macros/:macroId", getMacro)
+	protectedAPI.Put("/macros/:macroId", updateMacro)
+	protectedAPI.Delete("/macros/:macroId", deleteMacro)
+	protectedAPI.Post("/macros/:macroId/run", runMacro)
+
+	// Recurring module runs
+	protectedAPI.Get("/schedules", getSchedules)
+	protectedAPI.Post("/schedules", createSchedule)
+	protectedAPI.Get("/schedules/:scheduleId", getSchedule)
+	protectedAPI.Put("/schedules/:scheduleId", updateSchedule)
+	protectedAPI.Delete("/schedules/:scheduleId", deleteSchedule)
+	protectedAPI.Post("/schedules/:scheduleId/enable", setScheduleEnabled(true))
+	protectedAPI.Post("/schedules/:scheduleId/disable", setScheduleEnabled(false))
+	protectedAPI.Post("/schedules/:scheduleId/run", triggerSchedule)
+	protectedAPI.Get("/schedules/:scheduleId/runs", getScheduleRuns)
+
 	// Get active sessions
 	protectedAPI.Get("/sessions", getSessions)
 
+	// Finished and running sessions with exit status, paginated and filterable
+	protectedAPI.Get("/sessions/history", getSessionHistory)
+
+	// Run locks held by GUI and CLI sessions
+	protectedAPI.Get("/sessions/locks", getRunLocks)
+
 	// Send input to module
 	protectedAPI.Post("/sessions/:sessionId/input", sendInput)
 
 	// Stop module session
 	protectedAPI.Delete("/sessions/:sessionId", stopSession)
 
+	// Share a session with other users
+	protectedAPI.Get("/sessions/:sessionId/access", getSessionAccess)
+	protectedAPI.Post("/sessions/:sessionId/access", grantSessionAccess)
+	protectedAPI.Delete("/sessions/:sessionId/access/:user", revokeSessionAccess)
+	protectedAPI.Post("/sessions/:sessionId/control", handOverSessionControl)
+
+	// Time-limited tokens for read-only observers
+	protectedAPI.Post("/sessions/:sessionId/share", shareSession)
+	protectedAPI.Delete("/sessions/:sessionId/share", revokeSessionShares)
+
+	// Live process tree of a session
+	protectedAPI.Get("/sessions/:sessionId/processes", getSessionProcesses)
+
+	// Deliver SIGINT, SIGTSTP, SIGCONT, SIGHUP or SIGQUIT to the foreground job
+	protectedAPI.Post("/sessions/:sessionId/signal", signalSession)
+
+	// Progress and result of a scripted run
+	protectedAPI.Get("/sessions/:sessionId/run", getScriptRun)
+
+	// Download the output as asciicast, HTML or plain text
+	protectedAPI.Get("/sessions/:sessionId/export", getSessionExport)
+
+	// Current screen content as text
+	protectedAPI.Get("/sessions/:sessionId/screen", getSessionScreen)
+
+	// Record the inputs of a session as a macro
+	protectedAPI.Post("/sessions/:sessionId/recording", startMacroRecording)
+	protectedAPI.Get("/sessions/:sessionId/recording", getMacroRecording)
+	protectedAPI.Delete("/sessions/:sessionId/recording", discardMacroRecording)
+	protectedAPI.Post("/sessions/:sessionId/recording/save", saveMacroRecording)
+
+	// Stored session transcripts
+	protectedAPI.Get("/transcripts", getTranscripts)
+	protectedAPI.Get("/transcripts/:sessionId", getTranscript)
+	protectedAPI.Get("/transcripts/:sessionId/output", getTranscriptOutput)
+	protectedAPI.Get("/transcripts/:sessionId/events", getTranscriptEvents)
+	protectedAPI.Get("/transcripts/:sessionId/export", getTranscriptExport)
+	protectedAPI.Delete("/transcripts/:sessionId", deleteTranscript)
+
 	// Shutdown server gracefully
 	protectedAPI.Post("/shutdown", shutdownServer)
 
@@ -1478,6 +1893,14 @@ func main() {
 			return fiber.ErrUpgradeRequired
 		}
 
+		if share := c.Query("share"); share != "" {
+			if _, valid := lookupShareToken(share); !valid {
+				return fiber.ErrUnauthorized
+			}
+			c.Locals("share", utils.CopyString(share))
+			return c.Next()
+		}
+
 		switch authSettings.Mode {
 		case authModeSession:
 			if sessionStore == nil {
@@ -1907,22 +2330,116 @@ func getSessions(c *fiber.Ctx) error {
 	sessionManager.mutex.RLock()
 	defer sessionManager.mutex.RUnlock()
 
+	user := requestUser(c)
 	sessions := make([]SessionInfo, 0, len(sessionManager.sessions))
 	for _, session := range sessionManager.sessions {
-		sessions = append(sessions, SessionInfo{
+		if !session.canAccess(user) {
+			continue
+		}
+		rows, cols := session.size()
+		info := SessionInfo{
 			ID:         session.ID,
 			Module:     session.Module,
 			ModuleName: session.ModuleName,
 			CreatedAt:  session.CreatedAt,
-			Status:     session.Status,
-		})
+			Status:     session.displayStatus(),
+			Rows:       rows,
+			Cols:       cols,
+			Language:   session.Language,
+			User:       session.User,
+
+			StatusReason:       session.StatusReason,
+			IdleTimeoutSeconds: int(session.IdleTimeout / time.Second),
+			MaxRuntimeSeconds:  int(session.MaxRuntime / time.Second),
+			Privileged:         session.rootHelper != nil,
+			Resources:          session.resources.snapshot(),
+		}
+		if session.Status == "running" {
+			info.Stats = session.stats.Latest()
+		}
+		if shared := session.sharedWith(); len(shared) > 0 {
+			info.SharedWith = shared
+		}
+		info.Controller = session.controller()
+		info.Role = session.sessionRole(user)
+		sessions = append(sessions, info)
 	}
 
 	return c.JSON(sessions)
 }
 
+// lookupSession returns the session with the given ID, if it is still registered
+func (sm *SessionManager) lookupSession(sessionId string) (*ModuleSession, bool) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	session, exists := sm.sessions[sessionId]
+	return session, exists
+}
+
+// normalizeTerminalSize applies defaults to unset dimensions and clamps the rest to sane bounds
+func normalizeTerminalSize(rows, cols int) (uint16, uint16) {
+	if rows <= 0 {
+		rows = defaultTerminalRows
+	}
+	if cols <= 0 {
+		cols = defaultTerminalCols
+	}
+	if rows > maxTerminalRows {
+		rows = maxTerminalRows
+	}
+	if cols > maxTerminalCols {
+		cols = maxTerminalCols
+	}
+	return uint16(rows), uint16(cols)
+}
+
+// normalizeTerminalType returns term if it looks like a terminfo name, otherwise the default
+func normalizeTerminalType(term string) string {
+	term = strings.TrimSpace(term)
+	if term == "" || !terminalTypePattern.MatchString(term) {
+		return defaultTerminalType
+	}
+	return term
+}
+
+// size returns the current PTY dimensions of the session
+func (s *ModuleSession) size() (uint16, uint16) {
+	s.sizeMutex.Lock()
+	defer s.sizeMutex.Unlock()
+	return s.Rows, s.Cols
+}
+
+// resize applies a new window size to the session PTY and sends SIGWINCH to the module
+func (s *ModuleSession) resize(rows, cols int) error {
+	newRows, newCols := normalizeTerminalSize(rows, cols)
+
+	s.sizeMutex.Lock()
+	defer s.sizeMutex.Unlock()
+
+	if s.Rows == newRows && s.Cols == newCols {
+		return nil
+	}
+
+	if err := pty.Setsize(s.PTY, &pty.Winsize{Rows: newRows, Cols: newCols}); err != nil {
+		return fmt.Errorf("failed to set PTY size: %w", err)
+	}
+	s.Rows, s.Cols = newRows, newCols
+	s.Stream.Resize(newRows, newCols)
+	s.Transcript.WriteResize(newRows, newCols)
+
+	// The kernel notifies the foreground process group of the terminal; signal the
+	// module shell as well so it refreshes COLUMNS/LINES even while a child runs.
+	if pid := s.pid(); pid > 0 {
+		_ = s.signal(pid, unix.SIGWINCH)
+	}
+
+	return nil
+}
+
 func startModule(c *fiber.Ctx) error {
-	moduleId := c.Params("id")
+	// Copy the parameter: Fiber reuses its buffer after the handler returns,
+	// but the session keeps the module ID for its whole lifetime
+	moduleId := utils.CopyString(c.Params("id"))
 
 	// Parse request body for language preference
 	var req StartModuleRequest
@@ -1931,13 +2448,49 @@ func startModule(c *fiber.Ctx) error {
 		req.Language = "en"
 	}
 
+	session, startErr := launchModuleSession(moduleId, req, requestUser(c))
+	if startErr != nil {
+		return c.Status(startErr.status).JSON(startErr.body)
+	}
+
+	return c.JSON(fiber.Map{"sessionId": session.ID})
+}
+
+// moduleStartError carries the response for a module that could not be started
+type moduleStartError struct {
+	status int
+	body   fiber.Map
+}
+
+func newModuleStartError(status int, body fiber.Map) *moduleStartError {
+	return &moduleStartError{status: status, body: body}
+}
+
+func (e *moduleStartError) Error() string {
+	if message, ok := e.body["message"].(string); ok && message != "" {
+		return message
+	}
+	return fmt.Sprint(e.body["error"])
+}
+
+// launchModuleSession starts a module in a new PTY session on behalf of user
+// and registers the session
+func launchModuleSession(moduleId string, req StartModuleRequest, user string) (*ModuleSession, *moduleStartError) {
 	// Validate language - fallback to English if invalid
 	if req.Language == "" || (req.Language != "en" && req.Language != "de") {
 		req.Language = "en"
 	}
 
+	rows, cols := normalizeTerminalSize(req.Rows, req.Cols)
+	term := normalizeTerminalType(req.Term)
+	if req.Resources != nil {
+		if err := req.Resources.validate(); err != nil {
+			return nil, newModuleStartError(400, fiber.Map{"error": "Invalid resources", "message": err.Error()})
+		}
+	}
+
 	// Generate session ID
-	sessionId := fmt.Sprintf("%s_%d", moduleId, time.Now().Unix())
+	sessionId := newSessionID()
 
 	// Look up module in registry (including submodules)
 	appState.mutex.RLock()
@@ -1946,12 +2499,24 @@ func startModule(c *fiber.Ctx) error {
 
 	var modulePath string
 	var moduleName string
+	var moduleVersion string
+	var concurrency *ConcurrencyInfo
+	var timeouts *TimeoutInfo
+	var environment *EnvironmentInfo
+	var moduleResources *ResourceLimits
+	var requiresRoot bool
 	found := false
 
 	if registry != nil && registry.Modules != nil {
 		// Use the recursive findModuleByID function to search including submodules
 		if module := findModuleByID(registry.Modules, moduleId); module != nil {
 			modulePath = module.Entry
+			moduleVersion = module.Version
+			concurrency = module.Concurrency
+			timeouts = module.Timeouts
+			environment = module.Environment
+			moduleResources = module.Resources
+			requiresRoot = module.RequiresRoot
 			moduleName = module.Display.FallbackName
 			if moduleName == "" {
 				moduleName = module.ID
@@ -1963,43 +2528,89 @@ func startModule(c *fiber.Ctx) error {
 	// Registry is required - no fallback
 	if !found {
 		log.Printf("ERROR: Module '%s' not found in registry", moduleId)
-		return c.Status(404).JSON(fiber.Map{
+		return nil, newModuleStartError(404, fiber.Map{
 			"error":   "Module not found",
 			"message": fmt.Sprintf("Module '%s' not found in registry", moduleId),
 		})
 	}
 
-	scriptPath := filepath.Join(lhRootDir, modulePath)
-
-	// Start the module process with PTY - disable buffering
-	cmd := exec.Command("stdbuf", "-i0", "-o0", "-e0", "bash", scriptPath)
-	cmd.Dir = lhRootDir
-
-	// Set up environment variables
-	cmd.Env = append(os.Environ(),
-		"LH_ROOT_DIR="+lhRootDir,
-		"LH_GUI_MODE=true",
-		"LH_LANG="+req.Language,   // Set language for CLI modules
-		"TERM=xterm-256color",     // Ensure color support
-		"FORCE_COLOR=1",           // Force color output
-		"COLUMNS=120",             // Set terminal width
-		"LINES=40",                // Set terminal height
-		"LANG="+os.Getenv("LANG"), // Preserve locale settings
-		"PS1=$ ",                  // Simple prompt
-	)
-
-	// Start the process with a PTY
-	ptmx, err := pty.Start(cmd)
+	// Enforce the module's concurrency rules against GUI and CLI sessions
+	runLock, err := acquireRunLock(RunLockHolder{
+		SessionID:  sessionId,
+		ModuleID:   moduleId,
+		ModuleName: moduleName,
+		PID:        os.Getpid(),
+		Context:    "GUI",
+		User:       user,
+		Started:    time.Now().Format("2006-01-02T15:04:05-07:00"),
+	}, concurrency)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to start module with PTY"})
-	}
+		var conflict *RunLockConflict
+		if errors.As(err, &conflict) {
+			log.Printf("Refusing to start module '%s': %v", moduleId, conflict)
+			return nil, newModuleStartError(409, fiber.Map{
+				"error":    "Module cannot start now",
+				"message":  fmt.Sprintf("Module '%s' cannot start: %v", moduleId, conflict),
+				"conflict": conflict,
+			})
+		}
+		log.Printf("ERROR: Could not acquire run lock for module '%s': %v", moduleId, err)
+		return nil, newModuleStartError(500, fiber.Map{"error": "Failed to check module concurrency rules"})
+	}
+
+	if moduleResources != nil {
+		if err := moduleResources.validate(); err != nil {
+			log.Printf("Warning: ignoring resources of module '%s': %v", moduleId, err)
+			moduleResources = nil
+		}
+	}
+	limits := mergeResourceLimits(moduleResources, req.Resources)
+
+	// Root modules are started by the root helper when the GUI runs unprivileged
+	var cmd *exec.Cmd
+	var resources *sessionResources
+	var helper *rootHelperClient
+	var ptmx *os.File
+	if requiresRoot && os.Geteuid() != 0 && rootHelperSocket != "" {
+		helper, ptmx, err = startPrivilegedModule(rootHelperMessage{
+			Type:     "start",
+			Module:   moduleId,
+			Language: req.Language,
+			Term:     term,
+			Rows:     rows,
+			Cols:     cols,
+			LockID:   sessionId,
+			Limits:   &limits,
+		})
+		if err != nil {
+			runLock.Release()
+			log.Printf("ERROR: Root helper could not start module '%s': %v", moduleId, err)
+			return nil, newModuleStartError(502, fiber.Map{
+				"error":   "Failed to start module as root",
+				"message": err.Error(),
+			})
+		}
+		if helper.resources != nil {
+			// The helper owns the cgroup and removes it; the GUI only reads it
+			resources = &sessionResources{info: *helper.resources, cgroupFD: -1}
+		}
+	} else {
+		if requiresRoot && os.Geteuid() != 0 {
+			log.Printf("Warning: module '%s' requires root, but no root helper is configured (CFG_LH_GUI_ROOT_HELPER_SOCKET); starting it as uid %d", moduleId, os.Geteuid())
+		}
 
-	// Set PTY size for better compatibility
-	if err := pty.Setsize(ptmx, &pty.Winsize{
-		Rows: 40,
-		Cols: 120,
-	}); err != nil {
-		log.Printf("Failed to set PTY size: %v", err)
+		// Start the process with a PTY sized like the client terminal so the first
+		// screen is already rendered with the right width
+		cmd = moduleCommand(filepath.Join(lhRootDir, modulePath), environment, req.Language, term, rows, cols, sessionId)
+		resources = newSessionResources(sessionId, limits)
+		resources.prepare(cmd)
+		ptmx, err = pty.StartWithSize(cmd, &pty.Winsize{Rows: rows, Cols: cols})
+		if err != nil {
+			resources.release()
+			runLock.Release()
+			return nil, newModuleStartError(500, fiber.Map{"error": "Failed to start module with PTY"})
+		}
+		resources.started(cmd.Process.Pid)
 	}
 
 	// Create session
@@ -2009,34 +2620,74 @@ func startModule(c *fiber.Ctx) error {
 		ModuleName: moduleName,
 		CreatedAt:  time.Now(),
 		Status:     "running",
+		Language:   req.Language,
+		User:       user,
 		Process:    cmd,
 		PTY:        ptmx,
-		Done:       make(chan bool),
-		Output:     make(chan string, 100),
-		Buffer:     make([]string, 0, 200), // Buffer first 200 output messages
+		Done:       make(chan struct{}),
+		Stream:     newOutputStream(scrollbackBytes, rows, cols),
+		readerDone: make(chan struct{}),
+		Rows:       rows,
+		Cols:       cols,
+		Term:       term,
+
+		ModuleVersion: moduleVersion,
+		runLock:       runLock,
+		rootHelper:    helper,
+		resources:     resources,
+	}
+	session.IdleTimeout, session.MaxRuntime = sessionTimeouts(timeouts)
+	session.touch()
+	session.events = newGUIEventParser(sessionId, session.Stream)
+
+	// Record the output to disk; a failing transcript store must not block the module
+	transcript, err := newTranscriptWriter(session)
+	if err != nil {
+		log.Printf("Warning: transcript disabled for session %s: %v", sessionId, err)
 	}
+	session.Transcript = transcript
 
 	// Store session
 	sessionManager.mutex.Lock()
 	sessionManager.sessions[sessionId] = session
 	sessionManager.mutex.Unlock()
 
+	sessionHistory.RecordStart(session)
+
 	// Start output reader for PTY
 	go readPTYOutput(session)
+	go session.watchTimeouts()
+	go session.watchStats()
+	go session.watchInput()
 
 	// Wait for process completion
 	go func() {
-		cmd.Wait()
+		exitStatus, waitErr := session.wait()
+
+		// Let the reader deliver the last output before the PTY goes away. Background
+		// children may keep the slave side open, so do not wait forever.
+		select {
+		case <-session.readerDone:
+		case <-time.After(2 * time.Second):
+		}
 		ptmx.Close()
 
-		// Update session status
+		// Update session status; stop() records its reason before signalling
 		sessionManager.mutex.Lock()
-		if s, exists := sessionManager.sessions[sessionId]; exists {
-			s.Status = "stopped"
+		stopReason := session.StatusReason
+		session.Status = "stopped"
+		if stopReason == "" {
+			session.StatusReason = statusReasonExited
 		}
+		session.exitStatus = exitStatus
 		sessionManager.mutex.Unlock()
 
-		session.Done <- true
+		sessionHistory.RecordExit(session, exitStatus, waitErr, stopReason)
+		session.rootHelper.Close()
+		session.resources.release()
+		session.runLock.Release()
+		session.Transcript.Close("stopped", session.sharedWith())
+		session.finish()
 
 		// Clean up session after a brief delay to allow status to be seen
 		time.Sleep(1 * time.Second)
@@ -2045,7 +2696,50 @@ func startModule(c *fiber.Ctx) error {
 		sessionManager.mutex.Unlock()
 	}()
 
-	return c.JSON(fiber.Map{"sessionId": sessionId})
+	return session, nil
+}
+
+// moduleCommand prepares the command that runs a module script in a PTY
+func moduleCommand(scriptPath string, environment *EnvironmentInfo, language, term string, rows, cols uint16, sessionId string) *exec.Cmd {
+	// Disable buffering so output reaches the terminal right away
+	cmd := exec.Command("stdbuf", "-i0", "-o0", "-e0", "bash", scriptPath)
+	cmd.Dir = lhRootDir
+
+	// Run the module as leader of its own terminal session and process group so
+	// that stopping it can reach every child, not only stdbuf/bash
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	// Set up environment variables; the server's own environment is filtered so
+	// that GUI credentials do not reach the module
+	cmd.Env = append(moduleEnvironment(os.Environ(), environment),
+		"LH_ROOT_DIR="+lhRootDir,
+		"LH_GUI_MODE=true",
+		"LH_LANG="+language,                // Set language for CLI modules
+		"TERM="+term,                       // Terminal type requested by the client
+		"FORCE_COLOR=1",                    // Force color output
+		"COLUMNS="+strconv.Itoa(int(cols)), // Set terminal width
+		"LINES="+strconv.Itoa(int(rows)),   // Set terminal height
+		"LANG="+os.Getenv("LANG"),          // Preserve locale settings
+		"PS1=$ ",                           // Simple prompt
+		"LH_RUN_LOCK_ID="+sessionId,        // Parent lock for submodules launched by the module
+	)
+	return cmd
+}
+
+// wait waits for the module process to exit and returns its wait status, which
+// is nil if it is unknown
+func (s *ModuleSession) wait() (*syscall.WaitStatus, error) {
+	if s.rootHelper != nil {
+		return s.rootHelper.wait()
+	}
+
+	waitErr := s.Process.Wait()
+	if state := s.Process.ProcessState; state != nil {
+		if status, ok := state.Sys().(syscall.WaitStatus); ok {
+			return &status, waitErr
+		}
+	}
+	return nil, waitErr
 }
 
 func sendInput(c *fiber.Ctx) error {
@@ -2061,72 +2755,109 @@ func sendInput(c *fiber.Ctx) error {
 	}
 
 	// Enforce a maximum input size to prevent abuse (bytes)
-	const maxInputSize = 4096
 	if len(input.Data) > maxInputSize {
 		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": fmt.Sprintf("Input too large (max %d bytes)", maxInputSize)})
 	}
 
-	log.Printf("Received input for session %s: '%s'", sessionId, input.Data)
-
-	sessionManager.mutex.RLock()
-	session, exists := sessionManager.sessions[sessionId]
-	sessionManager.mutex.RUnlock()
-
-	if !exists {
-		log.Printf("Session %s not found", sessionId)
-		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(sessionId, user)
+	if err == nil && !session.canControl(user) {
+		err = errSessionObserver
+	}
+	if err != nil {
+		log.Printf("Input for session %s rejected: %v", sessionId, err)
+		return sessionErrorResponse(c, err)
 	}
 
-	// Send input to the PTY
-	log.Printf("Sending input to PTY: '%s'", input.Data)
+	// Only the redacted input may be logged or recorded
+	redacted, secret := session.redactor.Line(input.Data)
+	if logTerminalIO {
+		log.Printf("Received input for session %s: %q", sessionId, redacted)
+	} else {
+		log.Printf("Received input for session %s (%d bytes)", sessionId, len(input.Data))
+	}
 
 	// Send normal input with newline (including single digit menu choices)
 	inputBytes := []byte(input.Data + "\n")
-	log.Printf("Sending normal input: '%s' + newline", input.Data)
 
-	_, err := session.PTY.Write(inputBytes)
-	if err != nil {
+	if err := session.writeInput(inputBytes); err != nil {
 		log.Printf("Error writing to PTY: %v", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to send input"})
 	}
-
-	// Force flush the PTY buffer to ensure input is sent immediately
-	session.PTY.Sync()
+	if recorder := session.recorder.Load(); recorder != nil {
+		recorder.recordInput(redacted, secret)
+	}
 
 	log.Printf("Input sent successfully to session %s", sessionId)
 	return c.JSON(fiber.Map{"status": "sent"})
 }
 
-func stopSession(c *fiber.Ctx) error {
-	sessionId := c.Params("sessionId")
+// finish marks the session as ended for every subscriber and waiter
+func (s *ModuleSession) finish() {
+	s.doneOnce.Do(func() {
+		// Close Done first so subscribers that see their queue closed can tell a
+		// session end apart from an unsubscribe
+		close(s.Done)
+		s.Stream.Close()
+	})
+}
+
+// writeInput writes data to the session PTY exactly as given
+func (s *ModuleSession) writeInput(data []byte) error {
+	if _, err := s.PTY.Write(data); err != nil {
+		return err
+	}
+	s.touch()
+
+	// The menu or prompt shown so far has been answered
+	s.events.InputSent()
+	s.Stream.ClearState(stateSlotInteraction)
+	s.inputResumed()
+
+	// Force flush the PTY buffer to ensure input is sent immediately
+	s.PTY.Sync()
+	return nil
+}
+
+// stop marks the session as stopped for reason, closes its PTY and terminates
+// its process tree. It returns the processes that could not be stopped.
+func (s *ModuleSession) stop(reason string) []*ProcessInfo {
+	// Once the leader has been reaped its PID and process group may belong to
+	// an unrelated process, so an ended session must not be signalled
+	select {
+	case <-s.Done:
+		return nil
+	default:
+	}
 
 	sessionManager.mutex.Lock()
-	session, exists := sessionManager.sessions[sessionId]
-	if exists {
-		session.Status = "stopped"
+	s.Status = "stopped"
+	if s.StatusReason == "" {
+		s.StatusReason = reason
 	}
 	sessionManager.mutex.Unlock()
 
-	if !exists {
-		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	if s.PTY != nil {
+		s.PTY.Close()
 	}
+	return s.terminate()
+}
+
+func stopSession(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
 
-	// Terminate the process and close PTY
-	if session.PTY != nil {
-		session.PTY.Close()
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(sessionId, user)
+	if err != nil {
+		return sessionErrorResponse(c, err)
 	}
-	if session.Process != nil && session.Process.Process != nil {
-		// Try graceful shutdown first
-		_ = session.Process.Process.Signal(unix.SIGTERM)
-		select {
-		case <-session.Done:
-			// Process exited gracefully
-		case <-time.After(2 * time.Second):
-			// Force kill if still running
-			_ = session.Process.Process.Kill()
-		}
+	if !session.isOwner(user) && !session.canControl(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner or the user in control can stop the session"})
 	}
 
+	// Terminate the whole process tree and close PTY
+	survivors := session.stop(stopReasonUser)
+
 	// Clean up session after a brief delay
 	go func() {
 		time.Sleep(1 * time.Second)
@@ -2135,7 +2866,11 @@ func stopSession(c *fiber.Ctx) error {
 		sessionManager.mutex.Unlock()
 	}()
 
-	return c.JSON(fiber.Map{"status": "stopped"})
+	response := fiber.Map{"status": "stopped"}
+	if len(survivors) > 0 {
+		response["surviving_processes"] = survivors
+	}
+	return c.JSON(response)
 }
 
 // shutdownServer handles graceful server shutdown
@@ -2150,7 +2885,7 @@ func shutdownServer(c *fiber.Ctx) error {
 				Module:     session.Module,
 				ModuleName: session.ModuleName,
 				CreatedAt:  session.CreatedAt,
-				Status:     session.Status,
+				Status:     session.displayStatus(),
 			})
 		}
 	}
@@ -2176,33 +2911,43 @@ func shutdownServer(c *fiber.Ctx) error {
 	go func() {
 		log.Println("Initiating graceful server shutdown...")
 
-		// Stop all active sessions
+		// Mark all active sessions as stopped, then terminate them in parallel without
+		// holding the lock, which their wait goroutines need to record the exit
 		sessionManager.mutex.Lock()
-		for sessionId, session := range sessionManager.sessions {
+		stopping := make([]*ModuleSession, 0, len(sessionManager.sessions))
+		for _, session := range sessionManager.sessions {
 			if session.Status != "stopped" {
-				log.Printf("Stopping session %s (%s)", sessionId, session.ModuleName)
 				session.Status = "stopped"
+				session.StatusReason = stopReasonShutdown
+				stopping = append(stopping, session)
+			}
+		}
+		sessionManager.mutex.Unlock()
+
+		var wg sync.WaitGroup
+		for _, session := range stopping {
+			wg.Add(1)
+			go func(session *ModuleSession) {
+				defer wg.Done()
+				log.Printf("Stopping session %s (%s)", session.ID, session.ModuleName)
 
-				// Terminate the process and close PTY
-				if session.PTY != nil {
-					session.PTY.Close()
+				// Terminate the whole process tree and close PTY
+				if survivors := session.stop(stopReasonShutdown); len(survivors) > 0 {
+					log.Printf("Session %s: %d processes could not be stopped", session.ID, len(survivors))
 				}
-				if session.Process != nil && session.Process.Process != nil {
-					// Try graceful shutdown first
-					_ = session.Process.Process.Signal(unix.SIGTERM)
-					select {
-					case <-session.Done:
-						// Process exited gracefully
-						log.Printf("Session %s stopped gracefully", sessionId)
-					case <-time.After(2 * time.Second):
-						// Force kill if still running
-						_ = session.Process.Process.Kill()
-						log.Printf("Session %s force-killed", sessionId)
-					}
+
+				select {
+				case <-session.Done:
+					log.Printf("Session %s stopped", session.ID)
+				case <-time.After(3 * time.Second):
+					log.Printf("Session %s did not finish in time", session.ID)
 				}
-			}
+			}(session)
 		}
+		wg.Wait()
+
 		// Clear all sessions
+		sessionManager.mutex.Lock()
 		sessionManager.sessions = make(map[string]*ModuleSession)
 		sessionManager.mutex.Unlock()
 
@@ -2242,6 +2987,8 @@ func getVersion(c *fiber.Ctx) error {
 }
 
 func readPTYOutput(session *ModuleSession) {
+	defer close(session.readerDone)
+
 	log.Printf("Starting PTY output reader for session %s", session.ID)
 	buffer := make([]byte, 1024)
 
@@ -2250,10 +2997,6 @@ func readPTYOutput(session *ModuleSession) {
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("PTY read error for session %s: %v", session.ID, err)
-				select {
-				case session.Output <- fmt.Sprintf("Error reading PTY: %v", err):
-				default:
-				}
 			} else {
 				log.Printf("PTY reached EOF for session %s", session.ID)
 			}
@@ -2261,28 +3004,35 @@ func readPTYOutput(session *ModuleSession) {
 		}
 
 		if n > 0 {
-			output := string(buffer[:n])
-			log.Printf("PTY output for session %s (%d bytes): %q", session.ID, n, output)
+			session.touch()
 
-			// Store in buffer for late-connecting WebSocket clients
-			session.BufferMutex.Lock()
-			if len(session.Buffer) < 200 { // Keep last 200 messages
-				session.Buffer = append(session.Buffer, output)
+			// Prompt events become separate messages and are not shown in the terminal
+			output := session.events.Feed(string(buffer[:n]))
+			if output == "" {
+				continue
+			}
+			redacted := session.redactor.Output(output)
+			if logTerminalIO {
+				log.Printf("PTY output for session %s (%d bytes): %q", session.ID, n, redacted)
 			} else {
-				// Rotate buffer - remove first element, add new one
-				session.Buffer = append(session.Buffer[1:], output)
+				log.Printf("PTY output for session %s (%d bytes)", session.ID, n)
 			}
-			session.BufferMutex.Unlock()
+
+			session.Transcript.WriteOutput(redacted)
 
 			// Send raw output to preserve formatting and colors
-			select {
-			case session.Output <- output:
-			default:
-				// Channel is full, skip this output
-				log.Printf("Output channel full for session %s, skipping output", session.ID)
+			session.Stream.Publish(session.ID, output)
+
+			if recorder := session.recorder.Load(); recorder != nil {
+				recorder.appendOutput(redacted)
 			}
 		}
 	}
+
+	if rest := session.events.Stop(); rest != "" {
+		session.Transcript.WriteOutput(session.redactor.Output(rest))
+		session.Stream.Publish(session.ID, rest)
+	}
 	log.Printf("PTY output reader finished for session %s", session.ID)
 }
 
@@ -2304,10 +3054,124 @@ func serveFrontendIndex(c *fiber.Ctx) error {
 	return nil
 }
 
+// wsWriteTimeout bounds a single WebSocket write
+const wsWriteTimeout = 10 * time.Second
+
+// wsWriter serialises writes to a WebSocket connection that is shared between
+// the read loop and the output streaming goroutine.
+type wsWriter struct {
+	conn  *websocket.Conn
+	mutex sync.Mutex
+}
+
+func (w *wsWriter) send(message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// A stalled client must not block the stream forever; the output stream
+	// applies its own backpressure and disconnects subscribers that lag behind.
+	_ = w.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return w.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (w *wsWriter) sendError(text string) {
+	_ = w.send(Message{Type: "error", Content: text})
+}
+
+// streamSessionOutput subscribes the connection to the session output and
+// forwards it until the session ends or the returned stop function is called.
+// The first message replays the retained output after sinceOffset (everything
+// when negative); every output message carries the byte range it covers so the
+// client can detect gaps and resume after a reconnect.
+func streamSessionOutput(writer *wsWriter, session *ModuleSession, sinceOffset int64) func() {
+	sub := session.Stream.Subscribe(sinceOffset)
+
+	go func() {
+		defer session.Stream.Unsubscribe(sub)
+
+		var delivered int64
+		for {
+			batch, ok := sub.Next()
+			if !ok {
+				break
+			}
+
+			if batch.Event != nil {
+				if err := writer.send(Message{Type: batch.Event.Type, Content: batch.Event.Content}); err != nil {
+					log.Printf("WebSocket write failed for session %s: %v", session.ID, err)
+					return
+				}
+				continue
+			}
+
+			if err := writer.send(Message{
+				Type:       "output",
+				Content:    batch.Data,
+				Offset:     batch.Offset,
+				NextOffset: batch.NextOffset,
+				Snapshot:   batch.Snapshot,
+			}); err != nil {
+				log.Printf("WebSocket write failed for session %s: %v", session.ID, err)
+				return
+			}
+			delivered = batch.NextOffset
+		}
+
+		if sub.Lagged() {
+			writer.send(Message{
+				Type:       "lagged",
+				Content:    session.ID,
+				NextOffset: delivered,
+			})
+			return
+		}
+
+		// The subscriber also ends on unsubscribe; only report a real session end
+		select {
+		case <-session.Done:
+			writer.send(Message{
+				Type:       "session_ended",
+				Content:    session.ID,
+				NextOffset: session.Stream.EndOffset(),
+			})
+		default:
+		}
+	}()
+
+	return func() {
+		session.Stream.Unsubscribe(sub)
+	}
+}
+
 func handleWebSocket(c *websocket.Conn) {
 	defer c.Close()
 
-	var sessionId string
+	writer := &wsWriter{conn: c}
+	var (
+		sessionId     string
+		stopStreaming func()
+		user          string // Authenticated user of the connection
+		share         string // Share token of an observer who did not log in
+	)
+	if value := c.Locals("user"); value != nil {
+		user = fmt.Sprint(value)
+	}
+	if value, ok := c.Locals("share").(string); ok {
+		share = value
+		stop := make(chan struct{})
+		defer close(stop)
+		go watchShareToken(share, c, writer, stop)
+	}
+	defer func() {
+		if stopStreaming != nil {
+			stopStreaming()
+		}
+	}()
 
 	for {
 		messageType, msg, err := c.ReadMessage()
@@ -2317,7 +3181,7 @@ func handleWebSocket(c *websocket.Conn) {
 		}
 
 		if messageType == websocket.TextMessage {
-			var message Message
+			var message ClientMessage
 			if err := json.Unmarshal(msg, &message); err != nil {
 				log.Println("JSON unmarshal error:", err)
 				continue
@@ -2325,67 +3189,106 @@ func handleWebSocket(c *websocket.Conn) {
 
 			switch message.Type {
 			case "subscribe":
-				if id, ok := message.Content.(string); ok {
-					sessionId = id
+				var req SubscribeRequest
+				if err := json.Unmarshal(message.Content, &req.SessionID); err != nil {
+					if err := json.Unmarshal(message.Content, &req); err != nil {
+						writer.sendError("Invalid subscribe message")
+						continue
+					}
+				}
 
-					// Start streaming output for this session
-					go func() {
-						sessionManager.mutex.RLock()
-						session, exists := sessionManager.sessions[sessionId]
-						sessionManager.mutex.RUnlock()
+				session, err := lookupSessionForConnection(req.SessionID, user, share)
+				if err != nil {
+					writer.sendError(err.Error())
+					continue
+				}
 
-						if !exists {
-							return
-						}
+				sinceOffset := int64(-1)
+				if req.SinceOffset != nil {
+					sinceOffset = *req.SinceOffset
+				}
 
-						// First, send buffered output to catch up on what was missed
-						session.BufferMutex.RLock()
-						for _, bufferedOutput := range session.Buffer {
-							response := Message{
-								Type:    "output",
-								Content: bufferedOutput,
-							}
-							data, _ := json.Marshal(response)
-							c.WriteMessage(websocket.TextMessage, data)
-						}
-						session.BufferMutex.RUnlock()
-
-						// Drain any queued output from the channel to avoid duplicates
-						drained := 0
-					drainLoop:
-						for {
-							select {
-							case <-session.Output:
-								drained++
-							default:
-								break drainLoop
-							}
-						}
-						if drained > 0 {
-							log.Printf("Drained %d duplicate messages from channel for session %s", drained, sessionId)
-						}
+				// A socket follows one session at a time; switching sessions
+				// unsubscribes from the previous one
+				if stopStreaming != nil {
+					stopStreaming()
+				}
+				sessionId = req.SessionID
+				stopStreaming = streamSessionOutput(writer, session, sinceOffset)
+			case "input":
+				var req RawInputRequest
+				if err := json.Unmarshal(message.Content, &req.Data); err != nil {
+					if err := json.Unmarshal(message.Content, &req); err != nil {
+						writer.sendError("Invalid input message")
+						continue
+					}
+				}
 
-						// Then continue with live output
-						for {
-							select {
-							case output := <-session.Output:
-								response := Message{
-									Type:    "output",
-									Content: output,
-								}
-								data, _ := json.Marshal(response)
-								c.WriteMessage(websocket.TextMessage, data)
-							case <-session.Done:
-								response := Message{
-									Type:    "session_ended",
-									Content: sessionId,
-								}
-								data, _ := json.Marshal(response)
-								c.WriteMessage(websocket.TextMessage, data)
-								return
-							}
-						}
-					}()
+				data := []byte(req.Data)
+				if strings.EqualFold(req.Encoding, "base64") {
+					decoded, err := base64.StdEncoding.DecodeString(req.Data)
+					if err != nil {
+						writer.sendError("Invalid base64 input")
+						continue
+					}
+					data = decoded
+				}
+
+				if len(data) == 0 {
+					continue
+				}
+				if len(data) > maxInputSize {
+					writer.sendError(fmt.Sprintf("Input too large (max %d bytes)", maxInputSize))
+					continue
+				}
+
+				targetId := req.SessionID
+				if targetId == "" {
+					targetId = sessionId
+				}
+
+				session, err := lookupSessionForConnection(targetId, user, share)
+				if err == nil && (share != "" || !session.canControl(user)) {
+					err = errSessionObserver
+				}
+				if err != nil {
+					writer.sendError(err.Error())
+					continue
+				}
+
+				redacted := session.redactor.Keys(string(data))
+				if logTerminalIO {
+					log.Printf("Raw input for session %s: %q", targetId, redacted)
+				}
+				if err := session.writeInput(data); err != nil {
+					log.Printf("Error writing raw input to PTY for session %s: %v", targetId, err)
+					writer.sendError("Failed to send input")
+				}
+			case "resize":
+				var req ResizeRequest
+				if err := json.Unmarshal(message.Content, &req); err != nil {
+					writer.sendError("Invalid resize request")
+					continue
+				}
+
+				targetId := req.SessionID
+				if targetId == "" {
+					targetId = sessionId
+				}
+
+				session, err := lookupSessionForConnection(targetId, user, share)
+				if err != nil {
+					writer.sendError(err.Error())
+					continue
+				}
+				if share != "" || !session.canControl(user) {
+					// The terminal keeps the size of the user in control
+					continue
+				}
+
+				if err := session.resize(req.Rows, req.Cols); err != nil {
+					log.Printf("Resize failed for session %s: %v", targetId, err)
+					writer.sendError("Failed to resize terminal")
 				}
 			}
 		}
@@ -0,0 +1,782 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	ossignal "os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// The GUI runs unprivileged. Modules that declare requires_root are started by
+// a small helper running as root (the same binary with --root-helper), which
+// listens on a Unix socket that only the GUI user can use. The GUI sends one
+// JSON line per request; the helper starts the module in a PTY and hands the
+// PTY master back with SCM_RIGHTS, so output and input never pass the helper.
+//
+// Each connection carries exactly one module:
+//
+//	GUI -> helper: start, then signal / terminate requests
+//	helper -> GUI: started (with the PTY), signaled, terminated, error, and
+//	               exit once the module has ended
+//
+// Closing the connection while the module runs terminates it.
+const (
+	defaultRootHelperSocket = "/run/little-linux-helper/root-helper.sock"
+
+	rootHelperDialTimeout  = 5 * time.Second
+	rootHelperStartTimeout = 30 * time.Second // Includes reloading the module registry
+	rootHelperMaxMessage   = 64 * 1024
+)
+
+// rootHelperRequestTimeout covers a terminate request, which may wait for
+// SIGTERM and SIGKILL to take effect
+var rootHelperRequestTimeout = terminateGracePeriod + killWaitPeriod + 5*time.Second
+
+// rootHelperSignals are the signals the helper delivers on behalf of the GUI
+var rootHelperSignals = map[unix.Signal]bool{
+	unix.SIGINT:   true,
+	unix.SIGTSTP:  true,
+	unix.SIGSTOP:  true,
+	unix.SIGCONT:  true,
+	unix.SIGHUP:   true,
+	unix.SIGQUIT:  true,
+	unix.SIGWINCH: true,
+}
+
+// rootHelperSocket is the socket of the root helper; empty disables it
+var rootHelperSocket = ""
+
+// rootHelperMessage is one line of the root helper protocol; the fields used
+// depend on Type
+type rootHelperMessage struct {
+	Type string `json:"type"`
+
+	// start
+	Module   string          `json:"module,omitempty"`
+	Language string          `json:"language,omitempty"`
+	Term     string          `json:"term,omitempty"`
+	Rows     uint16          `json:"rows,omitempty"`
+	Cols     uint16          `json:"cols,omitempty"`
+	LockID   string          `json:"lock_id,omitempty"`
+	Limits   *ResourceLimits `json:"limits,omitempty"`
+
+	// started
+	PID       int               `json:"pid,omitempty"`
+	Resources *SessionResources `json:"resources,omitempty"`
+
+	// signal: a PID, or a process group as negative number
+	Target int `json:"target,omitempty"`
+	Signal int `json:"signal,omitempty"`
+
+	// exit: the raw wait status, absent if unknown
+	Status *uint32 `json:"status,omitempty"`
+
+	// terminated
+	Survivors []*ProcessInfo `json:"survivors,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// peerCredentials returns the credentials of the process on the other end of
+// a Unix socket
+func peerCredentials(conn *net.UnixConn) (*unix.Ucred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	return cred, credErr
+}
+
+// ---------------------------------------------------------------------------
+// Helper side (runs as root)
+
+// rootHelper serves the GUI connections
+type rootHelper struct {
+	guiUID uint32
+}
+
+// runRootHelper runs the helper until it receives SIGTERM or SIGINT. Only
+// guiUser and root may connect to socketPath.
+func runRootHelper(socketPath, guiUser string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("the root helper must run as root")
+	}
+	if guiUser == "" {
+		return fmt.Errorf("--gui-user is required")
+	}
+
+	account, err := user.Lookup(guiUser)
+	if err != nil {
+		if account, err = user.LookupId(guiUser); err != nil {
+			return fmt.Errorf("unknown GUI user %q", guiUser)
+		}
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid uid of user %q: %v", guiUser, err)
+	}
+	gid, err := strconv.Atoi(account.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid of user %q: %v", guiUser, err)
+	}
+	if uid == 0 {
+		return fmt.Errorf("the GUI user must not be root")
+	}
+
+	if err := checkRootOwned(lhRootDir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0o755); err != nil {
+		return fmt.Errorf("could not create socket directory: %w", err)
+	}
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove stale socket: %w", err)
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chown(socketPath, uid, gid); err != nil {
+		listener.Close()
+		return fmt.Errorf("could not hand the socket to %s: %w", account.Username, err)
+	}
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		listener.Close()
+		return fmt.Errorf("could not restrict the socket: %w", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	ossignal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		// Closing the listener also removes the socket file
+		listener.Close()
+	}()
+
+	log.Printf("Root helper listening on %s for user %s (uid %d)", socketPath, account.Username, uid)
+
+	helper := &rootHelper{guiUID: uint32(uid)}
+	for {
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				log.Println("Root helper stopped")
+				return nil
+			}
+			log.Printf("Root helper: accept failed: %v", err)
+			continue
+		}
+		go helper.serve(conn)
+	}
+}
+
+// rootHelperConn is one GUI connection and the module it started
+type rootHelperConn struct {
+	conn       *net.UnixConn
+	writeMutex sync.Mutex
+	cmd        *exec.Cmd
+	done       chan struct{} // Closed once the module has exited
+}
+
+func (h *rootHelper) serve(conn *net.UnixConn) {
+	defer conn.Close()
+
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		log.Printf("Root helper: could not read peer credentials: %v", err)
+		return
+	}
+	if cred.Uid != h.guiUID && cred.Uid != 0 {
+		log.Printf("Root helper: rejected connection from uid %d (pid %d)", cred.Uid, cred.Pid)
+		return
+	}
+
+	c := &rootHelperConn{conn: conn}
+	reader := bufio.NewReaderSize(conn, 4096)
+	for {
+		var msg rootHelperMessage
+		if err := readRootHelperMessage(reader, &msg); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Root helper: %v", err)
+			}
+			break
+		}
+		c.handle(&msg, cred)
+	}
+
+	// The GUI went away; do not leave a root module running unattended
+	if c.cmd != nil {
+		select {
+		case <-c.done:
+		default:
+			log.Printf("Root helper: GUI disconnected, terminating module (pid %d)", c.cmd.Process.Pid)
+			terminateProcessTree("root-"+strconv.Itoa(c.cmd.Process.Pid), c.cmd.Process.Pid)
+			<-c.done
+		}
+	}
+}
+
+func (c *rootHelperConn) handle(msg *rootHelperMessage, cred *unix.Ucred) {
+	switch msg.Type {
+	case "start":
+		if c.cmd != nil {
+			c.reply(rootHelperMessage{Type: "error", Error: "a module was already started on this connection"})
+			return
+		}
+		if err := c.start(msg, cred); err != nil {
+			log.Printf("Root helper: refused to start module %q for uid %d: %v", msg.Module, cred.Uid, err)
+			c.reply(rootHelperMessage{Type: "error", Error: err.Error()})
+		}
+	case "signal":
+		if err := c.signal(msg.Target, unix.Signal(msg.Signal)); err != nil {
+			c.reply(rootHelperMessage{Type: "error", Error: err.Error()})
+			return
+		}
+		c.reply(rootHelperMessage{Type: "signaled"})
+	case "terminate":
+		if c.cmd == nil {
+			c.reply(rootHelperMessage{Type: "error", Error: "no module was started"})
+			return
+		}
+		survivors := terminateProcessTree("root-"+strconv.Itoa(c.cmd.Process.Pid), c.cmd.Process.Pid)
+		c.reply(rootHelperMessage{Type: "terminated", Survivors: survivors})
+	default:
+		c.reply(rootHelperMessage{Type: "error", Error: fmt.Sprintf("unknown request %q", msg.Type)})
+	}
+}
+
+// start validates a start request against the module registry and runs the
+// module in a new PTY
+func (c *rootHelperConn) start(msg *rootHelperMessage, cred *unix.Ucred) error {
+	if msg.Language != "en" && msg.Language != "de" {
+		return fmt.Errorf("unsupported language %q", msg.Language)
+	}
+	if msg.Term != normalizeTerminalType(msg.Term) {
+		return fmt.Errorf("unsupported terminal type %q", msg.Term)
+	}
+	if rows, cols := normalizeTerminalSize(int(msg.Rows), int(msg.Cols)); rows != msg.Rows || cols != msg.Cols {
+		return fmt.Errorf("invalid terminal size %dx%d", msg.Cols, msg.Rows)
+	}
+	if !transcriptIDPattern.MatchString(msg.LockID) {
+		return fmt.Errorf("invalid lock id %q", msg.LockID)
+	}
+	var limits ResourceLimits
+	if msg.Limits != nil {
+		if err := msg.Limits.validate(); err != nil {
+			return err
+		}
+		limits = *msg.Limits
+	}
+
+	// The registry is read again for every request: the GUI could have been
+	// compromised, so its view of which modules need root is not trusted
+	if err := checkRootModuleFiles(); err != nil {
+		return err
+	}
+	registry, err := loadRegistry(lhRootDir)
+	if err != nil {
+		return fmt.Errorf("could not load module registry: %v", err)
+	}
+	module := findModuleByID(registry.Modules, msg.Module)
+	if module == nil {
+		return fmt.Errorf("module %q not found in registry", msg.Module)
+	}
+	if !module.RequiresRoot {
+		return fmt.Errorf("module %q does not require root", msg.Module)
+	}
+
+	scriptPath, err := rootModuleScript(module.Entry)
+	if err != nil {
+		return err
+	}
+
+	cmd := moduleCommand(scriptPath, module.Environment, msg.Language, msg.Term, msg.Rows, msg.Cols, msg.LockID)
+	resources := newSessionResources(msg.LockID, limits)
+	resources.prepare(cmd)
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: msg.Rows, Cols: msg.Cols})
+	if err != nil {
+		resources.release()
+		return fmt.Errorf("could not start module: %v", err)
+	}
+	defer ptmx.Close()
+	resources.started(cmd.Process.Pid)
+
+	// Hand the PTY master over together with the reply
+	line, err := json.Marshal(rootHelperMessage{Type: "started", PID: cmd.Process.Pid, Resources: &resources.info})
+	if err == nil {
+		err = c.sendWithFile(append(line, '\n'), ptmx)
+	}
+	if err != nil {
+		// Without its terminal the module is of no use
+		terminateProcessTree("root-"+strconv.Itoa(cmd.Process.Pid), cmd.Process.Pid)
+		_ = cmd.Wait()
+		resources.release()
+		return fmt.Errorf("could not pass the terminal: %v", err)
+	}
+
+	c.cmd = cmd
+	c.done = make(chan struct{})
+	log.Printf("Root helper: started module %s (pid %d) for uid %d", msg.Module, cmd.Process.Pid, cred.Uid)
+
+	go func() {
+		waitErr := cmd.Wait()
+		exit := rootHelperMessage{Type: "exit"}
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+			raw := uint32(status)
+			exit.Status = &raw
+		} else if waitErr != nil {
+			exit.Error = waitErr.Error()
+		}
+		log.Printf("Root helper: module %s (pid %d) exited: %v", msg.Module, cmd.Process.Pid, waitErr)
+		resources.release()
+		close(c.done)
+		c.reply(exit)
+	}()
+	return nil
+}
+
+// sendWithFile writes line and passes file along with it
+func (c *rootHelperConn) sendWithFile(line []byte, file *os.File) error {
+	// Use the raw descriptor without Fd(), which would switch the file to blocking mode
+	raw, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	var sendErr error
+	if err := raw.Control(func(fd uintptr) {
+		_, _, sendErr = c.conn.WriteMsgUnix(line, unix.UnixRights(int(fd)), nil)
+	}); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// signal delivers a signal to a process or process group of the module
+func (c *rootHelperConn) signal(target int, sig unix.Signal) error {
+	if c.cmd == nil {
+		return fmt.Errorf("no module was started")
+	}
+	if !rootHelperSignals[sig] {
+		return fmt.Errorf("signal %d is not allowed", int(sig))
+	}
+
+	allowed := false
+	for _, info := range sessionProcesses(c.cmd.Process.Pid) {
+		if (target > 0 && info.PID == target) || (target < 0 && info.PGID == -target) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("target %d does not belong to the module", target)
+	}
+
+	if err := unix.Kill(target, sig); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *rootHelperConn) reply(msg rootHelperMessage) {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Root helper: could not encode %s reply: %v", msg.Type, err)
+		return
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if _, err := c.conn.Write(append(line, '\n')); err != nil && !errors.Is(err, syscall.EPIPE) {
+		log.Printf("Root helper: could not send %s reply: %v", msg.Type, err)
+	}
+}
+
+// rootTrustedPaths are read or sourced as root besides the module script: the
+// shared libraries, the registry cache and its helper, the configuration with
+// all fragments and the translations. The GUI writes the configuration through
+// /api/config, so it has to stay root-owned for the helper to start modules.
+var rootTrustedPaths = []string{
+	"lib",
+	"config",
+	"lang",
+	filepath.Join("mods", "lang"),
+	"cache",
+	filepath.Join("scripts", "registry_cache_helper.sh"),
+}
+
+// checkRootModuleFiles fails unless the project root and everything below
+// rootTrustedPaths is owned by root and not writable by group or others.
+// Missing paths are skipped: only root can create them in the project root.
+func checkRootModuleFiles() error {
+	if err := checkRootOwned(lhRootDir); err != nil {
+		return err
+	}
+	visited := make(map[string]bool)
+	for _, path := range rootTrustedPaths {
+		path = filepath.Join(lhRootDir, path)
+		if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := checkRootOwnedTree(path, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRootOwnedTree runs checkRootOwned on root and every file and directory
+// below it, following symbolic links
+func checkRootOwnedTree(root string, visited map[string]bool) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not check %s: %v", path, err)
+		}
+		if err := checkRootOwned(path); err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		// The link itself can only be replaced through its directory, which is
+		// checked; a linked directory is walked on its own
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return fmt.Errorf("could not check %s: %v", path, err)
+		}
+		if info, err := os.Stat(target); err != nil || !info.IsDir() || visited[target] {
+			return err
+		}
+		visited[target] = true
+		return checkRootOwnedTree(target, visited)
+	})
+}
+
+// rootModuleScript resolves the entry of a registry module for the helper. The
+// script and the directories above it run as root, so none of them may be
+// writable by anyone but root.
+func rootModuleScript(entry string) (string, error) {
+	clean := filepath.Clean(entry)
+	if entry == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid module entry %q", entry)
+	}
+	scriptPath := filepath.Join(lhRootDir, clean)
+
+	for path := scriptPath; ; path = filepath.Dir(path) {
+		if err := checkRootOwned(path); err != nil {
+			return "", err
+		}
+		if path == lhRootDir || path == filepath.Dir(path) {
+			break
+		}
+	}
+	return scriptPath, nil
+}
+
+// checkRootOwned fails if path is not owned by root or writable by group or others
+func checkRootOwned(path string) error {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return fmt.Errorf("could not check %s: %v", path, err)
+	}
+	if stat.Uid != 0 {
+		return fmt.Errorf("%s is not owned by root", path)
+	}
+	if stat.Mode&0o022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	return nil
+}
+
+// readRootHelperMessage reads one JSON line
+func readRootHelperMessage(reader *bufio.Reader, msg *rootHelperMessage) error {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return err
+		}
+		line = append(line, chunk...)
+		if len(line) > rootHelperMaxMessage {
+			return fmt.Errorf("message too long")
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	if err := json.Unmarshal(line, msg); err != nil {
+		return fmt.Errorf("malformed message: %v", err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// GUI side
+
+// rootHelperClient is the connection of one privileged session to the helper
+type rootHelperClient struct {
+	conn *net.UnixConn
+	pid  int // Session leader, running as root
+
+	resources *SessionResources // Limits applied by the helper
+
+	requestMutex sync.Mutex
+	replies      chan rootHelperMessage
+
+	exited  chan struct{} // Closed when the helper reports the exit
+	status  *syscall.WaitStatus
+	exitErr error
+
+	closed chan struct{} // Closed when the connection is gone
+}
+
+// startPrivilegedModule asks the root helper to start a module and returns
+// the connection and the PTY master of the module
+func startPrivilegedModule(request rootHelperMessage) (*rootHelperClient, *os.File, error) {
+	dialer := net.Dialer{Timeout: rootHelperDialTimeout}
+	netConn, err := dialer.Dial("unix", rootHelperSocket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("root helper is not reachable at %s: %v", rootHelperSocket, err)
+	}
+	conn := netConn.(*net.UnixConn)
+
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("could not verify the root helper: %v", err)
+	}
+	if cred.Uid != 0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("socket %s is not served by root (uid %d)", rootHelperSocket, cred.Uid)
+	}
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(rootHelperStartTimeout))
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("could not send start request: %v", err)
+	}
+
+	// The reply carries the PTY; read until the first line is complete and keep
+	// whatever arrived after it for the message reader
+	var received []byte
+	var fds []int
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+	for !bytes.Contains(received, []byte{'\n'}) {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if oobn > 0 {
+			fds = append(fds, parseUnixRights(oob[:oobn])...)
+		}
+		received = append(received, buf[:n]...)
+		if err != nil {
+			closeFDs(fds)
+			conn.Close()
+			return nil, nil, fmt.Errorf("no reply from root helper: %v", err)
+		}
+		if len(received) > rootHelperMaxMessage {
+			closeFDs(fds)
+			conn.Close()
+			return nil, nil, fmt.Errorf("reply from root helper is too long")
+		}
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	end := bytes.IndexByte(received, '\n')
+	var reply rootHelperMessage
+	if err := json.Unmarshal(received[:end], &reply); err != nil {
+		closeFDs(fds)
+		conn.Close()
+		return nil, nil, fmt.Errorf("malformed reply from root helper: %v", err)
+	}
+	if reply.Type != "started" || len(fds) != 1 {
+		closeFDs(fds)
+		conn.Close()
+		if reply.Error != "" {
+			return nil, nil, errors.New(reply.Error)
+		}
+		return nil, nil, fmt.Errorf("unexpected reply %q from root helper", reply.Type)
+	}
+
+	// Let the runtime poller handle the PTY like one opened by pty.Start
+	if err := unix.SetNonblock(fds[0], true); err != nil {
+		closeFDs(fds)
+		conn.Close()
+		return nil, nil, err
+	}
+	ptmx := os.NewFile(uintptr(fds[0]), "/dev/ptmx")
+
+	client := &rootHelperClient{
+		conn:      conn,
+		pid:       reply.PID,
+		resources: reply.Resources,
+		replies:   make(chan rootHelperMessage, 1),
+		exited:    make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	go client.readMessages(bufio.NewReader(io.MultiReader(bytes.NewReader(received[end+1:]), conn)))
+	return client, ptmx, nil
+}
+
+func (c *rootHelperClient) readMessages(reader *bufio.Reader) {
+	defer close(c.closed)
+	for {
+		var msg rootHelperMessage
+		if err := readRootHelperMessage(reader, &msg); err != nil {
+			select {
+			case <-c.exited:
+			default:
+				c.exitErr = fmt.Errorf("lost connection to root helper: %v", err)
+				close(c.exited)
+			}
+			return
+		}
+
+		if msg.Type == "exit" {
+			if msg.Status != nil {
+				status := syscall.WaitStatus(*msg.Status)
+				c.status = &status
+			} else if msg.Error != "" {
+				c.exitErr = errors.New(msg.Error)
+			}
+			close(c.exited)
+			continue
+		}
+
+		select {
+		case c.replies <- msg:
+		default:
+			log.Printf("Discarding unexpected %s message from root helper", msg.Type)
+		}
+	}
+}
+
+// wait waits until the helper reports that the module has exited
+func (c *rootHelperClient) wait() (*syscall.WaitStatus, error) {
+	<-c.exited
+	return c.status, c.exitErr
+}
+
+// request sends msg and waits for the reply of type want
+func (c *rootHelperClient) request(msg rootHelperMessage, want string) (rootHelperMessage, error) {
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+
+	// Drop a reply that arrived after its request had timed out
+	select {
+	case <-c.replies:
+	default:
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return rootHelperMessage{}, err
+	}
+	if _, err := c.conn.Write(append(line, '\n')); err != nil {
+		return rootHelperMessage{}, err
+	}
+
+	select {
+	case reply := <-c.replies:
+		if reply.Type == "error" {
+			return reply, errors.New(reply.Error)
+		}
+		if reply.Type != want {
+			return reply, fmt.Errorf("unexpected reply %q from root helper", reply.Type)
+		}
+		return reply, nil
+	case <-c.closed:
+		return rootHelperMessage{}, fmt.Errorf("root helper connection closed")
+	case <-time.After(rootHelperRequestTimeout):
+		return rootHelperMessage{}, fmt.Errorf("root helper did not answer")
+	}
+}
+
+// signal asks the helper to signal a process or, if target is negative, a
+// process group of the module
+func (c *rootHelperClient) signal(target int, sig unix.Signal) error {
+	_, err := c.request(rootHelperMessage{Type: "signal", Target: target, Signal: int(sig)}, "signaled")
+	return err
+}
+
+// terminate asks the helper to stop every process of the module
+func (c *rootHelperClient) terminate() ([]*ProcessInfo, error) {
+	reply, err := c.request(rootHelperMessage{Type: "terminate"}, "terminated")
+	return reply.Survivors, err
+}
+
+// Close ends the connection once a pending request is answered; a module that
+// is still running is terminated by the helper
+func (c *rootHelperClient) Close() {
+	if c == nil {
+		return
+	}
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+	c.conn.Close()
+}
+
+// parseUnixRights extracts the file descriptors of SCM_RIGHTS messages
+func parseUnixRights(oob []byte) []int {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	var fds []int
+	for _, message := range messages {
+		if rights, err := unix.ParseUnixRights(&message); err == nil {
+			fds = append(fds, rights...)
+		}
+	}
+	return fds
+}
+
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
@@ -0,0 +1,959 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Schedules start registry modules as scripted runs (see session_script.go)
+// at the times of a cron expression. Every schedule is a JSON fragment in
+// config/schedules.d; its runs are recorded in logs/schedule_history.jsonl.
+
+const (
+	scheduleCheckInterval = time.Second
+
+	// A run that is due for longer than this was missed, e.g. because the
+	// server was down or the machine was asleep
+	scheduleMissedGrace = 2 * time.Minute
+	maxMissedRunCount   = 10000
+
+	maxScheduleHistoryEntries = 5000
+	maxScheduleNameLength     = 100
+
+	// scheduleUser is recorded as the user of scheduled sessions
+	scheduleUser = "scheduler"
+)
+
+// How runs missed while the server was down are handled
+const (
+	missedRunsSkip    = "skip"     // Record them as missed and wait for the next run
+	missedRunsRunOnce = "run_once" // Run once right away for all of them
+)
+
+// Schedule run states and triggers
+const (
+	scheduleRunRunning     = "running"
+	scheduleRunSucceeded   = "succeeded"
+	scheduleRunFailed      = "failed"
+	scheduleRunSkipped     = "skipped"     // The previous run was still going
+	scheduleRunMissed      = "missed"      // Due while the server was down
+	scheduleRunInterrupted = "interrupted" // The server went away during the run
+
+	scheduleTriggerCron    = "schedule"
+	scheduleTriggerCatchUp = "catch_up"
+	scheduleTriggerManual  = "manual"
+)
+
+// Schedule starts a module with predefined answers at the times of Cron.
+// Answers come either from Steps or from a stored macro.
+type Schedule struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name"`
+	Description    string       `json:"description,omitempty"`
+	Module         string       `json:"module"`
+	Cron           string       `json:"cron"`
+	Enabled        bool         `json:"enabled"`
+	Language       string       `json:"language,omitempty"`
+	Macro          string       `json:"macro,omitempty"`
+	Steps          []ScriptStep `json:"steps,omitempty"`
+	TimeoutSeconds int          `json:"timeout_seconds,omitempty"`
+	Finish         string       `json:"finish,omitempty"`
+	MissedRuns     string       `json:"missed_runs"` // skip or run_once
+	CreatedBy      string       `json:"created_by,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Errors of schedule lookups on behalf of a user; the messages are sent to
+// clients as they are
+var (
+	errScheduleNotFound  = errors.New("Schedule not found")
+	errScheduleForbidden = errors.New("Access to schedule denied")
+)
+
+// ScheduleRequest is the body of POST /api/schedules and PUT /api/schedules/:id
+type ScheduleRequest struct {
+	Name           string       `json:"name"`
+	Description    string       `json:"description,omitempty"`
+	Module         string       `json:"module"`
+	Cron           string       `json:"cron"`
+	Enabled        *bool        `json:"enabled,omitempty"` // Defaults to true, kept on update
+	Language       string       `json:"language,omitempty"`
+	Macro          string       `json:"macro,omitempty"`
+	Steps          []ScriptStep `json:"steps,omitempty"`
+	TimeoutSeconds int          `json:"timeout_seconds,omitempty"`
+	Finish         string       `json:"finish,omitempty"`
+	MissedRuns     string       `json:"missed_runs,omitempty"`
+}
+
+// ScheduleRun records one run, or one skipped or missed run, of a schedule
+type ScheduleRun struct {
+	RunID        string     `json:"run_id"`
+	ScheduleID   string     `json:"schedule_id"`
+	Module       string     `json:"module"`
+	Trigger      string     `json:"trigger"` // schedule, catch_up or manual
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	State        string     `json:"state"`
+	Reason       string     `json:"reason,omitempty"` // Failure reason of the scripted run
+	Message      string     `json:"message,omitempty"`
+	SessionID    string     `json:"session_id,omitempty"`
+	MissedRuns   int        `json:"missed_runs,omitempty"` // Runs that were due while the server was down
+}
+
+// ScheduleInfo is a schedule with its run state, as returned by the API
+type ScheduleInfo struct {
+	Schedule
+	NextRun *time.Time   `json:"next_run,omitempty"`
+	Running *ScheduleRun `json:"running,omitempty"`
+	LastRun *ScheduleRun `json:"last_run,omitempty"`
+}
+
+// ScheduleHistory keeps the runs of all schedules like SessionHistory keeps
+// sessions: a run is appended when it starts and again when it ends.
+type ScheduleHistory struct {
+	mutex   sync.Mutex
+	path    string
+	entries []*ScheduleRun // Oldest first
+	index   map[string]*ScheduleRun
+}
+
+var scheduleHistory = &ScheduleHistory{index: make(map[string]*ScheduleRun)}
+
+func scheduleHistoryPath() string {
+	return filepath.Join(lhRootDir, "logs", "schedule_history.jsonl")
+}
+
+// Load reads the history file; runs that were going when the previous server
+// process ended are marked as interrupted
+func (h *ScheduleHistory) Load(path string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.path = path
+	h.entries = nil
+	h.index = make(map[string]*ScheduleRun)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var run ScheduleRun
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil || run.RunID == "" {
+			continue
+		}
+		h.put(&run)
+	}
+	scanErr := scanner.Err()
+	file.Close()
+	if scanErr != nil {
+		return scanErr
+	}
+
+	if len(h.entries) == 0 {
+		return nil
+	}
+
+	for _, run := range h.entries {
+		if run.State == scheduleRunRunning {
+			run.State = scheduleRunInterrupted
+		}
+	}
+	return h.rewrite()
+}
+
+// put inserts or replaces a run; the mutex must be held
+func (h *ScheduleHistory) put(run *ScheduleRun) {
+	if existing, ok := h.index[run.RunID]; ok {
+		*existing = *run
+		return
+	}
+	h.entries = append(h.entries, run)
+	h.index[run.RunID] = run
+
+	if len(h.entries) > maxScheduleHistoryEntries {
+		for _, dropped := range h.entries[:len(h.entries)-maxScheduleHistoryEntries] {
+			delete(h.index, dropped.RunID)
+		}
+		h.entries = append([]*ScheduleRun(nil), h.entries[len(h.entries)-maxScheduleHistoryEntries:]...)
+	}
+}
+
+// rewrite replaces the history file with the current entries; the mutex must be held
+func (h *ScheduleHistory) rewrite() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o750); err != nil {
+		return err
+	}
+
+	var content strings.Builder
+	for _, run := range h.entries {
+		line, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+
+	tmpPath := h.path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content.String()), 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, h.path)
+}
+
+// record stores run in memory and appends it to the history file
+func (h *ScheduleHistory) record(run ScheduleRun) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stored := run
+	h.put(&stored)
+
+	if h.path == "" {
+		return
+	}
+
+	line, err := json.Marshal(&stored)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o750); err != nil {
+		log.Printf("Warning: could not create schedule history directory: %v", err)
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		log.Printf("Warning: could not open schedule history: %v", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(line); err != nil {
+		log.Printf("Warning: could not write schedule history: %v", err)
+	}
+}
+
+// Query returns the runs of a schedule, newest first, and their total number
+func (h *ScheduleHistory) Query(scheduleId string, offset, limit int) ([]ScheduleRun, int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	page := make([]ScheduleRun, 0, limit)
+	total := 0
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		run := h.entries[i]
+		if run.ScheduleID != scheduleId {
+			continue
+		}
+		if total >= offset && len(page) < limit {
+			page = append(page, *run)
+		}
+		total++
+	}
+	return page, total
+}
+
+// latest returns the newest run of a schedule that is not running
+func (h *ScheduleHistory) latest(scheduleId string) *ScheduleRun {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if run := h.entries[i]; run.ScheduleID == scheduleId && run.State != scheduleRunRunning {
+			latest := *run
+			return &latest
+		}
+	}
+	return nil
+}
+
+// lastScheduledFor returns the latest time a run of the schedule was due
+func (h *ScheduleHistory) lastScheduledFor(scheduleId string) time.Time {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var last time.Time
+	for _, run := range h.entries {
+		if run.ScheduleID == scheduleId && run.Trigger != scheduleTriggerManual && run.ScheduledFor.After(last) {
+			last = run.ScheduledFor
+		}
+	}
+	return last
+}
+
+// scheduledJob is a loaded schedule with its next run
+type scheduledJob struct {
+	schedule Schedule
+	cron     *cronSchedule
+	next     time.Time    // Zero while disabled
+	running  *ScheduleRun // The run in progress, if any
+}
+
+// Scheduler starts the runs of all schedules
+type Scheduler struct {
+	mutex sync.Mutex
+	jobs  map[string]*scheduledJob
+}
+
+var scheduler = &Scheduler{jobs: make(map[string]*scheduledJob)}
+
+func scheduleDir() string {
+	return filepath.Join(lhRootDir, "config", "schedules.d")
+}
+
+func schedulePath(scheduleId string) (string, bool) {
+	if !macroIDPattern.MatchString(scheduleId) {
+		return "", false
+	}
+	return filepath.Join(scheduleDir(), scheduleId+".json"), true
+}
+
+// writeSchedule stores a schedule; the scheduler mutex must be held
+func writeSchedule(schedule Schedule) error {
+	path, ok := schedulePath(schedule.ID)
+	if !ok {
+		return fmt.Errorf("invalid schedule ID: %s", schedule.ID)
+	}
+	if err := os.MkdirAll(scheduleDir(), 0o755); err != nil {
+		return fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write schedule: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write schedule: %w", err)
+	}
+	return nil
+}
+
+// Load reads all schedules. Runs that became due while the server was down
+// are handled by the first check according to the missed_runs setting.
+func (s *Scheduler) Load() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.jobs = make(map[string]*scheduledJob)
+
+	entries, err := os.ReadDir(scheduleDir())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: could not read schedules: %v", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		scheduleId := strings.TrimSuffix(name, ".json")
+		path, ok := schedulePath(scheduleId)
+		if !ok {
+			log.Printf("Warning: skipping schedule %s: invalid file name", name)
+			continue
+		}
+
+		var schedule Schedule
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &schedule)
+		}
+		if err != nil {
+			log.Printf("Warning: skipping schedule %s: %v", name, err)
+			continue
+		}
+		schedule.ID = scheduleId
+
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			log.Printf("Warning: skipping schedule %s: %v", name, err)
+			continue
+		}
+
+		job := &scheduledJob{schedule: schedule, cron: cron}
+		if schedule.Enabled {
+			// Continue from the last run, or from the last change if that is later
+			base := scheduleHistory.lastScheduledFor(scheduleId)
+			if schedule.UpdatedAt.After(base) {
+				base = schedule.UpdatedAt
+			}
+			job.next = cron.Next(base)
+		}
+		s.jobs[scheduleId] = job
+	}
+
+	if len(s.jobs) > 0 {
+		log.Printf("Loaded %d schedules", len(s.jobs))
+	}
+}
+
+// Run checks the schedules until the server exits
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.check(now)
+	}
+}
+
+// check starts the runs that are due
+func (s *Scheduler) check(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, job := range s.jobs {
+		if job.next.IsZero() || now.Before(job.next) {
+			continue
+		}
+
+		due := job.next
+		job.next = job.cron.Next(now)
+
+		if now.Sub(due) <= scheduleMissedGrace {
+			s.start(job, due, scheduleTriggerCron, 0)
+			continue
+		}
+
+		// The run is overdue: count the runs that were due in the meantime
+		missed, last := 0, due
+		for t := due; !t.IsZero() && !t.After(now) && missed < maxMissedRunCount; t = job.cron.Next(t) {
+			missed++
+			last = t
+		}
+
+		if now.Sub(last) <= scheduleMissedGrace {
+			// The most recent run is still on time
+			missed--
+			s.recordMissed(job, due, missed)
+			s.start(job, last, scheduleTriggerCron, 0)
+		} else if job.schedule.MissedRuns == missedRunsRunOnce {
+			s.start(job, last, scheduleTriggerCatchUp, missed)
+		} else {
+			s.recordMissed(job, due, missed)
+		}
+	}
+}
+
+// recordMissed adds an entry for runs that were not started; the mutex must be held
+func (s *Scheduler) recordMissed(job *scheduledJob, first time.Time, count int) {
+	if count <= 0 {
+		return
+	}
+	log.Printf("Schedule %s missed %d runs since %s", job.schedule.ID, count, first.Format(time.RFC3339))
+	scheduleHistory.record(ScheduleRun{
+		RunID:        fmt.Sprintf("%s_%d", job.schedule.ID, time.Now().UnixNano()),
+		ScheduleID:   job.schedule.ID,
+		Module:       job.schedule.Module,
+		Trigger:      scheduleTriggerCron,
+		ScheduledFor: first,
+		State:        scheduleRunMissed,
+		Message:      fmt.Sprintf("%d runs were due while the server was not running", count),
+		MissedRuns:   count,
+	})
+}
+
+// start begins a run of job in the background unless the previous one is still
+// going; the mutex must be held
+func (s *Scheduler) start(job *scheduledJob, scheduledFor time.Time, trigger string, missed int) ScheduleRun {
+	run := &ScheduleRun{
+		RunID:        fmt.Sprintf("%s_%d", job.schedule.ID, time.Now().UnixNano()),
+		ScheduleID:   job.schedule.ID,
+		Module:       job.schedule.Module,
+		Trigger:      trigger,
+		ScheduledFor: scheduledFor,
+		MissedRuns:   missed,
+	}
+
+	if job.running != nil {
+		run.State = scheduleRunSkipped
+		run.Message = fmt.Sprintf("the previous run in session %s is still running", job.running.SessionID)
+		if trigger != scheduleTriggerManual {
+			log.Printf("Schedule %s: skipping run, %s", job.schedule.ID, run.Message)
+			scheduleHistory.record(*run)
+		}
+		return *run
+	}
+
+	startedAt := time.Now()
+	run.StartedAt = &startedAt
+	run.State = scheduleRunRunning
+	job.running = run
+
+	log.Printf("Schedule %s: starting module %s (%s)", job.schedule.ID, job.schedule.Module, trigger)
+	go s.execute(job.schedule, run)
+	return *run
+}
+
+// execute runs the module of schedule and records the outcome of run
+func (s *Scheduler) execute(schedule Schedule, run *ScheduleRun) {
+	var result ScriptRunResult
+
+	req, err := schedule.runRequest()
+	if err == nil {
+		scriptRun, startErr := startScriptRun(schedule.Module, req, scheduleUser)
+		if startErr != nil {
+			err = startErr
+		} else {
+			// The session belongs to the scheduler; the user who created the
+			// schedule may follow and control it
+			scriptRun.session.grantAccess(schedule.CreatedBy)
+			scriptRun.session.handOverControl(schedule.CreatedBy)
+
+			s.mutex.Lock()
+			run.SessionID = scriptRun.session.ID
+			started := *run
+			s.mutex.Unlock()
+			scheduleHistory.record(started)
+
+			<-scriptRun.done
+			result = scriptRun.snapshot()
+		}
+	}
+
+	endedAt := time.Now()
+
+	s.mutex.Lock()
+	run.EndedAt = &endedAt
+	if err != nil {
+		run.State = scheduleRunFailed
+		run.Message = err.Error()
+	} else if result.State == scriptStateSucceeded {
+		run.State = scheduleRunSucceeded
+	} else {
+		run.State = scheduleRunFailed
+		run.Reason = result.Reason
+		run.Message = result.Message
+	}
+	if job, exists := s.jobs[schedule.ID]; exists && job.running == run {
+		job.running = nil
+	}
+	finished := *run
+	s.mutex.Unlock()
+
+	if finished.State == scheduleRunFailed {
+		log.Printf("Schedule %s: run failed: %s", schedule.ID, finished.Message)
+	}
+	scheduleHistory.record(finished)
+}
+
+// canAccess reports whether user may see, change and run the schedule. Like
+// the record of a session, it belongs to the user who created it.
+func (sch *Schedule) canAccess(user string) bool {
+	return canAccessRecord(user, sch.CreatedBy, nil)
+}
+
+// runRequest returns the scripted run of the schedule, resolving its macro
+func (sch *Schedule) runRequest() (RunModuleRequest, error) {
+	req := RunModuleRequest{
+		StartModuleRequest: StartModuleRequest{Language: sch.Language},
+		Steps:              sch.Steps,
+		TimeoutSeconds:     sch.TimeoutSeconds,
+		Finish:             sch.Finish,
+	}
+	if sch.Macro == "" {
+		return req, nil
+	}
+
+	macro, err := loadMacro(sch.Macro)
+	if errors.Is(err, os.ErrNotExist) {
+		return req, fmt.Errorf("macro %q not found", sch.Macro)
+	}
+	if err != nil {
+		return req, fmt.Errorf("could not load macro %q: %v", sch.Macro, err)
+	}
+	if !macro.canAccess(sch.CreatedBy) {
+		return req, fmt.Errorf("access to macro %q denied", sch.Macro)
+	}
+	if macro.Module != sch.Module {
+		return req, fmt.Errorf("macro %q belongs to module %s", sch.Macro, macro.Module)
+	}
+
+	// Schedules cannot store the answers of password prompts
+	if req.Steps, err = macro.scriptSteps(nil); err != nil {
+		return req, fmt.Errorf("macro %q cannot be scheduled: %v", sch.Macro, err)
+	}
+	if req.TimeoutSeconds == 0 {
+		req.TimeoutSeconds = macro.TimeoutSeconds
+	}
+	if req.Finish == "" {
+		req.Finish = macro.Finish
+	}
+	if req.Language == "" {
+		req.Language = macro.Language
+	}
+	return req, nil
+}
+
+// validate checks a schedule and fills in defaults
+func (sch *Schedule) validate() error {
+	sch.Name = strings.TrimSpace(sch.Name)
+	if sch.Name == "" || len(sch.Name) > maxScheduleNameLength || strings.ContainsAny(sch.Name, "\r\n") {
+		return fmt.Errorf("name must be a single line of 1 to %d characters", maxScheduleNameLength)
+	}
+
+	appState.mutex.RLock()
+	registry := appState.registry
+	appState.mutex.RUnlock()
+	if registry == nil || findModuleByID(registry.Modules, sch.Module) == nil {
+		return fmt.Errorf("module %q not found in registry", sch.Module)
+	}
+
+	cron, err := parseCron(sch.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression: %v", err)
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return fmt.Errorf("cron expression %q never matches", sch.Cron)
+	}
+
+	switch {
+	case sch.Macro != "" && len(sch.Steps) > 0:
+		return fmt.Errorf("use either macro or steps, not both")
+	case sch.Macro == "" && len(sch.Steps) == 0:
+		return fmt.Errorf("steps or macro is required")
+	}
+
+	// Checks the steps, or loads the macro and checks it belongs to the module
+	req, err := sch.runRequest()
+	if err != nil {
+		return err
+	}
+	if _, err := compileScript(req); err != nil {
+		return err
+	}
+	if sch.Finish != "" {
+		if _, err := scriptFinish(sch.Finish); err != nil {
+			return err
+		}
+	}
+
+	switch sch.MissedRuns {
+	case "":
+		sch.MissedRuns = missedRunsSkip
+	case missedRunsSkip, missedRunsRunOnce:
+	default:
+		return fmt.Errorf("missed_runs must be %q or %q", missedRunsSkip, missedRunsRunOnce)
+	}
+	return nil
+}
+
+func (sch *Schedule) apply(req ScheduleRequest) {
+	sch.Name = req.Name
+	sch.Description = req.Description
+	sch.Module = req.Module
+	sch.Cron = req.Cron
+	if req.Enabled != nil {
+		sch.Enabled = *req.Enabled
+	}
+	sch.Language = req.Language
+	sch.Macro = req.Macro
+	sch.Steps = req.Steps
+	sch.TimeoutSeconds = req.TimeoutSeconds
+	sch.Finish = req.Finish
+	sch.MissedRuns = req.MissedRuns
+}
+
+// info returns the schedule with its run state; the mutex must be held
+func (job *scheduledJob) info() ScheduleInfo {
+	info := ScheduleInfo{Schedule: job.schedule, LastRun: scheduleHistory.latest(job.schedule.ID)}
+	if !job.next.IsZero() {
+		next := job.next
+		info.NextRun = &next
+	}
+	if job.running != nil {
+		running := *job.running
+		info.Running = &running
+	}
+	return info
+}
+
+// store writes schedule and replaces its job; the mutex must be held. The next
+// run is computed from now, so runs due before a change are not caught up.
+func (s *Scheduler) store(schedule Schedule) (ScheduleInfo, error) {
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return ScheduleInfo{}, err
+	}
+	if err := writeSchedule(schedule); err != nil {
+		return ScheduleInfo{}, err
+	}
+
+	job, exists := s.jobs[schedule.ID]
+	if !exists {
+		job = &scheduledJob{}
+		s.jobs[schedule.ID] = job
+	}
+	job.schedule = schedule
+	job.cron = cron
+	job.next = time.Time{}
+	if schedule.Enabled {
+		job.next = cron.Next(time.Now())
+	}
+	return job.info(), nil
+}
+
+// lookupJob returns the job of a schedule if user may access it; the mutex
+// must be held
+func (s *Scheduler) lookupJob(scheduleId, user string) (*scheduledJob, error) {
+	job, exists := s.jobs[scheduleId]
+	if !exists {
+		return nil, errScheduleNotFound
+	}
+	if !job.schedule.canAccess(user) {
+		return nil, errScheduleForbidden
+	}
+	return job, nil
+}
+
+// scheduleErrorResponse answers a failed lookupJob
+func scheduleErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errScheduleForbidden) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+}
+
+// getSchedules serves GET /api/schedules with the schedules the user may access
+func getSchedules(c *fiber.Ctx) error {
+	user := requestUser(c)
+
+	scheduler.mutex.Lock()
+	schedules := make([]ScheduleInfo, 0, len(scheduler.jobs))
+	for _, job := range scheduler.jobs {
+		if job.schedule.canAccess(user) {
+			schedules = append(schedules, job.info())
+		}
+	}
+	scheduler.mutex.Unlock()
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return strings.ToLower(schedules[i].Name) < strings.ToLower(schedules[j].Name)
+	})
+	return c.JSON(schedules)
+}
+
+// getSchedule serves GET /api/schedules/:scheduleId
+func getSchedule(c *fiber.Ctx) error {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	job, err := scheduler.lookupJob(c.Params("scheduleId"), requestUser(c))
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+	return c.JSON(job.info())
+}
+
+// createSchedule serves POST /api/schedules
+func createSchedule(c *fiber.Ctx) error {
+	var req ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule"})
+	}
+
+	now := time.Now()
+	schedule := Schedule{Enabled: true, CreatedBy: requestUser(c), CreatedAt: now, UpdatedAt: now}
+	schedule.apply(req)
+	if err := schedule.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule", "message": err.Error()})
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	id, err := uniqueStoredID(schedule.Name, "schedule", schedulePath)
+	if err == nil {
+		schedule.ID = id
+		var info ScheduleInfo
+		if info, err = scheduler.store(schedule); err == nil {
+			log.Printf("Created schedule %s (%s) for module %s", schedule.ID, schedule.Cron, schedule.Module)
+			return c.JSON(info)
+		}
+	}
+	log.Printf("Error saving schedule: %v", err)
+	return c.Status(500).JSON(fiber.Map{"error": "Failed to save schedule"})
+}
+
+// updateSchedule serves PUT /api/schedules/:scheduleId. Every field is
+// replaced; enabled is kept when omitted.
+func updateSchedule(c *fiber.Ctx) error {
+	scheduleId := c.Params("scheduleId")
+
+	var req ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule"})
+	}
+
+	scheduler.mutex.Lock()
+	job, err := scheduler.lookupJob(scheduleId, requestUser(c))
+	var schedule Schedule
+	if err == nil {
+		schedule = job.schedule
+	}
+	scheduler.mutex.Unlock()
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	schedule.apply(req)
+	if err := schedule.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule", "message": err.Error()})
+	}
+	schedule.UpdatedAt = time.Now()
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if _, exists := scheduler.jobs[scheduleId]; !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+	info, err := scheduler.store(schedule)
+	if err != nil {
+		log.Printf("Error saving schedule: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save schedule"})
+	}
+	return c.JSON(info)
+}
+
+// setScheduleEnabled serves POST /api/schedules/:scheduleId/enable and /disable
+func setScheduleEnabled(enabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+
+		job, err := scheduler.lookupJob(c.Params("scheduleId"), requestUser(c))
+		if err != nil {
+			return scheduleErrorResponse(c, err)
+		}
+
+		schedule := job.schedule
+		schedule.Enabled = enabled
+		schedule.UpdatedAt = time.Now()
+		info, err := scheduler.store(schedule)
+		if err != nil {
+			log.Printf("Error saving schedule: %v", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to save schedule"})
+		}
+		return c.JSON(info)
+	}
+}
+
+// deleteSchedule serves DELETE /api/schedules/:scheduleId. A run in progress
+// is not stopped.
+func deleteSchedule(c *fiber.Ctx) error {
+	scheduleId := c.Params("scheduleId")
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if _, err := scheduler.lookupJob(scheduleId, requestUser(c)); err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+	path, ok := schedulePath(scheduleId)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error deleting schedule: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete schedule"})
+	}
+	delete(scheduler.jobs, scheduleId)
+	return c.JSON(fiber.Map{"status": "deleted", "schedule_id": scheduleId})
+}
+
+// triggerSchedule serves POST /api/schedules/:scheduleId/run, which starts a
+// run right away, also for disabled schedules
+func triggerSchedule(c *fiber.Ctx) error {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	job, err := scheduler.lookupJob(c.Params("scheduleId"), requestUser(c))
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	run := scheduler.start(job, time.Now(), scheduleTriggerManual, 0)
+	if run.State == scheduleRunSkipped {
+		return c.Status(409).JSON(fiber.Map{"error": "Schedule is already running", "run": run})
+	}
+	return c.JSON(run)
+}
+
+// getScheduleRuns serves GET /api/schedules/:scheduleId/runs
+func getScheduleRuns(c *fiber.Ctx) error {
+	scheduleId := c.Params("scheduleId")
+
+	// Runs carry no owner; they are shown to whoever may access the schedule
+	scheduler.mutex.Lock()
+	_, err := scheduler.lookupJob(scheduleId, requestUser(c))
+	scheduler.mutex.Unlock()
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	limit := defaultHistoryPageSize
+	if raw := c.Query("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid limit parameter"})
+		}
+		limit = min(value, maxHistoryPageSize)
+	}
+
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid offset parameter"})
+		}
+		offset = value
+	}
+
+	runs, total := scheduleHistory.Query(scheduleId, offset, limit)
+	return c.JSON(fiber.Map{
+		"runs":   runs,
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+	})
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@reboot",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", at(2025, 3, 14, 10, 0).Add(30 * time.Second), at(2025, 3, 14, 10, 1)},
+		{"strictly after", "0 10 * * *", at(2025, 3, 14, 10, 0), at(2025, 3, 15, 10, 0)},
+		{"range and step", "*/15 9-17 * * mon-fri", at(2025, 3, 14, 17, 50), at(2025, 3, 17, 9, 0)},
+		{"start with step", "5/20 * * * *", at(2025, 3, 14, 10, 26), at(2025, 3, 14, 10, 45)},
+		{"list", "0 8,12,18 * * *", at(2025, 3, 14, 12, 0), at(2025, 3, 14, 18, 0)},
+		{"month names", "0 12 1 jan-mar *", at(2025, 3, 2, 0, 0), at(2026, 1, 1, 12, 0)},
+		{"7 is sunday", "0 0 * * 7", at(2025, 3, 14, 12, 0), at(2025, 3, 16, 0, 0)},
+		{"sunday range", "0 0 * * 5-7", at(2025, 3, 15, 12, 0), at(2025, 3, 16, 0, 0)},
+		{"day of week or day of month", "0 0 13 * fri", at(2025, 3, 1, 0, 0), at(2025, 3, 7, 0, 0)},
+		{"day of month or day of week", "0 0 13 * fri", at(2025, 3, 12, 0, 0), at(2025, 3, 13, 0, 0)},
+		{"day of month only", "0 0 13 * *", at(2025, 3, 1, 0, 0), at(2025, 3, 13, 0, 0)},
+		{"day of week with step", "0 0 13 * */2", at(2025, 3, 1, 0, 0), at(2025, 3, 13, 0, 0)},
+		{"leap day", "0 0 29 2 *", at(2025, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", at(2025, 3, 1, 0, 0), time.Time{}},
+		{"shortcut", "@weekly", at(2025, 3, 14, 12, 0), at(2025, 3, 16, 0, 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCron(test.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", test.expr, err)
+			}
+			if got := schedule.Next(test.from); !got.Equal(test.want) {
+				t.Errorf("Next(%s) = %s, want %s", test.from, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCronNextRepeatedHour(t *testing.T) {
+	// Daylight saving time ends on 2025-11-02 in New York: 01:00-02:00 happens twice
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	midnight := time.Date(2025, 11, 2, 0, 0, 0, 0, location)
+	firstPass := midnight.Add(90 * time.Minute) // 01:30 EDT
+	secondPass := firstPass.Add(time.Hour)      // 01:30 EST
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"fixed hour runs in the first pass", "30 1 * * *", midnight, firstPass},
+		{"fixed hour runs once", "30 1 * * *", firstPass, time.Date(2025, 11, 3, 1, 30, 0, 0, location)},
+		{"from the second pass", "45 1 * * *", secondPass.Add(-20 * time.Minute), time.Date(2025, 11, 3, 1, 45, 0, 0, location)},
+		{"hourly runs in both passes", "30 * * * *", firstPass, secondPass},
+		{"after the repeated hour", "30 2 * * *", firstPass, secondPass.Add(time.Hour)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCron(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(test.from); !got.Equal(test.want) {
+				t.Errorf("Next(%s) = %s, want %s", test.from, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerCheckMissedRuns(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 3, 14, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		missedRuns string
+		now        time.Time
+		missed     int       // Runs recorded as missed
+		started    time.Time // Run started for this time, zero if none
+		trigger    string
+		catchUp    int // Missed runs the started run catches up on
+	}{
+		{"on time", missedRunsSkip, at(9, 1), 0, at(9, 0), scheduleTriggerCron, 0},
+		{"last run on time", missedRunsSkip, at(12, 1), 3, at(12, 0), scheduleTriggerCron, 0},
+		{"last run on time with run_once", missedRunsRunOnce, at(12, 1), 3, at(12, 0), scheduleTriggerCron, 0},
+		{"skip", missedRunsSkip, at(12, 30), 4, time.Time{}, "", 0},
+		{"run_once", missedRunsRunOnce, at(12, 30), 0, at(12, 0), scheduleTriggerCatchUp, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := scheduleHistory
+			scheduleHistory = &ScheduleHistory{index: make(map[string]*ScheduleRun)}
+			defer func() { scheduleHistory = previous }()
+
+			cron, err := parseCron("0 * * * *")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A run in progress turns the started run into a recorded skip, so
+			// no module is launched
+			job := &scheduledJob{
+				schedule: Schedule{ID: "hourly", Module: "backup", MissedRuns: test.missedRuns},
+				cron:     cron,
+				next:     at(9, 0),
+				running:  &ScheduleRun{SessionID: "earlier"},
+			}
+			s := &Scheduler{jobs: map[string]*scheduledJob{"hourly": job}}
+			s.check(test.now)
+
+			if want := test.now.Truncate(time.Hour).Add(time.Hour); !job.next.Equal(want) {
+				t.Errorf("next run at %s, want %s", job.next, want)
+			}
+
+			runs, _ := scheduleHistory.Query("hourly", 0, 10)
+			missed, started := 0, 0
+			for _, run := range runs {
+				switch run.State {
+				case scheduleRunMissed:
+					missed += run.MissedRuns
+					if !run.ScheduledFor.Equal(at(9, 0)) {
+						t.Errorf("missed runs recorded from %s, want from 09:00", run.ScheduledFor)
+					}
+				case scheduleRunSkipped:
+					started++
+					if !run.ScheduledFor.Equal(test.started) || run.Trigger != test.trigger || run.MissedRuns != test.catchUp {
+						t.Errorf("started %s run for %s catching up %d, want %s for %s catching up %d",
+							run.Trigger, run.ScheduledFor, run.MissedRuns, test.trigger, test.started, test.catchUp)
+					}
+				default:
+					t.Errorf("unexpected %s run", run.State)
+				}
+			}
+			if missed != test.missed {
+				t.Errorf("%d runs recorded as missed, want %d", missed, test.missed)
+			}
+			if wantStarted := !test.started.IsZero(); (started == 1) != wantStarted || started > 1 {
+				t.Errorf("%d runs started, want %v", started, wantStarted)
+			}
+		})
+	}
+}
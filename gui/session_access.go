@@ -0,0 +1,498 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+// Errors of session lookups on behalf of a user; the messages are sent to
+// clients as they are
+var (
+	errSessionNotFound  = errors.New("Session not found")
+	errSessionForbidden = errors.New("Access to session denied")
+)
+
+// newSessionID returns a random, unguessable session ID
+func newSessionID() string {
+	return uuid.NewString()
+}
+
+// canAccess reports whether user may follow and control the session: its
+// owner and users the owner granted access. Without authentication every
+// client is the same local user.
+func (s *ModuleSession) canAccess(user string) bool {
+	if currentAuthSettings.Mode == authModeNone {
+		return true
+	}
+
+	s.accessMutex.Lock()
+	defer s.accessMutex.Unlock()
+	return user == s.User || s.grants[user]
+}
+
+// isOwner reports whether user started the session
+func (s *ModuleSession) isOwner(user string) bool {
+	return currentAuthSettings.Mode == authModeNone || user == s.User
+}
+
+// grantAccess lets user follow and control the session
+func (s *ModuleSession) grantAccess(user string) {
+	if user == "" || user == s.User {
+		return
+	}
+
+	s.accessMutex.Lock()
+	defer s.accessMutex.Unlock()
+	if s.grants == nil {
+		s.grants = make(map[string]bool)
+	}
+	s.grants[user] = true
+}
+
+// revokeAccess withdraws a grant; it reports whether the user had one.
+// Control returns to the owner if the user held it.
+func (s *ModuleSession) revokeAccess(user string) bool {
+	s.accessMutex.Lock()
+	if !s.grants[user] {
+		s.accessMutex.Unlock()
+		return false
+	}
+	delete(s.grants, user)
+	hadControl := s.controlUser == user
+	if hadControl {
+		s.controlUser = ""
+	}
+	s.accessMutex.Unlock()
+
+	if hadControl {
+		s.Stream.PublishState(stateSlotControl, "control", SessionControl{Controller: s.User})
+	}
+	return true
+}
+
+// sharedWith returns the users granted access, sorted
+func (s *ModuleSession) sharedWith() []string {
+	s.accessMutex.Lock()
+	defer s.accessMutex.Unlock()
+
+	users := make([]string, 0, len(s.grants))
+	for user := range s.grants {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// canAccessRecord applies the rule of canAccess to the history or transcript
+// of a session that has ended: its owner and the users who had access when it
+// ended. Records from before sessions had owners are only shown without
+// authentication.
+func canAccessRecord(user, owner string, sharedWith []string) bool {
+	if currentAuthSettings.Mode == authModeNone {
+		return true
+	}
+	return owner != "" && (user == owner || slices.Contains(sharedWith, user))
+}
+
+// lookupSessionForUser returns the session if user may access it
+func (sm *SessionManager) lookupSessionForUser(sessionId, user string) (*ModuleSession, error) {
+	session, exists := sm.lookupSession(sessionId)
+	if !exists {
+		return nil, errSessionNotFound
+	}
+	if !session.canAccess(user) {
+		return nil, errSessionForbidden
+	}
+	return session, nil
+}
+
+// sessionErrorResponse answers a failed lookupSessionForUser
+func sessionErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errSessionForbidden) || errors.Is(err, errSessionObserver) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+}
+
+// SessionAccess lists who may access a session
+type SessionAccess struct {
+	Owner      string   `json:"owner"`
+	Controller string   `json:"controller"` // Holds the input rights
+	Users      []string `json:"users"`      // Granted by the owner
+}
+
+// SessionAccessRequest is the body of POST /api/sessions/:sessionId/access
+type SessionAccessRequest struct {
+	User string `json:"user"`
+}
+
+// getSessionAccess serves GET /api/sessions/:sessionId/access
+func getSessionAccess(c *fiber.Ctx) error {
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), requestUser(c))
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	return c.JSON(session.access())
+}
+
+// grantSessionAccess serves POST /api/sessions/:sessionId/access. Only the
+// owner can grant access.
+func grantSessionAccess(c *fiber.Ctx) error {
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), user)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	if !session.isOwner(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner can share a session"})
+	}
+
+	var req SessionAccessRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	grantee := strings.TrimSpace(utils.CopyString(req.User))
+	if grantee == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "user is required"})
+	}
+
+	session.grantAccess(grantee)
+	return c.JSON(session.access())
+}
+
+// revokeSessionAccess serves DELETE /api/sessions/:sessionId/access/:user
+func revokeSessionAccess(c *fiber.Ctx) error {
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), user)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	if !session.isOwner(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner can change who may access a session"})
+	}
+
+	grantee, err := url.PathUnescape(c.Params("user"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user"})
+	}
+	if !session.revokeAccess(grantee) {
+		return c.Status(404).JSON(fiber.Map{"error": "User has no access to the session"})
+	}
+	return c.JSON(session.access())
+}
+
+// controller returns the user who may type into the session; the owner
+// unless control was handed over
+func (s *ModuleSession) controller() string {
+	s.accessMutex.Lock()
+	defer s.accessMutex.Unlock()
+	return s.controllerLocked()
+}
+
+func (s *ModuleSession) controllerLocked() string {
+	if s.controlUser != "" {
+		return s.controlUser
+	}
+	return s.User
+}
+
+// canControl reports whether user may send input, signals and resizes. Users
+// with access who do not hold control watch the session as observers.
+func (s *ModuleSession) canControl(user string) bool {
+	if currentAuthSettings.Mode == authModeNone {
+		return true
+	}
+	return user == s.controller()
+}
+
+// handOverControl moves the input rights to user, who must be the owner or
+// have been granted access
+func (s *ModuleSession) handOverControl(user string) bool {
+	s.accessMutex.Lock()
+	if user != s.User && !s.grants[user] {
+		s.accessMutex.Unlock()
+		return false
+	}
+	s.controlUser = user
+	s.accessMutex.Unlock()
+
+	s.Stream.PublishState(stateSlotControl, "control", SessionControl{Controller: user})
+	return true
+}
+
+// SessionControl is sent to subscribers as "control" when input rights move
+type SessionControl struct {
+	Controller string `json:"controller"`
+}
+
+// sessionRole returns the role of user in the session for SessionInfo
+func (s *ModuleSession) sessionRole(user string) string {
+	if s.canControl(user) {
+		return sessionRoleControl
+	}
+	return sessionRoleObserve
+}
+
+// Roles of users with access to a session
+const (
+	sessionRoleControl = "control" // Sends input and signals
+	sessionRoleObserve = "observe" // Only receives the output
+)
+
+// ControlRequest is the body of POST /api/sessions/:sessionId/control
+type ControlRequest struct {
+	User string `json:"user"`
+}
+
+// handOverSessionControl serves POST /api/sessions/:sessionId/control. The
+// owner and the user in control can pass control to the owner or a user
+// with access; the owner can always take it back.
+func handOverSessionControl(c *fiber.Ctx) error {
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), user)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	if !session.isOwner(user) && !session.canControl(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner or the user in control can hand over control"})
+	}
+
+	var req ControlRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	target := strings.TrimSpace(utils.CopyString(req.User))
+	if target == "" {
+		target = session.User
+	}
+	if !session.handOverControl(target) {
+		return c.Status(400).JSON(fiber.Map{"error": "User has no access to the session"})
+	}
+
+	log.Printf("Session %s: control handed over to %q by %q", session.ID, target, user)
+	return c.JSON(session.access())
+}
+
+// access describes who may access the session
+func (s *ModuleSession) access() SessionAccess {
+	return SessionAccess{Owner: s.User, Controller: s.controller(), Users: s.sharedWith()}
+}
+
+const (
+	defaultShareMinutes = 60
+	maxShareMinutes     = 24 * 60
+
+	// shareCheckInterval is how often observer connections check their token
+	shareCheckInterval = time.Second
+)
+
+// shareTokens let their holders watch one session over the WebSocket without
+// logging in, until they expire or are revoked
+var shareTokens = struct {
+	sync.Mutex
+	tokens map[string]shareToken
+}{tokens: make(map[string]shareToken)}
+
+type shareToken struct {
+	sessionId string
+	expiresAt time.Time
+}
+
+// ShareRequest is the body of POST /api/sessions/:sessionId/share
+type ShareRequest struct {
+	ExpiresMinutes int `json:"expires_minutes,omitempty"` // Default 60, at most 1440
+}
+
+// ShareResponse carries a new share token
+type ShareResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	URL       string    `json:"url"` // WebSocket path for observers
+}
+
+// shareTokenQueryPattern finds the share token in a query string
+var shareTokenQueryPattern = regexp.MustCompile(`(^|[?&])share=[^&]*`)
+
+// maskShareToken hides the share token in a URL or query string
+func maskShareToken(text string) string {
+	return shareTokenQueryPattern.ReplaceAllString(text, "${1}share="+redactedText)
+}
+
+// shareTokenLogTags replace the request logger tags that print the query
+// string, so that share tokens never reach the log whatever format is used
+var shareTokenLogTags = map[string]logger.LogFunc{
+	logger.TagURL: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+		return output.WriteString(maskShareToken(c.OriginalURL()))
+	},
+	logger.TagQueryStringParams: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+		return output.WriteString(maskShareToken(c.Request().URI().QueryArgs().String()))
+	},
+	logger.TagQuery: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, name string) (int, error) {
+		if name == "share" && c.Query(name) != "" {
+			return output.WriteString(redactedText)
+		}
+		return output.WriteString(c.Query(name))
+	},
+}
+
+// lookupShareToken returns the session a valid token was issued for
+func lookupShareToken(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	shareTokens.Lock()
+	defer shareTokens.Unlock()
+
+	share, exists := shareTokens.tokens[token]
+	if !exists {
+		return "", false
+	}
+	if time.Now().After(share.expiresAt) {
+		delete(shareTokens.tokens, token)
+		return "", false
+	}
+	return share.sessionId, true
+}
+
+// shareSession serves POST /api/sessions/:sessionId/share. Only the owner can
+// create share tokens.
+func shareSession(c *fiber.Ctx) error {
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), user)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	if !session.isOwner(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner can share a session"})
+	}
+
+	var req ShareRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+	minutes := req.ExpiresMinutes
+	if minutes == 0 {
+		minutes = defaultShareMinutes
+	}
+	if minutes < 0 || minutes > maxShareMinutes {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("expires_minutes must be between 1 and %d", maxShareMinutes)})
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create share token"})
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	expiresAt := time.Now().Add(time.Duration(minutes) * time.Minute)
+
+	shareTokens.Lock()
+	for existing, share := range shareTokens.tokens {
+		if time.Now().After(share.expiresAt) {
+			delete(shareTokens.tokens, existing)
+		}
+	}
+	shareTokens.tokens[token] = shareToken{sessionId: session.ID, expiresAt: expiresAt}
+	shareTokens.Unlock()
+
+	log.Printf("Session %s shared for observers until %s", session.ID, expiresAt.Format(time.RFC3339))
+	return c.JSON(ShareResponse{Token: token, ExpiresAt: expiresAt, URL: "/ws?share=" + token})
+}
+
+// revokeSessionShares serves DELETE /api/sessions/:sessionId/share and
+// disconnects observers that joined with a token
+func revokeSessionShares(c *fiber.Ctx) error {
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), user)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	if !session.isOwner(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner can revoke share tokens"})
+	}
+
+	revoked := 0
+	shareTokens.Lock()
+	for token, share := range shareTokens.tokens {
+		if share.sessionId == session.ID {
+			delete(shareTokens.tokens, token)
+			revoked++
+		}
+	}
+	shareTokens.Unlock()
+
+	return c.JSON(fiber.Map{"revoked": revoked})
+}
+
+// watchShareToken closes an observer connection once its token expired or
+// was revoked, until stop is closed
+func watchShareToken(token string, conn *websocket.Conn, writer *wsWriter, stop <-chan struct{}) {
+	ticker := time.NewTicker(shareCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if _, valid := lookupShareToken(token); !valid {
+			writer.sendError(errShareInvalid.Error())
+			conn.Close()
+			return
+		}
+	}
+}
+
+var (
+	// errSessionObserver rejects input and signals from users without control
+	errSessionObserver = errors.New("Observers cannot send input or signals to the session")
+	errShareInvalid    = errors.New("Share link expired or was revoked")
+)
+
+// lookupSessionForConnection returns the session a WebSocket connection may
+// follow: a logged-in user needs access, an observer with a share token only
+// sees the session the token was issued for
+func lookupSessionForConnection(sessionId, user, share string) (*ModuleSession, error) {
+	if share == "" {
+		return sessionManager.lookupSessionForUser(sessionId, user)
+	}
+
+	sharedId, valid := lookupShareToken(share)
+	if !valid {
+		return nil, errShareInvalid
+	}
+	if sharedId != sessionId {
+		return nil, errSessionForbidden
+	}
+	session, exists := sessionManager.lookupSession(sessionId)
+	if !exists {
+		return nil, errSessionNotFound
+	}
+	return session, nil
+}
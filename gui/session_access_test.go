@@ -0,0 +1,195 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// withAuthMode switches the authentication mode for the rest of the test
+func withAuthMode(t *testing.T, mode string) {
+	t.Helper()
+	previous := currentAuthSettings
+	currentAuthSettings.Mode = mode
+	t.Cleanup(func() { currentAuthSettings = previous })
+}
+
+func newAccessTestSession(id, owner string) *ModuleSession {
+	return &ModuleSession{
+		ID:     id,
+		User:   owner,
+		Done:   make(chan struct{}),
+		Stream: newOutputStream(minScrollbackBytes, 24, 80),
+	}
+}
+
+func TestSessionAccessRules(t *testing.T) {
+	type role struct {
+		access, control, owner bool
+	}
+
+	tests := []struct {
+		mode                 string
+		alice, bob, stranger role // Before control is handed to bob
+		bobInControl         role // Alice once bob holds control
+	}{
+		{authModeNone, role{true, true, true}, role{true, true, true}, role{true, true, true}, role{true, true, true}},
+		{authModeSession, role{true, true, true}, role{true, false, false}, role{false, false, false}, role{true, false, true}},
+		{authModeBasic, role{true, true, true}, role{true, false, false}, role{false, false, false}, role{true, false, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			withAuthMode(t, test.mode)
+
+			session := newAccessTestSession("access-test", "alice")
+			session.grantAccess("bob")
+
+			check := func(user string, want role) {
+				t.Helper()
+				got := role{session.canAccess(user), session.canControl(user), session.isOwner(user)}
+				if got != want {
+					t.Errorf("%s: access/control/owner = %v, want %v", user, got, want)
+				}
+			}
+			check("alice", test.alice)
+			check("bob", test.bob)
+			check("mallory", test.stranger)
+
+			if session.handOverControl("mallory") {
+				t.Error("control was handed to a user without access")
+			}
+			if !session.handOverControl("bob") {
+				t.Fatal("control could not be handed to a granted user")
+			}
+			check("alice", test.bobInControl)
+			if !session.canControl("bob") {
+				t.Error("bob does not control the session after the hand-over")
+			}
+			if session.access().Controller != "bob" {
+				t.Errorf("controller is %q, want bob", session.access().Controller)
+			}
+
+			// Revoking access returns control to the owner
+			if !session.revokeAccess("bob") {
+				t.Fatal("bob had no grant to revoke")
+			}
+			check("alice", test.alice)
+			if test.mode != authModeNone && (session.canAccess("bob") || session.canControl("bob")) {
+				t.Error("bob kept access after the grant was revoked")
+			}
+		})
+	}
+}
+
+func TestCanAccessRecord(t *testing.T) {
+	tests := []struct {
+		mode       string
+		user       string
+		owner      string
+		sharedWith []string
+		want       bool
+	}{
+		{authModeSession, "alice", "alice", nil, true},
+		{authModeSession, "bob", "alice", []string{"bob"}, true},
+		{authModeSession, "mallory", "alice", []string{"bob"}, false},
+		{authModeSession, "", "", nil, false}, // Written before records had owners
+		{authModeBasic, "alice", "", nil, false},
+		{authModeNone, "", "alice", nil, true},
+		{authModeNone, "", "", nil, true},
+	}
+
+	for _, test := range tests {
+		withAuthMode(t, test.mode)
+		if got := canAccessRecord(test.user, test.owner, test.sharedWith); got != test.want {
+			t.Errorf("%s: %q on a record of %q shared with %v = %v, want %v", test.mode, test.user, test.owner, test.sharedWith, got, test.want)
+		}
+	}
+}
+
+func TestShareTokenLookup(t *testing.T) {
+	withAuthMode(t, authModeSession)
+
+	shared := newAccessTestSession("shared-session", "alice")
+	other := newAccessTestSession("other-session", "alice")
+	sessionManager.mutex.Lock()
+	sessionManager.sessions[shared.ID] = shared
+	sessionManager.sessions[other.ID] = other
+	sessionManager.mutex.Unlock()
+
+	shareTokens.Lock()
+	shareTokens.tokens["valid"] = shareToken{sessionId: shared.ID, expiresAt: time.Now().Add(time.Minute)}
+	shareTokens.tokens["expired"] = shareToken{sessionId: shared.ID, expiresAt: time.Now().Add(-time.Second)}
+	shareTokens.Unlock()
+
+	t.Cleanup(func() {
+		sessionManager.mutex.Lock()
+		delete(sessionManager.sessions, shared.ID)
+		delete(sessionManager.sessions, other.ID)
+		sessionManager.mutex.Unlock()
+		shareTokens.Lock()
+		delete(shareTokens.tokens, "valid")
+		delete(shareTokens.tokens, "expired")
+		shareTokens.Unlock()
+	})
+
+	tests := []struct {
+		name      string
+		sessionId string
+		user      string
+		share     string
+		want      error
+	}{
+		{"token of the session", shared.ID, "", "valid", nil},
+		{"token of another session", other.ID, "", "valid", errSessionForbidden},
+		{"expired token", shared.ID, "", "expired", errShareInvalid},
+		{"unknown token", shared.ID, "", "guess", errShareInvalid},
+		{"token does not extend a user's access", other.ID, "mallory", "valid", errSessionForbidden},
+		{"user without token", shared.ID, "mallory", "", errSessionForbidden},
+		{"owner without token", shared.ID, "alice", "", nil},
+		{"unknown session", "missing", "alice", "", errSessionNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session, err := lookupSessionForConnection(test.sessionId, test.user, test.share)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("got error %v, want %v", err, test.want)
+			}
+			if err == nil && session.ID != test.sessionId {
+				t.Errorf("got session %s, want %s", session.ID, test.sessionId)
+			}
+		})
+	}
+
+	// Expired tokens are forgotten
+	shareTokens.Lock()
+	_, kept := shareTokens.tokens["expired"]
+	shareTokens.Unlock()
+	if kept {
+		t.Error("expired token was not removed")
+	}
+}
+
+func TestMaskShareToken(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"/ws?share=abc123", "/ws?share=" + redactedText},
+		{"/ws?lang=de&share=abc123&x=1", "/ws?lang=de&share=" + redactedText + "&x=1"},
+		{"share=abc123", "share=" + redactedText},
+		{"/ws?noshare=abc", "/ws?noshare=abc"},
+	}
+	for _, test := range tests {
+		if got := maskShareToken(test.input); got != test.want {
+			t.Errorf("maskShareToken(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInputWaitSeconds = 15
+	inputCheckInterval      = time.Second
+
+	// defaultInputPromptPattern matches the line at the cursor when a module
+	// asks for input without lib_ui.sh: a trailing colon, question mark or
+	// angle bracket, a yes/no choice or "press enter/any key"
+	defaultInputPromptPattern = `(?i)([:?>]|\[[yjn]/[yjn]\]|\([yjn]/[yjn]\)|press (enter|any key|return)\b.*)\s*$`
+
+	// sessionStatusNeedsInput is reported as status of a running session that
+	// waits for input
+	sessionStatusNeedsInput = "needs_input"
+
+	notificationTimeout = 30 * time.Second
+	needsInputLines     = 5 // Screen lines quoted in needs_input events
+)
+
+// Input wait detection settings from general.d/30-gui.conf
+var (
+	// inputWaitSeconds is how long a session has to be silent at a prompt
+	// before it counts as waiting for input; 0 disables the detection
+	inputWaitSeconds = defaultInputWaitSeconds
+
+	// inputNotify sends a desktop notification through lib_notifications.sh
+	inputNotify = true
+
+	inputPromptPattern = regexp.MustCompile(defaultInputPromptPattern)
+)
+
+// NeedsInputEvent is sent as "needs_input" when a session has been waiting
+// for an answer for inputWaitSeconds
+type NeedsInputEvent struct {
+	Source string    `json:"source"`           // "menu" or "prompt" from lib_ui.sh, "screen" for a prompt-like line
+	Prompt string    `json:"prompt,omitempty"` // Question, menu title or the line at the cursor
+	Since  time.Time `json:"since"`            // Last input or output
+	Lines  []string  `json:"lines,omitempty"`  // Last lines of the screen up to the cursor
+}
+
+// detectPrompt reports whether the session shows a prompt: a menu or question
+// announced by lib_ui.sh that has not been answered, or a line at the cursor
+// that looks like one. Sessions with a process running or in disk IO are busy.
+func (s *ModuleSession) detectPrompt() *NeedsInputEvent {
+	pid := s.pid()
+	if pid <= 0 {
+		return nil
+	}
+	for _, process := range sessionProcesses(pid) {
+		if process.State == "R" || process.State == "D" {
+			return nil
+		}
+	}
+
+	screen := s.Stream.Screen(0)
+	lines := screen.Lines[:min(screen.CursorRow+1, len(screen.Lines))]
+	event := &NeedsInputEvent{}
+	for i := len(lines) - 1; i >= 0 && len(event.Lines) < needsInputLines; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			event.Lines = append([]string{lines[i]}, event.Lines...)
+		}
+	}
+
+	if state := s.Stream.State(stateSlotInteraction); state != nil {
+		event.Source = state.Type
+		switch content := state.Content.(type) {
+		case PromptEvent:
+			event.Prompt = content.Message
+		case *MenuEvent:
+			event.Prompt = content.Title
+		}
+		return event
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+	cursorLine := strings.TrimSpace(lines[len(lines)-1])
+	if cursorLine == "" || !inputPromptPattern.MatchString(cursorLine) {
+		return nil
+	}
+	event.Source = "screen"
+	event.Prompt = cursorLine
+	return event
+}
+
+// watchInput publishes "needs_input" once the session has been silent at a
+// prompt for inputWaitSeconds and notifies the desktop. The state ends with
+// "needs_input_cleared" on the next input or output.
+func (s *ModuleSession) watchInput() {
+	if inputWaitSeconds <= 0 {
+		return
+	}
+
+	threshold := time.Duration(inputWaitSeconds) * time.Second
+	ticker := time.NewTicker(inputCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Done:
+			return
+		case <-ticker.C:
+		}
+
+		lastActivity := time.Unix(0, s.lastActivity.Load())
+		if time.Since(lastActivity) < threshold {
+			s.inputResumed()
+			continue
+		}
+		if s.needsInput.Load() != nil {
+			continue
+		}
+
+		event := s.detectPrompt()
+		if event == nil {
+			continue
+		}
+		event.Since = lastActivity
+		if !s.needsInput.CompareAndSwap(nil, event) {
+			continue
+		}
+
+		log.Printf("Session %s (%s) is waiting for input", s.ID, s.ModuleName)
+		s.Stream.PublishState(stateSlotAttention, "needs_input", event)
+		if inputNotify {
+			go s.notifyNeedsInput(event)
+		}
+	}
+}
+
+// inputResumed ends the waiting state after input or output
+func (s *ModuleSession) inputResumed() {
+	event := s.needsInput.Swap(nil)
+	if event == nil {
+		return
+	}
+	s.Stream.ClearState(stateSlotAttention)
+	s.Stream.PublishEvent("needs_input_cleared", event)
+}
+
+// displayStatus returns the status shown in SessionInfo; the caller must hold
+// the session manager lock
+func (s *ModuleSession) displayStatus() string {
+	if s.Status == "running" && s.needsInput.Load() != nil {
+		return sessionStatusNeedsInput
+	}
+	return s.Status
+}
+
+// notifyNeedsInput sends a desktop notification with lh_send_notification.
+// The notification leaves the GUI, so the screen text is redacted first.
+func (s *ModuleSession) notifyNeedsInput(event *NeedsInputEvent) {
+	title := fmt.Sprintf("%s is waiting for input", s.ModuleName)
+	lines := s.redactor.Screen(event.Lines)
+	message := redactSecrets(event.Prompt)
+	if (message == "" || event.Source == "screen") && len(lines) > 0 {
+		// The prompt found on screen is the last line
+		message = lines[len(lines)-1]
+	}
+	if message == "" {
+		message = "The module asks a question in the Little Linux Helper GUI."
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "bash", "-c",
+		`source "$LH_ROOT_DIR/lib/lib_common.sh" && lh_send_notification "warning" "$1" "$2"`,
+		"lh_send_notification", title, message)
+	cmd.Env = append(os.Environ(), "LH_ROOT_DIR="+lhRootDir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// The last line explains why, e.g. that no notification tool was found
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		log.Printf("Desktop notification for session %s failed (%v): %s", s.ID, err, stripANSI(lines[len(lines)-1]))
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// alwaysDeniedEnv are never passed to modules: the GUI credentials and
+// settings that applyGeneralConfigKey exports, and session cookies
+var alwaysDeniedEnv = []string{
+	"LLH_GUI_*",
+	"HTTP_COOKIE",
+	"*_COOKIE",
+	"*_COOKIE_*",
+}
+
+// Global environment filter from general.d/30-gui.conf. An empty allowlist
+// passes every variable that is not denied.
+var (
+	moduleEnvAllow []string
+	moduleEnvDeny  []string
+)
+
+// EnvironmentInfo restricts the environment one module inherits from the GUI
+// server. Patterns use shell glob syntax, e.g. "DBUS_*".
+type EnvironmentInfo struct {
+	Allow []string `json:"allow,omitempty"` // Added to the global allowlist
+	Deny  []string `json:"deny,omitempty"`  // Added to the global denylist
+}
+
+// parseEnvPatterns splits a space or comma separated list of patterns
+func parseEnvPatterns(value string) ([]string, error) {
+	patterns := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return patterns, nil
+}
+
+// matchesEnvPattern reports whether the variable name matches one of the patterns
+func matchesEnvPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleEnvironment returns the variables of environ ("NAME=value") a module
+// may inherit. Denied variables are always removed; if the global settings
+// or the module define an allowlist, only matching variables are kept.
+func moduleEnvironment(environ []string, overrides *EnvironmentInfo) []string {
+	allow := moduleEnvAllow
+	deny := append(append([]string(nil), alwaysDeniedEnv...), moduleEnvDeny...)
+	if overrides != nil {
+		allow = append(append([]string(nil), allow...), overrides.Allow...)
+		deny = append(deny, overrides.Deny...)
+	}
+
+	filtered := make([]string, 0, len(environ))
+	for _, variable := range environ {
+		name, _, _ := strings.Cut(variable, "=")
+		if matchesEnvPattern(name, deny) {
+			continue
+		}
+		if len(allow) > 0 && !matchesEnvPattern(name, allow) {
+			continue
+		}
+		filtered = append(filtered, variable)
+	}
+	return filtered
+}
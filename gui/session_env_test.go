@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEnvPatterns(t *testing.T) {
+	patterns, err := parseEnvPatterns("DBUS_*, LANG  XDG_?_DIR,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(patterns, " "); got != "DBUS_* LANG XDG_?_DIR" {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := parseEnvPatterns("PATH [A-"); err == nil {
+		t.Error("invalid pattern was accepted")
+	}
+}
+
+func TestModuleEnvironment(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/root",
+		"LANG=de_DE.UTF-8",
+		"LANGUAGE=de",
+		"DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/0/bus",
+		"LLH_GUI_AUTH_PASS=hunter2",
+		"LLH_GUI_SESSION_SECRET=abc",
+		"HTTP_COOKIE=session=1",
+		"GUI_COOKIE=1",
+		"GUI_COOKIE_NAME=llh",
+		"EMPTY_VALUE=",
+		"NO_EQUALS",
+	}
+
+	tests := []struct {
+		name      string
+		allow     []string
+		deny      []string
+		overrides *EnvironmentInfo
+		want      []string
+	}{
+		{
+			name: "no filter",
+			want: []string{"PATH", "HOME", "LANG", "LANGUAGE", "DBUS_SESSION_BUS_ADDRESS", "EMPTY_VALUE", "NO_EQUALS"},
+		},
+		{
+			name: "global deny",
+			deny: []string{"DBUS_*", "HOME"},
+			want: []string{"PATH", "LANG", "LANGUAGE", "EMPTY_VALUE", "NO_EQUALS"},
+		},
+		{
+			name:  "global allow",
+			allow: []string{"PATH", "LANG*"},
+			want:  []string{"PATH", "LANG", "LANGUAGE"},
+		},
+		{
+			name:  "allowing everything keeps the GUI settings out",
+			allow: []string{"*", "LLH_GUI_*", "HTTP_COOKIE"},
+			want:  []string{"PATH", "HOME", "LANG", "LANGUAGE", "DBUS_SESSION_BUS_ADDRESS", "EMPTY_VALUE", "NO_EQUALS"},
+		},
+		{
+			name:      "module adds to the allowlist",
+			allow:     []string{"PATH"},
+			overrides: &EnvironmentInfo{Allow: []string{"HOME"}},
+			want:      []string{"PATH", "HOME"},
+		},
+		{
+			name:      "module allowlist without a global one",
+			overrides: &EnvironmentInfo{Allow: []string{"LANG"}},
+			want:      []string{"LANG"},
+		},
+		{
+			name:      "deny wins over allow",
+			allow:     []string{"LANG*"},
+			overrides: &EnvironmentInfo{Allow: []string{"PATH"}, Deny: []string{"LANGUAGE"}},
+			want:      []string{"PATH", "LANG"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previousAllow, previousDeny := moduleEnvAllow, moduleEnvDeny
+			moduleEnvAllow, moduleEnvDeny = test.allow, test.deny
+			defer func() { moduleEnvAllow, moduleEnvDeny = previousAllow, previousDeny }()
+
+			var names []string
+			for _, variable := range moduleEnvironment(environ, test.overrides) {
+				name, _, _ := strings.Cut(variable, "=")
+				names = append(names, name)
+			}
+			if got, want := strings.Join(names, " "), strings.Join(test.want, " "); got != want {
+				t.Errorf("got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
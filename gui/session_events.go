@@ -0,0 +1,295 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In GUI mode, lib_ui.sh describes menus, prompts and progress in-band with an
+// OSC escape sequence carrying JSON:
+//
+//	ESC ] 7700 ; llh ; {"type":"menu_item","value":"1","label":"..."} BEL
+//
+// The sequence may also end with ST (ESC \). guiEventParser removes these
+// sequences from the terminal output and turns them into typed messages.
+const (
+	guiEventPrefix     = "\x1b]7700;llh;"
+	guiEventMaxPayload = 64 * 1024 // Longer sequences are not ours and are passed through
+
+	// menuSettleDelay is how long the parser waits for further menu items
+	// before the collected menu is sent
+	menuSettleDelay = 150 * time.Millisecond
+)
+
+// Stream state slots: a new subscriber receives the menu or prompt that is
+// waiting for an answer, the last progress report, the last stats, who
+// holds control and whether the session waits for input
+const (
+	stateSlotInteraction = "interaction"
+	stateSlotProgress    = "progress"
+	stateSlotStats       = "stats"
+	stateSlotControl     = "control"
+	stateSlotAttention   = "attention"
+)
+
+// ansiSequencePattern matches colour codes and other CSI sequences in labels
+var ansiSequencePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// PromptOption is one answer of a prompt or one entry of a menu
+type PromptOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// PromptEvent is sent as "prompt" when a module asks a question through lib_ui.sh
+type PromptEvent struct {
+	Kind    string         `json:"kind"` // confirm or input
+	Message string         `json:"message"`
+	Default string         `json:"default,omitempty"`
+	Pattern string         `json:"pattern,omitempty"` // Validation regex of input prompts
+	Options []PromptOption `json:"options,omitempty"`
+}
+
+// MenuEvent is sent as "menu" after a module has printed its menu items
+type MenuEvent struct {
+	Title   string         `json:"title,omitempty"`
+	Options []PromptOption `json:"options"`
+}
+
+// ProgressEvent is sent as "progress" when a module reports progress
+type ProgressEvent struct {
+	Label   string  `json:"label,omitempty"`
+	Current int64   `json:"current"`
+	Total   int64   `json:"total,omitempty"`   // 0 when unknown
+	Percent float64 `json:"percent,omitempty"` // Derived from current and total
+}
+
+// guiEventPayload is the JSON sent by lib_ui.sh; the fields used depend on Type
+type guiEventPayload struct {
+	Type    string         `json:"type"`
+	Title   string         `json:"title"`
+	Value   string         `json:"value"`
+	Label   string         `json:"label"`
+	Kind    string         `json:"kind"`
+	Message string         `json:"message"`
+	Default string         `json:"default"`
+	Pattern string         `json:"pattern"`
+	Options []PromptOption `json:"options"`
+	Current int64          `json:"current"`
+	Total   int64          `json:"total"`
+}
+
+// guiEventParser extracts GUI events from the output of one session. Feed is
+// called by the PTY reader; the menu timer publishes from its own goroutine.
+type guiEventParser struct {
+	mutex     sync.Mutex
+	sessionID string
+	stream    *OutputStream
+	carry     string // Incomplete sequence held back until the next read
+	title     string // Last header, used as the title of the next menu
+	menu      *MenuEvent
+	menuTimer *time.Timer
+	stopped   bool
+}
+
+func newGUIEventParser(sessionID string, stream *OutputStream) *guiEventParser {
+	return &guiEventParser{sessionID: sessionID, stream: stream}
+}
+
+// Feed removes GUI event sequences from data, dispatches them and returns the
+// remaining terminal output. A sequence split across reads is completed on the
+// next call.
+func (p *guiEventParser) Feed(data string) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	data = p.carry + data
+	p.carry = ""
+
+	var visible strings.Builder
+	for {
+		start := strings.Index(data, guiEventPrefix)
+		if start < 0 {
+			// Hold back a trailing partial prefix
+			keep := partialPrefixLength(data, guiEventPrefix)
+			visible.WriteString(data[:len(data)-keep])
+			p.carry = data[len(data)-keep:]
+			break
+		}
+
+		visible.WriteString(data[:start])
+		body := data[start+len(guiEventPrefix):]
+
+		end, terminatorLength := findOSCTerminator(body)
+		if end < 0 {
+			if len(body) > guiEventMaxPayload {
+				// Not a complete event after all; pass it through unchanged
+				visible.WriteString(data[start:])
+				break
+			}
+			p.carry = data[start:]
+			break
+		}
+
+		p.dispatch(body[:end])
+		data = body[end+terminatorLength:]
+	}
+
+	return visible.String()
+}
+
+// Stop discards a pending menu once the output has ended and returns output
+// that was held back as a possible incomplete sequence
+func (p *guiEventParser) Stop() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.stopped = true
+	if p.menuTimer != nil {
+		p.menuTimer.Stop()
+	}
+	p.menu = nil
+
+	rest := p.carry
+	p.carry = ""
+	return rest
+}
+
+// InputSent discards a menu that is still being collected: it has been
+// answered before it was announced
+func (p *guiEventParser) InputSent() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.menuTimer != nil {
+		p.menuTimer.Stop()
+	}
+	p.menu = nil
+}
+
+// dispatch handles one event payload; the mutex must be held
+func (p *guiEventParser) dispatch(raw string) {
+	var event guiEventPayload
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		log.Printf("Ignoring malformed GUI event from session %s: %v", p.sessionID, err)
+		return
+	}
+
+	if event.Type == "menu_item" {
+		if p.menu == nil {
+			p.menu = &MenuEvent{Title: p.title}
+		}
+		p.menu.Options = append(p.menu.Options, PromptOption{
+			Value: stripANSI(event.Value),
+			Label: stripANSI(event.Label),
+		})
+		if p.menuTimer == nil {
+			p.menuTimer = time.AfterFunc(menuSettleDelay, p.flushMenuLater)
+		} else {
+			p.menuTimer.Reset(menuSettleDelay)
+		}
+		return
+	}
+
+	// Any other event ends the menu being collected
+	p.flushMenu()
+
+	switch event.Type {
+	case "header":
+		p.title = stripANSI(event.Title)
+	case "prompt":
+		prompt := PromptEvent{
+			Kind:    event.Kind,
+			Message: stripANSI(event.Message),
+			Default: event.Default,
+			Pattern: event.Pattern,
+		}
+		for _, option := range event.Options {
+			prompt.Options = append(prompt.Options, PromptOption{
+				Value: stripANSI(option.Value),
+				Label: stripANSI(option.Label),
+			})
+		}
+		// A question means the previous operation has finished
+		p.stream.ClearState(stateSlotProgress)
+		p.stream.PublishState(stateSlotInteraction, "prompt", prompt)
+	case "progress":
+		progress := ProgressEvent{
+			Label:   stripANSI(event.Label),
+			Current: event.Current,
+			Total:   event.Total,
+		}
+		if event.Total > 0 {
+			progress.Percent = min(100, float64(event.Current)*100/float64(event.Total))
+		}
+		p.stream.PublishState(stateSlotProgress, "progress", progress)
+	default:
+		log.Printf("Ignoring unknown GUI event %q from session %s", event.Type, p.sessionID)
+	}
+}
+
+// flushMenu publishes the collected menu; the mutex must be held
+func (p *guiEventParser) flushMenu() {
+	if p.menuTimer != nil {
+		p.menuTimer.Stop()
+	}
+	if p.menu == nil || p.stopped {
+		return
+	}
+	menu := p.menu
+	p.menu = nil
+	p.stream.ClearState(stateSlotProgress)
+	p.stream.PublishState(stateSlotInteraction, "menu", menu)
+}
+
+func (p *guiEventParser) flushMenuLater() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flushMenu()
+}
+
+// findOSCTerminator returns the position and length of the BEL or ST that ends
+// an OSC sequence, or -1 if it has not arrived yet
+func findOSCTerminator(body string) (int, int) {
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\a':
+			return i, 1
+		case '\x1b':
+			if i+1 < len(body) && body[i+1] == '\\' {
+				return i, 2
+			}
+			if i+1 == len(body) {
+				return -1, 0
+			}
+		}
+	}
+	return -1, 0
+}
+
+// partialPrefixLength returns the length of the longest suffix of data that is
+// a proper prefix of prefix
+func partialPrefixLength(data, prefix string) int {
+	for n := min(len(data), len(prefix)-1); n > 0; n-- {
+		if strings.HasSuffix(data, prefix[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+func stripANSI(text string) string {
+	return strings.TrimSpace(ansiSequencePattern.ReplaceAllString(text, ""))
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGUIEventParserFeed(t *testing.T) {
+	progress := `{"type":"progress","label":"Copying","current":1,"total":4}`
+	oversize := guiEventPrefix + strings.Repeat("x", guiEventMaxPayload+1)
+
+	tests := []struct {
+		name     string
+		reads    []string
+		visible  string
+		progress bool
+	}{
+		{
+			name:     "BEL terminated",
+			reads:    []string{"before" + guiEventPrefix + progress + "\a" + "after"},
+			visible:  "beforeafter",
+			progress: true,
+		},
+		{
+			name:     "ESC backslash terminated",
+			reads:    []string{"before" + guiEventPrefix + progress + "\x1b\\" + "after"},
+			visible:  "beforeafter",
+			progress: true,
+		},
+		{
+			name:     "prefix split across reads",
+			reads:    []string{"before\x1b]77", "00;llh;" + progress[:10], progress[10:] + "\x1b", "\\after"},
+			visible:  "beforeafter",
+			progress: true,
+		},
+		{
+			name:    "partial prefix that is not an event",
+			reads:   []string{"before\x1b]7", "2;title\a"},
+			visible: "before\x1b]72;title\a",
+		},
+		{
+			name:    "oversize passthrough",
+			reads:   []string{"before" + oversize},
+			visible: "before" + oversize,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := newOutputStream(minScrollbackBytes, 24, 80)
+			parser := newGUIEventParser("test", stream)
+
+			var visible strings.Builder
+			for _, read := range test.reads {
+				visible.WriteString(parser.Feed(read))
+			}
+			visible.WriteString(parser.Stop())
+
+			if visible.String() != test.visible {
+				got := visible.String()
+				if len(got) > 80 {
+					got = got[:80] + "..."
+				}
+				t.Errorf("visible output = %q (%d bytes), want %d bytes", got, visible.Len(), len(test.visible))
+			}
+
+			state := stream.State(stateSlotProgress)
+			if !test.progress {
+				if state != nil {
+					t.Errorf("unexpected event %+v", state)
+				}
+				return
+			}
+			if state == nil {
+				t.Fatal("progress event was not dispatched")
+			}
+			event, ok := state.Content.(ProgressEvent)
+			if !ok || event.Label != "Copying" || event.Percent != 25 {
+				t.Errorf("got progress %+v, want Copying at 25%%", state.Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Transcript export formats
+const (
+	exportFormatAsciicast = "asciicast" // asciinema asciicast v2 with timings
+	exportFormatHTML      = "html"      // Self-contained page with the ANSI colors applied
+	exportFormatText      = "text"      // Plain text without escape sequences
+)
+
+// ansiPalette are the 16 basic terminal colors (xterm defaults)
+var ansiPalette = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// cssColor returns the CSS value of a screenStyle color, empty for the default
+func cssColor(color int32) string {
+	switch {
+	case color == 0:
+		return ""
+	case color&colorRGB != 0:
+		return fmt.Sprintf("#%06x", color&0xffffff)
+	case color <= 16:
+		return ansiPalette[color-1]
+	case color <= 232: // 6x6x6 color cube
+		n := int(color) - 17
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default: // Gray ramp
+		gray := 8 + (int(color)-233)*10
+		return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+	}
+}
+
+// css returns the inline style of a cell, empty for the default style
+func (s screenStyle) css() string {
+	fg, bg := cssColor(s.fg), cssColor(s.bg)
+	if s.attrs&attrInverse != 0 {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = exportBackground
+		}
+		if bg == "" {
+			bg = exportForeground
+		}
+	}
+
+	var rules []string
+	if fg != "" {
+		rules = append(rules, "color:"+fg)
+	}
+	if bg != "" {
+		rules = append(rules, "background-color:"+bg)
+	}
+	if s.attrs&attrBold != 0 {
+		rules = append(rules, "font-weight:bold")
+	}
+	if s.attrs&attrDim != 0 {
+		rules = append(rules, "opacity:0.7")
+	}
+	if s.attrs&attrItalic != 0 {
+		rules = append(rules, "font-style:italic")
+	}
+	var decorations []string
+	if s.attrs&attrUnderline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if s.attrs&attrStrike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		rules = append(rules, "text-decoration:"+strings.Join(decorations, " "))
+	}
+	if s.attrs&attrHidden != 0 {
+		rules = append(rules, "visibility:hidden")
+	}
+	return strings.Join(rules, ";")
+}
+
+// Colors of the exported HTML page
+const (
+	exportForeground = "#d4d4d4"
+	exportBackground = "#1e1e1e"
+)
+
+// asciicastHeader is the first line of an asciicast v2 file
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Duration  float64           `json:"duration,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// writeAsciicast writes a transcript as asciicast v2: a header line followed
+// by the events, which already use the asciicast event format
+func writeAsciicast(w io.Writer, meta TranscriptMeta, events []TranscriptEvent) error {
+	header := asciicastHeader{
+		Version:   2,
+		Width:     meta.Cols,
+		Height:    meta.Rows,
+		Timestamp: meta.StartedAt.Unix(),
+		Title:     meta.ModuleName,
+		Env:       map[string]string{"TERM": meta.Term},
+	}
+	if meta.EndedAt != nil {
+		header.Duration = meta.EndedAt.Sub(meta.StartedAt).Seconds()
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTranscriptText writes the output as plain text
+func writeTranscriptText(w io.Writer, meta TranscriptMeta, events []TranscriptEvent) error {
+	return renderTranscriptOutput(meta, events, func(line []screenCell) error {
+		_, err := io.WriteString(w, screenLineText(line)+"\n")
+		return err
+	})
+}
+
+// writeTranscriptHTML writes the output as a self-contained HTML page
+func writeTranscriptHTML(w io.Writer, meta TranscriptMeta, events []TranscriptEvent) error {
+	title := html.EscapeString(fmt.Sprintf("%s – %s", meta.ModuleName, meta.StartedAt.Format("2006-01-02 15:04:05")))
+	if _, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { margin: 0; padding: 1em; background: %s; color: %s; }
+h1 { font: bold 1em sans-serif; margin: 0 0 1em; }
+pre { font: 13px/1.3 "DejaVu Sans Mono", Menlo, Consolas, monospace; margin: 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+<pre>`, title, exportBackground, exportForeground, title); err != nil {
+		return err
+	}
+
+	err := renderTranscriptOutput(meta, events, func(line []screenCell) error {
+		// Cells nothing was written to are left out at the end
+		length := len(line)
+		for length > 0 && line[length-1] == (screenCell{}) {
+			length--
+		}
+		line = line[:length]
+
+		var out strings.Builder
+		for start := 0; start < len(line); {
+			var text strings.Builder
+			end := start
+			for ; end < len(line) && line[end].style == line[start].style; end++ {
+				switch line[end].r {
+				case wideContinuation:
+				case 0:
+					text.WriteByte(' ')
+				default:
+					text.WriteRune(line[end].r)
+				}
+			}
+			if css := line[start].style.css(); css != "" {
+				fmt.Fprintf(&out, `<span style="%s">%s</span>`, css, html.EscapeString(text.String()))
+			} else {
+				out.WriteString(html.EscapeString(text.String()))
+			}
+			start = end
+		}
+		out.WriteByte('\n')
+		_, err := io.WriteString(w, out.String())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "</pre>\n</body>\n</html>\n")
+	return err
+}
+
+// renderTranscriptOutput replays the output on a terminal screen of the
+// recorded size and passes each line to emit once it scrolls off the top,
+// followed by the lines left on the screen. Lines that full-screen programs
+// draw on the alternate screen are not part of the output.
+func renderTranscriptOutput(meta TranscriptMeta, events []TranscriptEvent, emit func(line []screenCell) error) error {
+	var err error
+	rows, cols := normalizeTerminalSize(int(meta.Rows), int(meta.Cols))
+	screen := newTerminalScreen(int(rows), int(cols), 0)
+	screen.scrolledOff = func(line []screenCell) {
+		if err == nil {
+			err = emit(line)
+		}
+	}
+
+	for _, event := range events {
+		switch event.Type {
+		case "o":
+			screen.Write([]byte(event.Data))
+		case "r":
+			var cols, rows int
+			if _, scanErr := fmt.Sscanf(event.Data, "%dx%d", &cols, &rows); scanErr == nil {
+				screen.Resize(rows, cols)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The screen ends with its last line that is not empty
+	lines := 0
+	for row, line := range screen.primary {
+		if encodeScreenLine(line) != "" {
+			lines = row + 1
+		}
+	}
+	for _, line := range screen.primary[:lines] {
+		if err := emit(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportTranscript renders a transcript in the requested format
+func exportTranscript(c *fiber.Ctx, meta TranscriptMeta, events []TranscriptEvent) error {
+	format := c.Query("format", exportFormatAsciicast)
+
+	var extension, contentType string
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case exportFormatAsciicast:
+		extension, contentType = "cast", "application/x-asciicast"
+		err = writeAsciicast(&buffer, meta, events)
+	case exportFormatHTML:
+		extension, contentType = "html", fiber.MIMETextHTMLCharsetUTF8
+		err = writeTranscriptHTML(&buffer, meta, events)
+	case exportFormatText:
+		extension, contentType = "txt", fiber.MIMETextPlainCharsetUTF8
+		err = writeTranscriptText(&buffer, meta, events)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid format (asciicast, html or text)"})
+	}
+	if err != nil {
+		log.Printf("Error exporting transcript %s: %v", meta.SessionID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to export transcript"})
+	}
+
+	c.Attachment(fmt.Sprintf("%s-%s.%s", meta.Module, meta.SessionID, extension))
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(buffer.Bytes())
+}
+
+// getTranscriptExport serves GET /api/transcripts/:sessionId/export
+func getTranscriptExport(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	meta, err := loadTranscriptForUser(sessionId, requestUser(c))
+	if err != nil {
+		return transcriptErrorResponse(c, err)
+	}
+	events, err := readTranscriptEvents(sessionId)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.Status(404).JSON(fiber.Map{"error": "Transcript not found"})
+		}
+		log.Printf("Error reading transcript: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read transcript"})
+	}
+	return exportTranscript(c, meta, events)
+}
+
+// getSessionExport serves GET /api/sessions/:sessionId/export from the
+// session's transcript. Sessions without one cannot be exported: only the
+// transcript holds the output with secrets redacted.
+func getSessionExport(c *fiber.Ctx) error {
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), requestUser(c))
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	if session.Transcript == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Session has no transcript to export"})
+	}
+
+	session.Transcript.Flush()
+	meta, err := loadTranscriptMeta(session.ID)
+	if err == nil {
+		var events []TranscriptEvent
+		if events, err = readTranscriptEvents(session.ID); err == nil {
+			return exportTranscript(c, meta, events)
+		}
+	}
+	log.Printf("Error reading transcript of session %s: %v", session.ID, err)
+	return c.Status(500).JSON(fiber.Map{"error": "Failed to read transcript"})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportTestEvents(output ...string) []TranscriptEvent {
+	events := make([]TranscriptEvent, len(output))
+	for i, data := range output {
+		events[i] = TranscriptEvent{Time: float64(i), Type: "o", Data: data}
+	}
+	return events
+}
+
+func TestWriteTranscriptText(t *testing.T) {
+	meta := TranscriptMeta{Rows: 3, Cols: 20}
+	events := exportTestEvents(
+		"Copying\r\n",
+		"progress  10%\rprogress  50%\rprogress 100%\x1b[K\r\n",
+		"\x1b[1;31mred\x1b[0m \x1b[38;5;208mtext\x1b[m\r\n",
+		"a line longer than twenty columns\r\n",
+		"\x1b[?1049hfull-screen dialog\x1b[?1049l",
+		"Done.",
+	)
+
+	var out strings.Builder
+	if err := writeTranscriptText(&out, meta, events); err != nil {
+		t.Fatal(err)
+	}
+	want := "Copying\nprogress 100%\nred text\na line longer than t\nwenty columns\nDone.\n"
+	if out.String() != want {
+		t.Errorf("got\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestWriteTranscriptHTML(t *testing.T) {
+	meta := TranscriptMeta{ModuleName: "Backup", StartedAt: time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC), Rows: 5, Cols: 40}
+	events := exportTestEvents("plain \x1b[1;31mred\x1b[0m \x1b[7minverse\x1b[27m \x1b[48;2;1;2;3m<rgb>\x1b[49m \x1b[38;5;244mgray\x1b[m\r\n")
+
+	var out strings.Builder
+	if err := writeTranscriptHTML(&out, meta, events); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>Backup – 2025-03-14 09:00:00</title>",
+		`<pre>plain <span style="color:#cd0000;font-weight:bold">red</span> <span style="color:#1e1e1e;background-color:#d4d4d4">inverse</span> <span style="background-color:#010203">&lt;rgb&gt;</span> <span style="color:#808080">gray</span>` + "\n</pre>",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCSSColor(t *testing.T) {
+	tests := []struct {
+		color int32
+		want  string
+	}{
+		{0, ""},
+		{2, "#cd0000"},   // Palette index 1
+		{16, "#ffffff"},  // Palette index 15
+		{17, "#000000"},  // Start of the color cube
+		{197, "#ff0000"}, // Palette index 196
+		{256, "#eeeeee"}, // End of the gray ramp
+		{colorRGB | 0x0a0b0c, "#0a0b0c"},
+	}
+	for _, test := range tests {
+		if got := cssColor(test.color); got != test.want {
+			t.Errorf("cssColor(%#x) = %q, want %q", test.color, got, test.want)
+		}
+	}
+}
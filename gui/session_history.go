@@ -0,0 +1,384 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxHistoryEntries bounds the history file; older entries are dropped
+	maxHistoryEntries = 10000
+
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 500
+)
+
+// Session outcomes recorded in the history
+const (
+	outcomeRunning     = "running"
+	outcomeSucceeded   = "succeeded"   // Exit code 0
+	outcomeFailed      = "failed"      // Non-zero exit code
+	outcomeSignaled    = "signaled"    // Terminated by a signal
+	outcomeInterrupted = "interrupted" // The GUI server went away while the session ran
+)
+
+// SessionHistoryEntry records one module run
+type SessionHistoryEntry struct {
+	SessionID       string     `json:"session_id"`
+	Module          string     `json:"module"`
+	ModuleName      string     `json:"module_name"`
+	ModuleVersion   string     `json:"module_version,omitempty"`
+	Language        string     `json:"language"`
+	User            string     `json:"user,omitempty"`
+	SharedWith      []string   `json:"shared_with,omitempty"` // Users with access when the session ended
+	StartedAt       time.Time  `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+	Outcome         string     `json:"outcome"`
+	ExitCode        *int       `json:"exit_code,omitempty"`
+	Signal          string     `json:"signal,omitempty"`
+	StopRequested   bool       `json:"stop_requested,omitempty"` // Stopped by the GUI rather than exiting on its own
+	StopReason      string     `json:"stop_reason,omitempty"`    // user, shutdown, idle_timeout or max_runtime
+}
+
+// SessionHistory keeps the history in memory and appends every change to a
+// JSON lines file. A session is written once when it starts and again when it
+// ends; when the file is loaded, the later line wins.
+type SessionHistory struct {
+	mutex   sync.Mutex
+	path    string
+	entries []*SessionHistoryEntry // Oldest first
+	index   map[string]*SessionHistoryEntry
+}
+
+var sessionHistory = &SessionHistory{index: make(map[string]*SessionHistoryEntry)}
+
+func sessionHistoryPath() string {
+	return filepath.Join(lhRootDir, "logs", "session_history.jsonl")
+}
+
+// Load reads the history file. Sessions that were still running when the
+// previous server process ended are marked as interrupted.
+func (h *SessionHistory) Load(path string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.path = path
+	h.entries = nil
+	h.index = make(map[string]*SessionHistoryEntry)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry SessionHistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.SessionID == "" {
+			continue
+		}
+		h.put(&entry)
+	}
+	scanErr := scanner.Err()
+	file.Close()
+	if scanErr != nil {
+		return scanErr
+	}
+
+	if len(h.entries) == 0 {
+		return nil
+	}
+
+	for _, entry := range h.entries {
+		if entry.Outcome == outcomeRunning {
+			entry.Outcome = outcomeInterrupted
+		}
+	}
+
+	// Rewrite the file to drop superseded lines and record interrupted sessions
+	return h.rewrite()
+}
+
+// put inserts or replaces an entry; the mutex must be held
+func (h *SessionHistory) put(entry *SessionHistoryEntry) {
+	if existing, ok := h.index[entry.SessionID]; ok {
+		*existing = *entry
+		return
+	}
+	h.entries = append(h.entries, entry)
+	h.index[entry.SessionID] = entry
+
+	if len(h.entries) > maxHistoryEntries {
+		for _, dropped := range h.entries[:len(h.entries)-maxHistoryEntries] {
+			delete(h.index, dropped.SessionID)
+		}
+		h.entries = append([]*SessionHistoryEntry(nil), h.entries[len(h.entries)-maxHistoryEntries:]...)
+	}
+}
+
+// rewrite replaces the history file with the current entries; the mutex must be held
+func (h *SessionHistory) rewrite() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o750); err != nil {
+		return err
+	}
+
+	tmpPath := h.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range h.entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, h.path)
+}
+
+// record stores entry in memory and appends it to the history file
+func (h *SessionHistory) record(entry SessionHistoryEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stored := entry
+	h.put(&stored)
+
+	if h.path == "" {
+		return
+	}
+
+	line, err := json.Marshal(&stored)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o750); err != nil {
+		log.Printf("Warning: could not create session history directory: %v", err)
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		log.Printf("Warning: could not open session history: %v", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(line); err != nil {
+		log.Printf("Warning: could not write session history: %v", err)
+	}
+}
+
+// RecordStart adds a running session to the history
+func (h *SessionHistory) RecordStart(session *ModuleSession) {
+	h.record(SessionHistoryEntry{
+		SessionID:     session.ID,
+		Module:        session.Module,
+		ModuleName:    session.ModuleName,
+		ModuleVersion: session.ModuleVersion,
+		Language:      session.Language,
+		User:          session.User,
+		StartedAt:     session.CreatedAt,
+		Outcome:       outcomeRunning,
+	})
+}
+
+// RecordExit completes the history entry of a session from its wait result
+// stopReason is empty when the module ended on its own.
+func (h *SessionHistory) RecordExit(session *ModuleSession, status *syscall.WaitStatus, waitErr error, stopReason string) {
+	endedAt := time.Now()
+	entry := SessionHistoryEntry{
+		SessionID:       session.ID,
+		Module:          session.Module,
+		ModuleName:      session.ModuleName,
+		ModuleVersion:   session.ModuleVersion,
+		Language:        session.Language,
+		User:            session.User,
+		SharedWith:      session.sharedWith(),
+		StartedAt:       session.CreatedAt,
+		EndedAt:         &endedAt,
+		DurationSeconds: endedAt.Sub(session.CreatedAt).Seconds(),
+		StopRequested:   stopReason != "",
+		StopReason:      stopReason,
+	}
+
+	entry.Outcome, entry.ExitCode, entry.Signal = describeExit(status, waitErr)
+	h.record(entry)
+}
+
+// describeExit turns the wait status of a module into an outcome, exit code and signal name
+func describeExit(status *syscall.WaitStatus, waitErr error) (string, *int, string) {
+	if status == nil {
+		log.Printf("Module process ended without exit status: %v", waitErr)
+		return outcomeFailed, nil, ""
+	}
+
+	if status.Signaled() {
+		return outcomeSignaled, nil, unix.SignalName(status.Signal())
+	}
+
+	code := status.ExitStatus()
+	if code == 0 {
+		return outcomeSucceeded, &code, ""
+	}
+	return outcomeFailed, &code, ""
+}
+
+// canAccess reports whether user may see the entry. While the session runs
+// its current grants apply.
+func (e *SessionHistoryEntry) canAccess(user string) bool {
+	if session, running := sessionManager.lookupSession(e.SessionID); running {
+		return session.canAccess(user)
+	}
+	return canAccessRecord(user, e.User, e.SharedWith)
+}
+
+// Query returns matching entries, newest first, and the total number of matches
+func (h *SessionHistory) Query(filter func(*SessionHistoryEntry) bool, offset, limit int) ([]SessionHistoryEntry, int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	page := make([]SessionHistoryEntry, 0, limit)
+	total := 0
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[i]
+		if !filter(entry) {
+			continue
+		}
+		if total >= offset && len(page) < limit {
+			page = append(page, *entry)
+		}
+		total++
+	}
+	return page, total
+}
+
+// requestUser returns the authenticated user of a request, if any
+func requestUser(c *fiber.Ctx) string {
+	if user := c.Locals("user"); user != nil {
+		return fmt.Sprint(user)
+	}
+	return ""
+}
+
+// parseHistoryTime parses an RFC 3339 time or a local date; dateOnly reports
+// the latter
+func parseHistoryTime(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err = time.ParseInLocation("2006-01-02", value, time.Local)
+	return t, err == nil, err
+}
+
+// getSessionHistory serves GET /api/sessions/history with the sessions the
+// user may access
+func getSessionHistory(c *fiber.Ctx) error {
+	limit := defaultHistoryPageSize
+	if raw := c.Query("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid limit parameter"})
+		}
+		limit = min(value, maxHistoryPageSize)
+	}
+
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid offset parameter"})
+		}
+		offset = value
+	}
+
+	var since, until time.Time
+	if raw := c.Query("since"); raw != "" {
+		t, _, err := parseHistoryTime(raw)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid since parameter (use RFC 3339 or YYYY-MM-DD)"})
+		}
+		since = t
+	}
+	if raw := c.Query("until"); raw != "" {
+		t, dateOnly, err := parseHistoryTime(raw)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid until parameter (use RFC 3339 or YYYY-MM-DD)"})
+		}
+		if dateOnly {
+			// A date includes the whole day
+			t = t.AddDate(0, 0, 1)
+		}
+		until = t
+	}
+
+	module := c.Query("module")
+	user := c.Query("user")
+	outcome := c.Query("outcome")
+	requester := requestUser(c)
+
+	filter := func(entry *SessionHistoryEntry) bool {
+		if !entry.canAccess(requester) {
+			return false
+		}
+		if module != "" && entry.Module != module {
+			return false
+		}
+		if user != "" && entry.User != user {
+			return false
+		}
+		if outcome != "" && entry.Outcome != outcome {
+			return false
+		}
+		if !since.IsZero() && entry.StartedAt.Before(since) {
+			return false
+		}
+		if !until.IsZero() && !entry.StartedAt.Before(until) {
+			return false
+		}
+		return true
+	}
+
+	entries, total := sessionHistory.Query(filter, offset, limit)
+	return c.JSON(fiber.Map{
+		"entries": entries,
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+	})
+}
@@ -0,0 +1,337 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sys/unix"
+)
+
+// Run locks are shared with the CLI: lib_common.sh (lh_run_module_locked) reads
+// and writes the same files, so help_master.sh and the GUI see each other's
+// sessions. Every running module has one file in runLockDir; changes are made
+// while holding an flock on runLockGuardPath.
+
+const (
+	runLockSuffix       = ".lock"
+	runLockGuardTimeout = 5 * time.Second
+)
+
+// Reasons reported when a run lock is refused
+const (
+	runLockReasonSingleInstance = "single_instance"
+	runLockReasonMaxInstances   = "max_instances"
+	runLockReasonExclusiveGroup = "exclusive_group"
+	runLockReasonMaxSessions    = "max_sessions"
+)
+
+// maxConcurrentSessions limits top-level module runs across GUI and CLI (0 = unlimited)
+var maxConcurrentSessions = 0
+
+// ConcurrencyInfo declares how many sessions of a module may run at the same time
+type ConcurrencyInfo struct {
+	SingleInstance  bool     `json:"single_instance,omitempty"`  // At most one session of this module
+	MaxInstances    int      `json:"max_instances,omitempty"`    // At most N sessions of this module
+	ExclusiveGroups []string `json:"exclusive_groups,omitempty"` // At most one session per group, e.g. "backup/restore"
+}
+
+// instanceLimit returns the maximum number of sessions of the module (0 = unlimited)
+func (c *ConcurrencyInfo) instanceLimit() int {
+	if c == nil {
+		return 0
+	}
+	if c.SingleInstance {
+		return 1
+	}
+	return c.MaxInstances
+}
+
+// RunLockHolder describes a module run that holds a lock
+type RunLockHolder struct {
+	SessionID  string   `json:"session_id"`
+	ModuleID   string   `json:"module_id"`
+	ModuleName string   `json:"module_name"`
+	PID        int      `json:"pid"`
+	Context    string   `json:"context"` // GUI or CLI
+	User       string   `json:"user,omitempty"`
+	Started    string   `json:"started"`
+	Groups     []string `json:"groups,omitempty"`
+	Parent     string   `json:"parent,omitempty"` // Lock of the module that launched this one
+}
+
+// RunLockConflict explains why a run lock was refused
+type RunLockConflict struct {
+	Reason string        `json:"reason"`
+	Group  string        `json:"group,omitempty"`
+	Limit  int           `json:"limit,omitempty"`
+	Holder RunLockHolder `json:"holder"`
+}
+
+func (c *RunLockConflict) Error() string {
+	switch c.Reason {
+	case runLockReasonExclusiveGroup:
+		return fmt.Sprintf("exclusive group %q is held by session %s (%s)", c.Group, c.Holder.SessionID, c.Holder.ModuleName)
+	case runLockReasonMaxInstances:
+		return fmt.Sprintf("the maximum of %d sessions of this module is reached (oldest: session %s, %s)", c.Limit, c.Holder.SessionID, c.Holder.ModuleName)
+	case runLockReasonMaxSessions:
+		return fmt.Sprintf("the maximum of %d concurrent sessions is reached (oldest: session %s, %s)", c.Limit, c.Holder.SessionID, c.Holder.ModuleName)
+	default:
+		return fmt.Sprintf("module is already running in session %s (%s)", c.Holder.SessionID, c.Holder.ModuleName)
+	}
+}
+
+// RunLock is a lock held by a GUI session
+type RunLock struct {
+	path string
+	once sync.Once
+}
+
+// Release removes the lock; it is safe to call on a nil lock and more than once
+func (l *RunLock) Release() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: could not remove run lock %s: %v", l.path, err)
+		}
+	})
+}
+
+func runLockDir() string {
+	return filepath.Join(lhRootDir, "logs", "sessions", "run-locks")
+}
+
+func runLockGuardPath() string {
+	return filepath.Join(lhRootDir, "logs", "sessions", "run-locks.lock")
+}
+
+// withRunLockGuard runs fn while holding the flock shared with lib_common.sh
+func withRunLockGuard(fn func() error) error {
+	if err := os.MkdirAll(runLockDir(), 0o755); err != nil {
+		return fmt.Errorf("failed to create run lock directory: %w", err)
+	}
+
+	guard, err := os.OpenFile(runLockGuardPath(), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open run lock guard: %w", err)
+	}
+	defer guard.Close()
+
+	deadline := time.Now().Add(runLockGuardTimeout)
+	for {
+		err := unix.Flock(int(guard.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != unix.EWOULDBLOCK || time.Now().After(deadline) {
+			return fmt.Errorf("run lock guard is busy: %w", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer unix.Flock(int(guard.Fd()), unix.LOCK_UN)
+
+	return fn()
+}
+
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	// Check /proc rather than kill(0), which fails with EPERM for other users' processes
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
+
+func parseRunLockFile(path string) (RunLockHolder, error) {
+	var holder RunLockHolder
+
+	file, err := os.Open(path)
+	if err != nil {
+		return holder, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "session_id":
+			holder.SessionID = value
+		case "module_id":
+			holder.ModuleID = value
+		case "module_name":
+			holder.ModuleName = value
+		case "pid":
+			holder.PID, _ = strconv.Atoi(value)
+		case "context":
+			holder.Context = value
+		case "user":
+			holder.User = value
+		case "started":
+			holder.Started = value
+		case "groups":
+			holder.Groups = strings.Fields(value)
+		case "parent":
+			holder.Parent = value
+		}
+	}
+	return holder, scanner.Err()
+}
+
+// readRunLocks returns the live run locks, oldest first, and removes stale
+// ones whose process is gone; the guard must be held
+func readRunLocks() []RunLockHolder {
+	entries, err := os.ReadDir(runLockDir())
+	if err != nil {
+		return nil
+	}
+
+	holders := make([]RunLockHolder, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), runLockSuffix) {
+			continue
+		}
+
+		path := filepath.Join(runLockDir(), entry.Name())
+		holder, err := parseRunLockFile(path)
+		if err != nil || !processExists(holder.PID) {
+			log.Printf("Removing stale run lock %s", entry.Name())
+			_ = os.Remove(path)
+			continue
+		}
+		holders = append(holders, holder)
+	}
+
+	sort.Slice(holders, func(i, j int) bool { return holders[i].Started < holders[j].Started })
+	return holders
+}
+
+// checkRunLockRules returns the lock that prevents holder from starting, if any
+func checkRunLockRules(holder RunLockHolder, rules *ConcurrencyInfo, active []RunLockHolder) *RunLockConflict {
+	if limit := rules.instanceLimit(); limit > 0 {
+		count := 0
+		var first *RunLockHolder
+		for i := range active {
+			if active[i].ModuleID == holder.ModuleID {
+				if first == nil {
+					first = &active[i]
+				}
+				count++
+			}
+		}
+		if count >= limit {
+			reason := runLockReasonMaxInstances
+			if rules.SingleInstance {
+				reason = runLockReasonSingleInstance
+			}
+			return &RunLockConflict{Reason: reason, Limit: limit, Holder: *first}
+		}
+	}
+
+	for _, group := range holder.Groups {
+		for _, other := range active {
+			for _, otherGroup := range other.Groups {
+				if group == otherGroup {
+					return &RunLockConflict{Reason: runLockReasonExclusiveGroup, Group: group, Holder: other}
+				}
+			}
+		}
+	}
+
+	// Modules launched from within another module are part of that session
+	if maxConcurrentSessions > 0 && holder.Parent == "" {
+		var topLevel []RunLockHolder
+		for _, other := range active {
+			if other.Parent == "" {
+				topLevel = append(topLevel, other)
+			}
+		}
+		if len(topLevel) >= maxConcurrentSessions {
+			return &RunLockConflict{Reason: runLockReasonMaxSessions, Limit: maxConcurrentSessions, Holder: topLevel[0]}
+		}
+	}
+
+	return nil
+}
+
+func sanitizeRunLockValue(value string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(value)
+}
+
+// acquireRunLock checks the concurrency rules of a module against every
+// running GUI and CLI session and records the new session if they allow it
+func acquireRunLock(holder RunLockHolder, rules *ConcurrencyInfo) (*RunLock, error) {
+	if rules != nil {
+		holder.Groups = rules.ExclusiveGroups
+	}
+
+	var lock *RunLock
+	err := withRunLockGuard(func() error {
+		if conflict := checkRunLockRules(holder, rules, readRunLocks()); conflict != nil {
+			return conflict
+		}
+
+		var content strings.Builder
+		fmt.Fprintf(&content, "session_id=%s\n", sanitizeRunLockValue(holder.SessionID))
+		fmt.Fprintf(&content, "module_id=%s\n", sanitizeRunLockValue(holder.ModuleID))
+		fmt.Fprintf(&content, "module_name=%s\n", sanitizeRunLockValue(holder.ModuleName))
+		fmt.Fprintf(&content, "pid=%d\n", holder.PID)
+		fmt.Fprintf(&content, "context=%s\n", sanitizeRunLockValue(holder.Context))
+		fmt.Fprintf(&content, "user=%s\n", sanitizeRunLockValue(holder.User))
+		fmt.Fprintf(&content, "started=%s\n", sanitizeRunLockValue(holder.Started))
+		fmt.Fprintf(&content, "groups=%s\n", sanitizeRunLockValue(strings.Join(holder.Groups, " ")))
+		fmt.Fprintf(&content, "parent=%s\n", sanitizeRunLockValue(holder.Parent))
+
+		path := filepath.Join(runLockDir(), filepath.Base(holder.SessionID)+runLockSuffix)
+		if err := os.WriteFile(path, []byte(content.String()), 0o644); err != nil {
+			return fmt.Errorf("failed to write run lock: %w", err)
+		}
+
+		lock = &RunLock{path: path}
+		return nil
+	})
+
+	return lock, err
+}
+
+// getRunLocks serves GET /api/sessions/locks
+func getRunLocks(c *fiber.Ctx) error {
+	var holders []RunLockHolder
+	if err := withRunLockGuard(func() error {
+		holders = readRunLocks()
+		return nil
+	}); err != nil {
+		log.Printf("Error reading run locks: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read run locks"})
+	}
+
+	if holders == nil {
+		holders = []RunLockHolder{}
+	}
+	return c.JSON(fiber.Map{
+		"locks":        holders,
+		"max_sessions": maxConcurrentSessions,
+	})
+}
@@ -0,0 +1,54 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import "testing"
+
+func TestCheckRunLockRulesInstanceLimits(t *testing.T) {
+	active := []RunLockHolder{
+		{SessionID: "first", ModuleID: "backup", Started: "2025-02-11T03:00:00+01:00"},
+		{SessionID: "second", ModuleID: "backup", Started: "2025-02-11T03:05:00+01:00"},
+		{SessionID: "other", ModuleID: "system_info", Started: "2025-02-11T03:10:00+01:00"},
+	}
+	holder := RunLockHolder{SessionID: "new", ModuleID: "backup"}
+
+	tests := []struct {
+		name   string
+		rules  *ConcurrencyInfo
+		active []RunLockHolder
+		reason string
+		limit  int
+	}{
+		{"single instance", &ConcurrencyInfo{SingleInstance: true}, active[:1], runLockReasonSingleInstance, 1},
+		{"max instances", &ConcurrencyInfo{MaxInstances: 2}, active, runLockReasonMaxInstances, 2},
+		{"max instances not reached", &ConcurrencyInfo{MaxInstances: 3}, active, "", 0},
+		{"no rules", nil, active, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conflict := checkRunLockRules(holder, test.rules, test.active)
+			if test.reason == "" {
+				if conflict != nil {
+					t.Fatalf("unexpected conflict: %v", conflict)
+				}
+				return
+			}
+			if conflict == nil {
+				t.Fatalf("expected a %s conflict", test.reason)
+			}
+			if conflict.Reason != test.reason || conflict.Limit != test.limit {
+				t.Errorf("got reason %q with limit %d, want %q with limit %d", conflict.Reason, conflict.Limit, test.reason, test.limit)
+			}
+			if conflict.Holder.SessionID != "first" {
+				t.Errorf("got holder %s, want the oldest session", conflict.Holder.SessionID)
+			}
+		})
+	}
+}
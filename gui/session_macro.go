@@ -0,0 +1,756 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// A macro is an answer script recorded from a live session: every line sent
+// through POST /api/sessions/:id/input becomes a step whose expect pattern is
+// derived from the output shown just before it. Replaying a macro starts the
+// module again as a scripted run (see session_script.go). Answers to password
+// prompts are not stored: those steps are marked secret and their values have
+// to be supplied for every replay.
+
+const (
+	// macroContextLines is the number of output lines kept as the prompt context of a step
+	macroContextLines = 5
+	macroContextBytes = 2048
+	// macroExpectWords bounds the words of the prompt line used as the expect pattern
+	macroExpectWords = 12
+
+	// macroPendingBytes bounds the output kept between two inputs while recording
+	macroPendingBytes = 16 * 1024
+
+	// Recordings of ended sessions are kept this long for saving
+	macroRecordingRetention = time.Hour
+
+	maxMacroNameLength        = 100
+	maxMacroDescriptionLength = 2000
+)
+
+var (
+	macroIDPattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,127}$`)
+	macroSlugPattern  = regexp.MustCompile(`[^a-z0-9_]+`)
+	macroDigitPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// errMacroForbidden is returned for macros the user may not access
+var errMacroForbidden = errors.New("Access to macro denied")
+
+// MacroStep is a recorded answer with the output that preceded it
+type MacroStep struct {
+	ScriptStep
+	Context string `json:"context,omitempty"` // Last lines shown before the answer; informational only
+	Secret  bool   `json:"secret,omitempty"`  // Answer to a password prompt; Send is empty and supplied on replay
+}
+
+// Macro is a named answer script for one module
+type Macro struct {
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	Description    string      `json:"description,omitempty"`
+	Module         string      `json:"module"`
+	Language       string      `json:"language,omitempty"`
+	Steps          []MacroStep `json:"steps"`
+	TimeoutSeconds int         `json:"timeout_seconds,omitempty"` // Default per-step timeout of the replay
+	Finish         string      `json:"finish"`                    // exit or prompt, as for scripted runs
+	RecordedFrom   string      `json:"recorded_from,omitempty"`   // Session the macro was recorded in
+	CreatedBy      string      `json:"created_by,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// MacroUpdate holds the editable fields of a macro. It is the body of
+// PUT /api/macros/:macroId and, without steps, of saving a recording.
+type MacroUpdate struct {
+	Name           string      `json:"name"`
+	Description    string      `json:"description,omitempty"`
+	Language       string      `json:"language,omitempty"`
+	Steps          []MacroStep `json:"steps,omitempty"`
+	TimeoutSeconds int         `json:"timeout_seconds,omitempty"`
+	Finish         string      `json:"finish,omitempty"`
+}
+
+// MacroRunRequest is the body of POST /api/macros/:macroId/run
+type MacroRunRequest struct {
+	StartModuleRequest
+	Secrets map[int]string `json:"secrets,omitempty"` // Answers of secret steps by step number, starting at 1
+}
+
+// MacroRecording describes a recording in progress
+type MacroRecording struct {
+	SessionID string      `json:"session_id"`
+	Module    string      `json:"module"`
+	Active    bool        `json:"active"` // False once the session has ended
+	StartedAt time.Time   `json:"started_at"`
+	Steps     []MacroStep `json:"steps"`
+	Truncated bool        `json:"truncated,omitempty"` // Inputs beyond maxScriptSteps were not recorded
+}
+
+// macroRecorder collects the inputs of one session
+type macroRecorder struct {
+	mutex     sync.Mutex
+	session   *ModuleSession
+	startedAt time.Time
+	updatedAt time.Time
+	filter    plainTextFilter
+	pending   strings.Builder // Output since the last recorded input
+	steps     []MacroStep
+	truncated bool
+}
+
+var macroRecordings = struct {
+	sync.Mutex
+	recorders map[string]*macroRecorder
+}{recorders: make(map[string]*macroRecorder)}
+
+// macroStoreMutex serializes changes to the macro files
+var macroStoreMutex sync.Mutex
+
+func macroDir() string {
+	return filepath.Join(lhRootDir, "config", "macros")
+}
+
+func macroPath(macroId string) (string, bool) {
+	if !macroIDPattern.MatchString(macroId) {
+		return "", false
+	}
+	return filepath.Join(macroDir(), macroId+".json"), true
+}
+
+// appendOutput adds module output to the context of the next input
+func (r *macroRecorder) appendOutput(data string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pending.WriteString(r.filter.Write(data))
+	if r.pending.Len() > 2*macroPendingBytes {
+		tail := r.pending.String()[r.pending.Len()-macroPendingBytes:]
+		r.pending.Reset()
+		r.pending.WriteString(tail)
+	}
+	r.updatedAt = time.Now()
+}
+
+// recordInput adds a step for every line of an input sent to the session. The
+// answer to a password prompt becomes a single secret step without its value.
+func (r *macroRecorder) recordInput(data string, secret bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	context := promptContext(r.pending.String())
+	r.pending.Reset()
+	r.updatedAt = time.Now()
+
+	if secret {
+		if len(r.steps) >= maxScriptSteps {
+			r.truncated = true
+			return
+		}
+		r.steps = append(r.steps, MacroStep{
+			ScriptStep: ScriptStep{Expect: macroExpect(context)},
+			Context:    context,
+			Secret:     true,
+		})
+		return
+	}
+
+	for _, line := range strings.Split(data, "\n") {
+		if len(r.steps) >= maxScriptSteps {
+			r.truncated = true
+			return
+		}
+		r.steps = append(r.steps, MacroStep{
+			ScriptStep: ScriptStep{Expect: macroExpect(context), Send: strings.TrimRight(line, "\r")},
+			Context:    context,
+		})
+		// Further lines of the same input were typed ahead without a prompt
+		context = ""
+	}
+}
+
+func (r *macroRecorder) snapshot() MacroRecording {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	active := true
+	select {
+	case <-r.session.Done:
+		active = false
+	default:
+	}
+
+	return MacroRecording{
+		SessionID: r.session.ID,
+		Module:    r.session.Module,
+		Active:    active,
+		StartedAt: r.startedAt,
+		Steps:     append([]MacroStep{}, r.steps...),
+		Truncated: r.truncated,
+	}
+}
+
+// promptContext returns the last non-empty lines of output
+func promptContext(output string) string {
+	lines := strings.Split(output, "\n")
+	var context []string
+	for i := len(lines) - 1; i >= 0 && len(context) < macroContextLines; i-- {
+		if line := strings.TrimRight(lines[i], " \t"); strings.TrimSpace(line) != "" {
+			context = append([]string{line}, context...)
+		}
+	}
+
+	text := strings.Join(context, "\n")
+	if len(text) > macroContextBytes {
+		text = text[len(text)-macroContextBytes:]
+	}
+	return text
+}
+
+// macroExpect derives the expect pattern of a step from its context: the last
+// line, with any whitespace between words and any number in place of digits,
+// so that prompts with other counts or sizes still match. An input typed
+// without a prompt in between is expected right away ("^").
+func macroExpect(context string) string {
+	line := context
+	if i := strings.LastIndexByte(context, '\n'); i >= 0 {
+		line = context[i+1:]
+	}
+
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return "^"
+	}
+	if len(words) > macroExpectWords {
+		words = words[len(words)-macroExpectWords:]
+	}
+	for i, word := range words {
+		words[i] = macroDigitPattern.ReplaceAllString(regexp.QuoteMeta(word), `\d+`)
+	}
+	return strings.Join(words, `\s+`)
+}
+
+// scriptSteps returns the steps of a macro as an answer script. Secret steps
+// send the value of their step number in secrets; a missing value is an error.
+func (m *Macro) scriptSteps(secrets map[int]string) ([]ScriptStep, error) {
+	steps := make([]ScriptStep, len(m.Steps))
+	for i, step := range m.Steps {
+		steps[i] = step.ScriptStep
+		if !step.Secret {
+			continue
+		}
+		value, ok := secrets[i+1]
+		if !ok {
+			return nil, fmt.Errorf("step %d answers a password prompt; its value has to be supplied", i+1)
+		}
+		steps[i].Send = value
+	}
+	return steps, nil
+}
+
+// secretSteps returns the numbers of the secret steps, starting at 1
+func (m *Macro) secretSteps() []int {
+	var numbers []int
+	for i, step := range m.Steps {
+		if step.Secret {
+			numbers = append(numbers, i+1)
+		}
+	}
+	return numbers
+}
+
+// validate checks the editable fields and normalizes Finish
+func (m *Macro) validate() error {
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Name == "" || len(m.Name) > maxMacroNameLength || strings.ContainsAny(m.Name, "\r\n") {
+		return fmt.Errorf("name must be a single line of 1 to %d characters", maxMacroNameLength)
+	}
+	if len(m.Description) > maxMacroDescriptionLength {
+		return fmt.Errorf("description is too long (max %d characters)", maxMacroDescriptionLength)
+	}
+	steps := make([]ScriptStep, len(m.Steps))
+	for i, step := range m.Steps {
+		if len(step.Context) > macroContextBytes {
+			return fmt.Errorf("step %d: context is too long (max %d bytes)", i+1, macroContextBytes)
+		}
+		if step.Secret && step.Send != "" {
+			return fmt.Errorf("step %d: secret steps have no send value; remove secret to store the answer", i+1)
+		}
+		steps[i] = step.ScriptStep
+	}
+
+	if _, err := compileScript(RunModuleRequest{Steps: steps, TimeoutSeconds: m.TimeoutSeconds}); err != nil {
+		return err
+	}
+	finish, err := scriptFinish(m.Finish)
+	if err != nil {
+		return err
+	}
+	m.Finish = finish
+	return nil
+}
+
+func (m *Macro) apply(update MacroUpdate) {
+	m.Name = update.Name
+	m.Description = update.Description
+	m.Language = update.Language
+	m.TimeoutSeconds = update.TimeoutSeconds
+	m.Finish = update.Finish
+	if update.Steps != nil {
+		m.Steps = update.Steps
+	}
+}
+
+func loadMacro(macroId string) (Macro, error) {
+	var macro Macro
+
+	path, ok := macroPath(macroId)
+	if !ok {
+		return macro, os.ErrNotExist
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return macro, err
+	}
+	if err := json.Unmarshal(data, &macro); err != nil {
+		return macro, fmt.Errorf("failed to parse macro: %w", err)
+	}
+	macro.ID = macroId
+	return macro, nil
+}
+
+// canAccess reports whether user may see, change and replay the macro. Like
+// the record of a session, it belongs to the user who recorded it.
+func (m *Macro) canAccess(user string) bool {
+	return canAccessRecord(user, m.CreatedBy, nil)
+}
+
+// loadMacroForUser loads a macro and checks that user may access it
+func loadMacroForUser(macroId, user string) (Macro, error) {
+	macro, err := loadMacro(macroId)
+	if err != nil {
+		return macro, err
+	}
+	if !macro.canAccess(user) {
+		return macro, errMacroForbidden
+	}
+	return macro, nil
+}
+
+// macroErrorResponse answers a failed loadMacroForUser
+func macroErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return c.Status(404).JSON(fiber.Map{"error": "Macro not found"})
+	case errors.Is(err, errMacroForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	default:
+		log.Printf("Error reading macro: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read macro"})
+	}
+}
+
+// writeMacro stores a macro; macroStoreMutex must be held
+func writeMacro(macro Macro) error {
+	path, ok := macroPath(macro.ID)
+	if !ok {
+		return fmt.Errorf("invalid macro ID: %s", macro.ID)
+	}
+	if err := os.MkdirAll(macroDir(), 0o755); err != nil {
+		return fmt.Errorf("failed to create macro directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(macro, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write macro: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write macro: %w", err)
+	}
+	return nil
+}
+
+// createMacro assigns an ID derived from the module and name and stores the macro
+func createMacro(macro *Macro) error {
+	macroStoreMutex.Lock()
+	defer macroStoreMutex.Unlock()
+
+	id, err := uniqueStoredID(macro.Module+"-"+macro.Name, "macro", macroPath)
+	if err != nil {
+		return err
+	}
+	macro.ID = id
+	return writeMacro(*macro)
+}
+
+// uniqueStoredID derives a file ID from text that is not taken yet; path maps
+// an ID to its file. The caller must hold the lock of the store.
+func uniqueStoredID(text, fallback string, path func(string) (string, bool)) (string, error) {
+	base := strings.Trim(macroSlugPattern.ReplaceAllString(strings.ToLower(text), "-"), "-_")
+	if len(base) > 100 {
+		base = base[:100]
+	}
+	if base == "" {
+		base = fallback
+	}
+
+	id := base
+	for n := 2; ; n++ {
+		file, ok := path(id)
+		if !ok {
+			return "", fmt.Errorf("invalid ID: %s", id)
+		}
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			return id, nil
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// listMacros returns the stored macros user may access, optionally of one
+// module, sorted by name
+func listMacros(module, user string) ([]Macro, error) {
+	entries, err := os.ReadDir(macroDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Macro{}, nil
+		}
+		return nil, err
+	}
+
+	macros := make([]Macro, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		macro, err := loadMacro(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			log.Printf("Warning: skipping macro %s: %v", name, err)
+			continue
+		}
+		if (module == "" || macro.Module == module) && macro.canAccess(user) {
+			macros = append(macros, macro)
+		}
+	}
+
+	sort.Slice(macros, func(i, j int) bool {
+		return strings.ToLower(macros[i].Name) < strings.ToLower(macros[j].Name)
+	})
+	return macros, nil
+}
+
+// endMacroRecording detaches and returns the recording of a session
+func endMacroRecording(sessionId string) (*macroRecorder, bool) {
+	macroRecordings.Lock()
+	defer macroRecordings.Unlock()
+
+	recorder, exists := macroRecordings.recorders[sessionId]
+	if exists {
+		delete(macroRecordings.recorders, sessionId)
+		recorder.session.recorder.CompareAndSwap(recorder, nil)
+	}
+	return recorder, exists
+}
+
+// startMacroRecording serves POST /api/sessions/:sessionId/recording
+func startMacroRecording(c *fiber.Ctx) error {
+	sessionId := utils.CopyString(c.Params("sessionId"))
+
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(sessionId, user)
+	if err == nil && !session.canControl(user) {
+		err = errSessionObserver
+	}
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	select {
+	case <-session.Done:
+		return c.Status(409).JSON(fiber.Map{"error": "Session has already ended"})
+	default:
+	}
+
+	macroRecordings.Lock()
+	defer macroRecordings.Unlock()
+
+	if _, exists := macroRecordings.recorders[sessionId]; exists {
+		return c.Status(409).JSON(fiber.Map{"error": "Session is already being recorded"})
+	}
+	for id, other := range macroRecordings.recorders {
+		if other.snapshot().Active {
+			continue
+		}
+		other.mutex.Lock()
+		expired := time.Since(other.updatedAt) > macroRecordingRetention
+		other.mutex.Unlock()
+		if expired {
+			delete(macroRecordings.recorders, id)
+		}
+	}
+
+	now := time.Now()
+	recorder := &macroRecorder{session: session, startedAt: now, updatedAt: now}
+
+	// The prompt on screen when recording starts is the context of the first input
+	recorder.mutex.Lock()
+	session.recorder.Store(recorder)
+	recorder.pending.WriteString(recorder.filter.Write(redactSecrets(session.Stream.Recent(macroPendingBytes))))
+	recorder.mutex.Unlock()
+
+	macroRecordings.recorders[sessionId] = recorder
+	log.Printf("Recording inputs of session %s as a macro", sessionId)
+
+	return c.JSON(recorder.snapshot())
+}
+
+// getMacroRecording serves GET /api/sessions/:sessionId/recording
+func getMacroRecording(c *fiber.Ctx) error {
+	macroRecordings.Lock()
+	recorder, exists := macroRecordings.recorders[c.Params("sessionId")]
+	macroRecordings.Unlock()
+
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Recording not found"})
+	}
+	if !recorder.session.canAccess(requestUser(c)) {
+		return sessionErrorResponse(c, errSessionForbidden)
+	}
+	return c.JSON(recorder.snapshot())
+}
+
+// discardMacroRecording serves DELETE /api/sessions/:sessionId/recording
+func discardMacroRecording(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	macroRecordings.Lock()
+	recorder, exists := macroRecordings.recorders[sessionId]
+	macroRecordings.Unlock()
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Recording not found"})
+	}
+	user := requestUser(c)
+	if !recorder.session.canAccess(user) {
+		return sessionErrorResponse(c, errSessionForbidden)
+	}
+	if !recorder.session.canControl(user) {
+		return sessionErrorResponse(c, errSessionObserver)
+	}
+
+	if _, exists := endMacroRecording(sessionId); !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Recording not found"})
+	}
+	return c.JSON(fiber.Map{"status": "discarded"})
+}
+
+// saveMacroRecording serves POST /api/sessions/:sessionId/recording/save. The
+// recording ends and is stored as a new macro.
+func saveMacroRecording(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	var update MacroUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid macro"})
+	}
+
+	macroRecordings.Lock()
+	recorder, exists := macroRecordings.recorders[sessionId]
+	macroRecordings.Unlock()
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Recording not found"})
+	}
+	user := requestUser(c)
+	if !recorder.session.canAccess(user) {
+		return sessionErrorResponse(c, errSessionForbidden)
+	}
+	if !recorder.session.canControl(user) {
+		return sessionErrorResponse(c, errSessionObserver)
+	}
+
+	recording := recorder.snapshot()
+	if len(recording.Steps) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Recording has no inputs"})
+	}
+
+	now := time.Now()
+	macro := Macro{
+		Module:       recording.Module,
+		Language:     recorder.session.Language,
+		RecordedFrom: recording.SessionID,
+		CreatedBy:    user,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	update.Steps = recording.Steps
+	if update.Language == "" {
+		update.Language = macro.Language
+	}
+	if update.Finish == "" {
+		// Menus loop in GUI mode, so a recorded session rarely ends on its own
+		update.Finish = scriptFinishPrompt
+	}
+	macro.apply(update)
+
+	if err := macro.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid macro", "message": err.Error()})
+	}
+	if err := createMacro(&macro); err != nil {
+		log.Printf("Error saving macro: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save macro"})
+	}
+
+	endMacroRecording(sessionId)
+	log.Printf("Saved macro %s with %d steps from session %s", macro.ID, len(macro.Steps), sessionId)
+	return c.JSON(macro)
+}
+
+// getMacros serves GET /api/macros with the macros the user may access,
+// optionally filtered by ?module=
+func getMacros(c *fiber.Ctx) error {
+	macros, err := listMacros(c.Query("module"), requestUser(c))
+	if err != nil {
+		log.Printf("Error listing macros: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list macros"})
+	}
+	return c.JSON(macros)
+}
+
+// getMacro serves GET /api/macros/:macroId
+func getMacro(c *fiber.Ctx) error {
+	macro, err := loadMacroForUser(c.Params("macroId"), requestUser(c))
+	if err != nil {
+		return macroErrorResponse(c, err)
+	}
+	return c.JSON(macro)
+}
+
+// updateMacro serves PUT /api/macros/:macroId. Every editable field is
+// replaced; steps are kept when omitted.
+func updateMacro(c *fiber.Ctx) error {
+	macroId := c.Params("macroId")
+
+	var update MacroUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid macro"})
+	}
+
+	macroStoreMutex.Lock()
+	defer macroStoreMutex.Unlock()
+
+	macro, err := loadMacroForUser(macroId, requestUser(c))
+	if err != nil {
+		return macroErrorResponse(c, err)
+	}
+
+	macro.apply(update)
+	if err := macro.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid macro", "message": err.Error()})
+	}
+	macro.UpdatedAt = time.Now()
+
+	if err := writeMacro(macro); err != nil {
+		log.Printf("Error saving macro: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save macro"})
+	}
+	return c.JSON(macro)
+}
+
+// deleteMacro serves DELETE /api/macros/:macroId
+func deleteMacro(c *fiber.Ctx) error {
+	macroId := c.Params("macroId")
+
+	path, ok := macroPath(macroId)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Macro not found"})
+	}
+
+	macroStoreMutex.Lock()
+	defer macroStoreMutex.Unlock()
+
+	if _, err := loadMacroForUser(macroId, requestUser(c)); err != nil {
+		return macroErrorResponse(c, err)
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.Status(404).JSON(fiber.Map{"error": "Macro not found"})
+		}
+		log.Printf("Error deleting macro: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete macro"})
+	}
+	return c.JSON(fiber.Map{"status": "deleted", "macro_id": macroId})
+}
+
+// runMacro serves POST /api/macros/:macroId/run. The module of the macro is
+// started again and the recorded answers are sent as a scripted run; the body
+// may override the language and terminal settings and supplies the answers of
+// secret steps.
+func runMacro(c *fiber.Ctx) error {
+	macro, err := loadMacroForUser(c.Params("macroId"), requestUser(c))
+	if err != nil {
+		return macroErrorResponse(c, err)
+	}
+
+	var req MacroRunRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid run request"})
+		}
+	}
+	if req.Language == "" {
+		req.Language = macro.Language
+	}
+
+	steps, err := macro.scriptSteps(req.Secrets)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":        "Secret values missing",
+			"message":      err.Error(),
+			"secret_steps": macro.secretSteps(),
+		})
+	}
+
+	run, startErr := startScriptRun(macro.Module, RunModuleRequest{
+		StartModuleRequest: req.StartModuleRequest,
+		Steps:              steps,
+		TimeoutSeconds:     macro.TimeoutSeconds,
+		Finish:             macro.Finish,
+	}, requestUser(c))
+	if startErr != nil {
+		return c.Status(startErr.status).JSON(startErr.body)
+	}
+
+	log.Printf("Replaying macro %s in session %s", macro.ID, run.session.ID)
+	return c.JSON(fiber.Map{
+		"sessionId": run.session.ID,
+		"macro":     macro.ID,
+		"run":       run.snapshot(),
+	})
+}
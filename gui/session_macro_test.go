@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// recordLine sends a line through the redactor and the recorder as sendInput does
+func recordLine(session *ModuleSession, recorder *macroRecorder, line string) {
+	redacted, secret := session.redactor.Line(line)
+	recorder.recordInput(redacted, secret)
+}
+
+func TestMacroRecordingPasswordPrompt(t *testing.T) {
+	lhRootDir = t.TempDir()
+
+	session := &ModuleSession{ID: "test", Module: "backup", Done: make(chan struct{})}
+	recorder := &macroRecorder{session: session}
+	output := func(data string) {
+		recorder.appendOutput(session.redactor.Output(data))
+	}
+
+	output("Backup target: ")
+	recordLine(session, recorder, "/mnt/nas")
+	output("/mnt/nas\r\nPassword for backup@nas: ")
+	recordLine(session, recorder, "hunter2")
+	output("\r\nBackup finished.\r\nContinue? [y/N] ")
+	recordLine(session, recorder, "n")
+
+	macro := Macro{Name: "Backup to NAS", Module: "backup", Steps: recorder.snapshot().Steps}
+	if err := macro.validate(); err != nil {
+		t.Fatalf("recorded macro is invalid: %v", err)
+	}
+	if err := createMacro(&macro); err != nil {
+		t.Fatalf("could not save macro: %v", err)
+	}
+
+	saved, err := loadMacro(macro.ID)
+	if err != nil {
+		t.Fatalf("could not load macro: %v", err)
+	}
+	if len(saved.Steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(saved.Steps))
+	}
+	step := saved.Steps[1]
+	if !step.Secret || step.Send != "" {
+		t.Errorf("password step was saved as secret=%v send=%q, want a secret step without value", step.Secret, step.Send)
+	}
+	if step.Expect == "^" || !strings.Contains(step.Context, "Password for backup@nas:") {
+		t.Errorf("password step lost its prompt: expect %q, context %q", step.Expect, step.Context)
+	}
+	if saved.Steps[0].Secret || saved.Steps[0].Send != "/mnt/nas" || saved.Steps[2].Secret || saved.Steps[2].Send != "n" {
+		t.Errorf("other steps changed: %+v", saved.Steps)
+	}
+
+	path, _ := macroPath(macro.ID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), redactedText) {
+		t.Errorf("macro file contains the password or its placeholder:\n%s", data)
+	}
+
+	// Replay and scheduling need the value of the secret step
+	if _, err := saved.scriptSteps(nil); err == nil {
+		t.Error("replay without the secret value was accepted")
+	}
+	steps, err := saved.scriptSteps(map[int]string{2: "hunter2"})
+	if err != nil {
+		t.Fatalf("replay with the secret value failed: %v", err)
+	}
+	if steps[1].Send != "hunter2" {
+		t.Errorf("secret step sends %q, want the supplied value", steps[1].Send)
+	}
+	if numbers := saved.secretSteps(); len(numbers) != 1 || numbers[0] != 2 {
+		t.Errorf("got secret steps %v, want [2]", numbers)
+	}
+}
+
+func TestMacroRecordingRedactPattern(t *testing.T) {
+	previous := redactPattern
+	redactPattern = regexp.MustCompile(`api_key=(\S+)`)
+	defer func() { redactPattern = previous }()
+
+	session := &ModuleSession{ID: "test", Module: "backup", Done: make(chan struct{})}
+	recorder := &macroRecorder{session: session}
+
+	recorder.appendOutput(session.redactor.Output("Upload options: "))
+	recordLine(session, recorder, "--api_key=abc123 --verbose")
+	recorder.appendOutput(session.redactor.Output("\r\nTarget: "))
+	recordLine(session, recorder, "nas")
+
+	steps := recorder.snapshot().Steps
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(steps))
+	}
+	if !steps[0].Secret || steps[0].Send != "" {
+		t.Errorf("redacted line was recorded as secret=%v send=%q, want a secret step without value", steps[0].Secret, steps[0].Send)
+	}
+	if steps[1].Secret || steps[1].Send != "nas" {
+		t.Errorf("unchanged line was recorded as secret=%v send=%q", steps[1].Secret, steps[1].Send)
+	}
+}
+
+func TestMacroValidateSecretStepWithValue(t *testing.T) {
+	macro := Macro{
+		Name:   "Stored secret",
+		Module: "backup",
+		Steps:  []MacroStep{{ScriptStep: ScriptStep{Expect: "Password:", Send: "hunter2"}, Secret: true}},
+	}
+	if err := macro.validate(); err == nil {
+		t.Error("secret step with a stored value was accepted")
+	}
+}
@@ -0,0 +1,438 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// terminateGracePeriod is how long processes get to exit after SIGTERM
+	terminateGracePeriod = 2 * time.Second
+	// killWaitPeriod is how long to wait for processes to disappear after SIGKILL
+	killWaitPeriod = time.Second
+	// processPollInterval is how often /proc is checked while waiting
+	processPollInterval = 100 * time.Millisecond
+)
+
+// ProcessInfo describes one process of a module session, read from /proc
+type ProcessInfo struct {
+	PID      int            `json:"pid"`
+	PPID     int            `json:"ppid"`
+	PGID     int            `json:"pgid"`
+	SID      int            `json:"sid"`
+	State    string         `json:"state"`
+	Command  string         `json:"command"`
+	Cmdline  string         `json:"cmdline,omitempty"`
+	Children []*ProcessInfo `json:"children,omitempty"`
+
+	startTime uint64 // Distinguishes the process from a later one reusing its PID
+	cpuTicks  uint64 // User and system time in clock ticks
+	rssPages  uint64
+}
+
+// readProcess parses /proc/<pid>/stat and /proc/<pid>/cmdline
+func readProcess(pid int) (*ProcessInfo, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name is in parentheses and may itself contain spaces or parentheses
+	stat := string(data)
+	open := strings.IndexByte(stat, '(')
+	closing := strings.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	info := &ProcessInfo{
+		PID:     pid,
+		State:   fields[0],
+		Command: stat[open+1 : closing],
+	}
+	info.PPID, _ = strconv.Atoi(fields[1])
+	info.PGID, _ = strconv.Atoi(fields[2])
+	info.SID, _ = strconv.Atoi(fields[3])
+	info.startTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	info.cpuTicks = utime + stime
+	info.rssPages, _ = strconv.ParseUint(fields[21], 10, 64)
+
+	if cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		info.Cmdline = strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	}
+
+	return info, nil
+}
+
+// listProcesses returns all processes currently visible in /proc
+func listProcesses() map[int]*ProcessInfo {
+	processes := make(map[int]*ProcessInfo)
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		log.Printf("Warning: could not read /proc: %v", err)
+		return processes
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if info, err := readProcess(pid); err == nil {
+			processes[pid] = info
+		}
+	}
+	return processes
+}
+
+// sessionProcesses returns the processes that belong to the session led by
+// leaderPid: every process in its terminal session plus descendants that
+// started a session of their own. Zombies are left out.
+func sessionProcesses(leaderPid int) []*ProcessInfo {
+	processes := listProcesses()
+
+	children := make(map[int][]int)
+	for pid, info := range processes {
+		children[info.PPID] = append(children[info.PPID], pid)
+	}
+
+	member := make(map[int]bool)
+	for pid, info := range processes {
+		if info.SID == leaderPid {
+			member[pid] = true
+		}
+	}
+
+	// Walk the parent links from the leader and from every session member
+	queue := []int{leaderPid}
+	for pid := range member {
+		queue = append(queue, pid)
+	}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if _, ok := processes[pid]; ok {
+			member[pid] = true
+		}
+		for _, child := range children[pid] {
+			if !member[child] {
+				member[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	result := make([]*ProcessInfo, 0, len(member))
+	for pid := range member {
+		if info := processes[pid]; info.State != "Z" {
+			result = append(result, info)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PID < result[j].PID })
+	return result
+}
+
+// buildProcessTree nests processes under their parents. Processes whose parent
+// is not part of the list, e.g. orphans adopted by init, become roots.
+func buildProcessTree(processes []*ProcessInfo) []*ProcessInfo {
+	byPid := make(map[int]*ProcessInfo, len(processes))
+	for _, info := range processes {
+		byPid[info.PID] = info
+	}
+
+	roots := make([]*ProcessInfo, 0)
+	for _, info := range processes {
+		if parent, ok := byPid[info.PPID]; ok && parent != info {
+			parent.Children = append(parent.Children, info)
+		} else {
+			roots = append(roots, info)
+		}
+	}
+	return roots
+}
+
+// isAlive reports whether the process still exists and has not been replaced
+func (p *ProcessInfo) isAlive() bool {
+	current, err := readProcess(p.PID)
+	if err != nil {
+		return false
+	}
+	return current.startTime == p.startTime && current.State != "Z"
+}
+
+func aliveProcesses(processes []*ProcessInfo) []*ProcessInfo {
+	alive := make([]*ProcessInfo, 0, len(processes))
+	for _, info := range processes {
+		if info.isAlive() {
+			alive = append(alive, info)
+		}
+	}
+	return alive
+}
+
+func signalProcesses(processes []*ProcessInfo, sig unix.Signal) {
+	for _, info := range processes {
+		if err := unix.Kill(info.PID, sig); err != nil && err != unix.ESRCH {
+			log.Printf("Could not send %s to pid %d (%s): %v", unix.SignalName(sig), info.PID, info.Command, err)
+		}
+	}
+}
+
+// waitForExit polls until none of the processes is alive or the timeout expires
+func waitForExit(processes []*ProcessInfo, timeout time.Duration) []*ProcessInfo {
+	deadline := time.Now().Add(timeout)
+	for {
+		processes = aliveProcesses(processes)
+		if len(processes) == 0 || time.Now().After(deadline) {
+			return processes
+		}
+		time.Sleep(processPollInterval)
+	}
+}
+
+// mergeProcesses returns the union of two process lists by PID
+func mergeProcesses(a, b []*ProcessInfo) []*ProcessInfo {
+	seen := make(map[int]bool, len(a))
+	merged := append([]*ProcessInfo(nil), a...)
+	for _, info := range a {
+		seen[info.PID] = true
+	}
+	for _, info := range b {
+		if !seen[info.PID] {
+			merged = append(merged, info)
+		}
+	}
+	return merged
+}
+
+// pid returns the PID of the session leader, or 0 if the module never started
+func (s *ModuleSession) pid() int {
+	if s.rootHelper != nil {
+		return s.rootHelper.pid
+	}
+	if s.Process == nil || s.Process.Process == nil {
+		return 0
+	}
+	return s.Process.Process.Pid
+}
+
+// terminate stops every process of the session, through the root helper for
+// privileged sessions, and returns the processes that survived
+func (s *ModuleSession) terminate() []*ProcessInfo {
+	if s.rootHelper != nil {
+		survivors, err := s.rootHelper.terminate()
+		if err != nil {
+			log.Printf("Root helper could not terminate session %s: %v", s.ID, err)
+		}
+		return survivors
+	}
+	return terminateProcessTree(s.ID, s.pid())
+}
+
+// signal sends sig to a process, or to a process group if target is negative
+func (s *ModuleSession) signal(target int, sig unix.Signal) error {
+	if s.rootHelper != nil {
+		return s.rootHelper.signal(target, sig)
+	}
+	return unix.Kill(target, sig)
+}
+
+// terminateProcessTree stops every process of a module. The module runs as the
+// leader of its own terminal session and process group, so the whole group
+// receives SIGTERM first; whatever is still alive after terminateGracePeriod,
+// including children that moved to a group or session of their own, gets
+// SIGKILL. The processes that survived both are returned.
+func terminateProcessTree(label string, leader int) []*ProcessInfo {
+	if leader <= 0 {
+		return nil
+	}
+
+	targets := sessionProcesses(leader)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	if err := unix.Kill(-leader, unix.SIGTERM); err != nil && err != unix.ESRCH {
+		log.Printf("Could not signal process group %d of session %s: %v", leader, label, err)
+	}
+	signalProcesses(targets, unix.SIGTERM)
+
+	// Resume suspended processes so they can act on SIGTERM
+	_ = unix.Kill(-leader, unix.SIGCONT)
+	signalProcesses(targets, unix.SIGCONT)
+
+	remaining := waitForExit(targets, terminateGracePeriod)
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	// Processes may have forked while shutting down; pick those up as well
+	remaining = mergeProcesses(remaining, sessionProcesses(leader))
+	log.Printf("Session %s: %d processes ignored SIGTERM, sending SIGKILL", label, len(remaining))
+	signalProcesses(remaining, unix.SIGKILL)
+
+	survivors := waitForExit(remaining, killWaitPeriod)
+	for _, info := range survivors {
+		log.Printf("Session %s: process %d (%s) survived SIGKILL", label, info.PID, info.Command)
+	}
+	return survivors
+}
+
+// sessionSignals are the signals clients may deliver to a session
+var sessionSignals = map[string]unix.Signal{
+	"SIGINT":  unix.SIGINT,
+	"SIGTSTP": unix.SIGTSTP,
+	"SIGCONT": unix.SIGCONT,
+	"SIGHUP":  unix.SIGHUP,
+	"SIGQUIT": unix.SIGQUIT,
+}
+
+// SignalRequest is the body of POST /api/sessions/:sessionId/signal
+type SignalRequest struct {
+	Signal string `json:"signal"` // e.g. "SIGINT" or "INT"
+}
+
+// parseSessionSignal accepts signal names with or without the SIG prefix
+func parseSessionSignal(name string) (unix.Signal, string, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := sessionSignals[name]
+	return sig, name, ok
+}
+
+// foregroundProcessGroup returns the process group that currently owns the
+// session terminal, i.e. the command the module is waiting for
+func (s *ModuleSession) foregroundProcessGroup() (int, error) {
+	if s.PTY == nil {
+		return 0, fmt.Errorf("session has no terminal")
+	}
+
+	// Use the raw descriptor without Fd(), which would switch the PTY to blocking mode
+	conn, err := s.PTY.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var pgid int
+	var ioctlErr error
+	if err := conn.Control(func(fd uintptr) {
+		pgid, ioctlErr = unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+	}); err != nil {
+		return 0, err
+	}
+	if ioctlErr != nil {
+		return 0, ioctlErr
+	}
+	if pgid <= 0 {
+		return 0, fmt.Errorf("terminal has no foreground process group")
+	}
+	return pgid, nil
+}
+
+// signalSession serves POST /api/sessions/:sessionId/signal
+func signalSession(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	var req SignalRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid signal request"})
+	}
+
+	sig, name, ok := parseSessionSignal(req.Signal)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unsupported signal %q (allowed: SIGINT, SIGTSTP, SIGCONT, SIGHUP, SIGQUIT)", req.Signal),
+		})
+	}
+
+	user := requestUser(c)
+	session, err := sessionManager.lookupSessionForUser(sessionId, user)
+	if err == nil && !session.canControl(user) {
+		err = errSessionObserver
+	}
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+
+	select {
+	case <-session.Done:
+		return c.Status(409).JSON(fiber.Map{"error": "Session has already ended"})
+	default:
+	}
+
+	pgid, err := session.foregroundProcessGroup()
+	if err != nil {
+		log.Printf("Could not determine foreground process group of session %s: %v", sessionId, err)
+		return c.Status(409).JSON(fiber.Map{"error": "Session terminal is not available"})
+	}
+
+	// The module's parent is the GUI server in another terminal session, so its
+	// process groups are orphaned and the kernel discards SIGTSTP for them.
+	// Suspend with SIGSTOP instead, which cannot be discarded.
+	delivered := sig
+	if sig == unix.SIGTSTP {
+		delivered = unix.SIGSTOP
+	}
+
+	if err := session.signal(-pgid, delivered); err != nil {
+		log.Printf("Failed to send %s to process group %d of session %s: %v", name, pgid, sessionId, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to deliver signal"})
+	}
+
+	log.Printf("Sent %s to process group %d of session %s", unix.SignalName(delivered), pgid, sessionId)
+	return c.JSON(fiber.Map{
+		"status":    "sent",
+		"signal":    name,
+		"delivered": unix.SignalName(delivered),
+		"pgid":      pgid,
+	})
+}
+
+// getSessionProcesses serves GET /api/sessions/:sessionId/processes
+func getSessionProcesses(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	session, err := sessionManager.lookupSessionForUser(sessionId, requestUser(c))
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+
+	processes := make([]*ProcessInfo, 0)
+	if leader := session.pid(); leader > 0 {
+		processes = sessionProcesses(leader)
+	}
+
+	return c.JSON(fiber.Map{
+		"session_id": session.ID,
+		"pid":        session.pid(),
+		"count":      len(processes),
+		"processes":  buildProcessTree(processes),
+	})
+}
@@ -0,0 +1,169 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	redactedText = "[REDACTED]"
+
+	// redactTailBytes is how much of the last output line is kept to detect prompts
+	redactTailBytes = 512
+
+	defaultSecretPromptPattern = `(?i)(password|passphrase|passwort|kennwort|passwd|pin|secret|token)[^:\n]*:\s*$`
+)
+
+// Terminal I/O settings from general.d/30-gui.conf
+var (
+	// logTerminalIO writes the (redacted) content of input and output to the
+	// server log; otherwise only sizes are logged
+	logTerminalIO = false
+
+	// secretPromptPattern matches the last output line when the module asks for
+	// a password; the next input line is redacted
+	secretPromptPattern = regexp.MustCompile(defaultSecretPromptPattern)
+
+	// redactPattern matches secrets in input and output; nil disables it. If it
+	// has capture groups, only the groups are replaced.
+	redactPattern *regexp.Regexp
+)
+
+// sessionRedactor tracks what has to be redacted from one session before its
+// input and output reach the server log, transcripts or macro recordings. The
+// live terminal output sent to subscribers is not changed.
+type sessionRedactor struct {
+	mutex  sync.Mutex
+	filter plainTextFilter
+	tail   string // Last output line without ANSI codes
+
+	secretPending bool // The module waits for a password
+	secretInput   bool // Raw input is part of a password line
+	secretEcho    bool // Output up to the next newline echoes a password
+}
+
+// Output returns data with secrets removed and updates the prompt state
+func (r *sessionRedactor) Output(data string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	redacted := data
+	if r.secretEcho {
+		line, rest, complete := strings.Cut(data, "\n")
+		if strings.TrimSpace(stripANSI(line)) != "" {
+			redacted = redactedText
+			if complete {
+				if strings.HasSuffix(line, "\r") {
+					redacted += "\r"
+				}
+				redacted += "\n" + rest
+			}
+		}
+		r.secretEcho = !complete
+	}
+	redacted = redactSecrets(redacted)
+
+	text := r.filter.Write(data)
+	if index := strings.LastIndexByte(text, '\n'); index >= 0 {
+		r.tail = text[index+1:]
+	} else {
+		r.tail += text
+	}
+	if len(r.tail) > redactTailBytes {
+		r.tail = r.tail[len(r.tail)-redactTailBytes:]
+	}
+	if text != "" {
+		r.secretPending = secretPromptPattern.MatchString(r.tail)
+	}
+	return redacted
+}
+
+// Line returns an input line, as sent by POST /api/sessions/:sessionId/input,
+// with secrets removed. The answer to a password prompt is replaced entirely.
+// A line that was changed is reported as secret.
+func (r *sessionRedactor) Line(data string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.secretPending || r.secretInput {
+		r.secretPending = false
+		r.secretInput = false
+		r.secretEcho = true
+		return redactedText, true
+	}
+	redacted := redactSecrets(data)
+	return redacted, redacted != data
+}
+
+// Keys returns raw terminal input with secrets removed. Keystrokes typed at a
+// password prompt are replaced until Enter is pressed.
+func (r *sessionRedactor) Keys(data string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.secretPending {
+		r.secretPending = false
+		r.secretInput = true
+	}
+	if !r.secretInput {
+		return redactSecrets(data)
+	}
+
+	end := strings.IndexAny(data, "\r\n")
+	if end < 0 {
+		return redactedText
+	}
+	r.secretInput = false
+	r.secretEcho = true
+	return redactedText + redactSecrets(data[end:])
+}
+
+// Screen returns lines of the terminal screen with secrets removed, without
+// changing the prompt state. A line below a password prompt is replaced in
+// case the module echoed the password.
+func (r *sessionRedactor) Screen(lines []string) []string {
+	redacted := make([]string, len(lines))
+	for i, line := range lines {
+		if i > 0 && secretPromptPattern.MatchString(lines[i-1]) {
+			redacted[i] = redactedText
+			continue
+		}
+		redacted[i] = redactSecrets(line)
+	}
+	return redacted
+}
+
+// redactSecrets applies the configured redaction pattern
+func redactSecrets(data string) string {
+	if redactPattern == nil {
+		return data
+	}
+	if redactPattern.NumSubexp() == 0 {
+		return redactPattern.ReplaceAllLiteralString(data, redactedText)
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, match := range redactPattern.FindAllStringSubmatchIndex(data, -1) {
+		for group := 1; group <= redactPattern.NumSubexp(); group++ {
+			start, end := match[2*group], match[2*group+1]
+			if start < last || start < 0 {
+				continue
+			}
+			result.WriteString(data[last:start])
+			result.WriteString(redactedText)
+			last = end
+		}
+	}
+	result.WriteString(data[last:])
+	return result.String()
+}
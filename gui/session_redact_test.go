@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactorPasswordLine(t *testing.T) {
+	var r sessionRedactor
+
+	if got := r.Output("Backup target: "); got != "Backup target: " {
+		t.Errorf("ordinary output changed to %q", got)
+	}
+	if got, secret := r.Line("/mnt/nas"); got != "/mnt/nas" || secret {
+		t.Errorf("ordinary input = %q, secret %v", got, secret)
+	}
+
+	// The prompt arrives in pieces and in colour
+	r.Output("/mnt/nas\r\n\x1b[1mPass")
+	r.Output("word for backup@nas:\x1b[0m ")
+	if got, secret := r.Line("hunter2"); got != redactedText || !secret {
+		t.Errorf("password = %q, secret %v; want it redacted", got, secret)
+	}
+
+	// A module that echoes the password has it replaced up to the newline
+	if got := r.Output("hun"); got != redactedText {
+		t.Errorf("first part of the echo = %q", got)
+	}
+	if got := r.Output("ter2\r\nConnected.\r\nContinue? "); got != redactedText+"\r\nConnected.\r\nContinue? " {
+		t.Errorf("rest of the echo = %q", got)
+	}
+
+	if got, secret := r.Line("y"); got != "y" || secret {
+		t.Errorf("input after the password = %q, secret %v", got, secret)
+	}
+}
+
+func TestRedactorPromptNotAtEnd(t *testing.T) {
+	var r sessionRedactor
+
+	// The prompt has been answered on the same line or scrolled away
+	for _, output := range []string{"Password: set\r\n", "Token: none\r\nName: "} {
+		r.Output(output)
+		if got, secret := r.Line("alice"); got != "alice" || secret {
+			t.Errorf("after %q the input was redacted to %q", output, got)
+		}
+	}
+}
+
+func TestRedactorKeys(t *testing.T) {
+	var r sessionRedactor
+
+	r.Output("Enter passphrase for key: ")
+	for _, keys := range []string{"h", "unter"} {
+		if got := r.Keys(keys); got != redactedText {
+			t.Errorf("Keys(%q) = %q, want it redacted", keys, got)
+		}
+	}
+	if got := r.Keys("2\r"); got != redactedText+"\r" {
+		t.Errorf("Keys with Enter = %q, want the Enter kept", got)
+	}
+	if got := r.Output("\r\n"); got != "\r\n" {
+		t.Errorf("empty echo line = %q", got)
+	}
+
+	r.Output("$ ")
+	if got := r.Keys("ls\r"); got != "ls\r" {
+		t.Errorf("keys after the password = %q", got)
+	}
+}
+
+func TestRedactorScreen(t *testing.T) {
+	var r sessionRedactor
+
+	lines := []string{"Connecting to nas", "Password:", "hunter2", "Welcome"}
+	got := r.Screen(lines)
+	want := []string{"Connecting to nas", "Password:", redactedText, "Welcome"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, secret := r.Line("n"); got != "n" || secret {
+		t.Error("Screen changed the prompt state")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	previous := redactPattern
+	defer func() { redactPattern = previous }()
+
+	tests := []struct {
+		pattern string
+		input   string
+		want    string
+	}{
+		{`sk-[a-z0-9]+`, "key sk-abc123 and sk-def", "key [REDACTED] and [REDACTED]"},
+		{`token=(\S+)`, "url?token=abc&x=1 token=def", "url?token=[REDACTED] token=[REDACTED]"},
+		{`user=(\w+) pass=(\w+)`, "user=alice pass=hunter2", "user=[REDACTED] pass=[REDACTED]"},
+		{`token=(\S+)`, "nothing to hide", "nothing to hide"},
+	}
+	for _, test := range tests {
+		redactPattern = regexp.MustCompile(test.pattern)
+		if got := redactSecrets(test.input); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.pattern, got, test.want)
+		}
+	}
+
+	redactPattern = nil
+	if got := redactSecrets("token=abc"); got != "token=abc" {
+		t.Errorf("without a pattern got %q", got)
+	}
+}
@@ -0,0 +1,538 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Each module session can get its own cgroup v2 leaf with a CPU weight, a
+// memory limit and an IO weight. The GUI needs a delegated cgroup for that,
+// e.g. a systemd service with Delegate=yes: at startup it moves itself into
+// the leaf "llh-server" and creates "llh-session-<id>" next to it for every
+// session. Without cgroups the CPU and IO weights are approximated with nice
+// and ionice; memory is then not limited.
+const (
+	cgroupModeAuto = "auto" // Use a cgroup only if it is delegated to the GUI
+	cgroupModeOn   = "on"   // Use the current cgroup even if it is not marked as delegated
+	cgroupModeOff  = "off"
+
+	resourceModeCgroup = "cgroup"
+	resourceModeNice   = "nice"
+	resourceModeNone   = "none"
+
+	cgroupServerLeaf    = "llh-server"
+	cgroupSessionPrefix = "llh-session-"
+
+	defaultResourceWeight = 100
+	minResourceWeight     = 1
+	maxResourceWeight     = 10000
+)
+
+var memorySizePattern = regexp.MustCompile(`^(?i)(\d+)\s*([kmgt]?)i?b?$`)
+
+// cgroupBase is the delegated cgroup session leaves are created in; path is
+// empty when cgroups are not used
+var cgroupBase struct {
+	path        string
+	controllers map[string]bool
+	cloneInto   bool // The kernel can start processes directly in a cgroup
+}
+
+// ResourceLimits are the resource settings of a session, from module metadata
+// ("resources") and the start request. Zero values are not set.
+type ResourceLimits struct {
+	CPUWeight int    `json:"cpu_weight,omitempty"` // 1-10000, default 100
+	MemoryMax string `json:"memory_max,omitempty"` // Bytes with optional K/M/G/T suffix, or "max"
+	IOWeight  int    `json:"io_weight,omitempty"`  // 1-10000, default 100
+}
+
+// validate checks the ranges and the memory size
+func (l *ResourceLimits) validate() error {
+	if l.CPUWeight != 0 && (l.CPUWeight < minResourceWeight || l.CPUWeight > maxResourceWeight) {
+		return fmt.Errorf("cpu_weight must be between %d and %d", minResourceWeight, maxResourceWeight)
+	}
+	if l.IOWeight != 0 && (l.IOWeight < minResourceWeight || l.IOWeight > maxResourceWeight) {
+		return fmt.Errorf("io_weight must be between %d and %d", minResourceWeight, maxResourceWeight)
+	}
+	if _, err := parseMemorySize(l.MemoryMax); err != nil {
+		return err
+	}
+	return nil
+}
+
+// mergeResourceLimits returns the module settings with the values set in the
+// start request taking precedence
+func mergeResourceLimits(module, request *ResourceLimits) ResourceLimits {
+	var limits ResourceLimits
+	for _, source := range []*ResourceLimits{module, request} {
+		if source == nil {
+			continue
+		}
+		if source.CPUWeight != 0 {
+			limits.CPUWeight = source.CPUWeight
+		}
+		if source.MemoryMax != "" {
+			limits.MemoryMax = source.MemoryMax
+		}
+		if source.IOWeight != 0 {
+			limits.IOWeight = source.IOWeight
+		}
+	}
+	return limits
+}
+
+// parseMemorySize returns the size in bytes; 0 means no limit
+func parseMemorySize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "max") {
+		return 0, nil
+	}
+	match := memorySizePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid memory_max %q (use bytes with an optional K, M, G or T suffix, or \"max\")", value)
+	}
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory_max %q", value)
+	}
+	shift := strings.Index("kmgt", strings.ToLower(match[2])) + 1
+	if match[2] != "" {
+		if size > math.MaxInt64>>(10*shift) {
+			return 0, fmt.Errorf("memory_max %q is too large", value)
+		}
+		size <<= 10 * shift
+	}
+	if size < 1<<20 {
+		return 0, fmt.Errorf("memory_max %q is below 1M", value)
+	}
+	return size, nil
+}
+
+// initCgroups looks for a usable cgroup v2 hierarchy and prepares it for
+// session leaves. Errors only disable cgroups.
+func initCgroups(mode string) {
+	if mode == cgroupModeOff {
+		return
+	}
+
+	mount, err := cgroup2Mount()
+	if err != nil {
+		log.Printf("Cgroups not used for sessions: %v", err)
+		return
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		log.Printf("Cgroups not used for sessions: %v", err)
+		return
+	}
+	if own == "/" {
+		log.Printf("Cgroups not used for sessions: the server runs in the root cgroup")
+		return
+	}
+	base := filepath.Join(mount, own)
+	if filepath.Base(base) == cgroupServerLeaf {
+		// Restarted inside the leaf created by an earlier run
+		base = filepath.Dir(base)
+	}
+
+	if mode == cgroupModeAuto && !cgroupDelegated(base) {
+		log.Printf("Cgroups not used for sessions: %s is not delegated to this process (set CFG_LH_GUI_CGROUPS=\"on\" to use it anyway)", base)
+		return
+	}
+
+	// A cgroup with processes cannot distribute resources to children, so the
+	// server moves into a leaf of its own first
+	server := filepath.Join(base, cgroupServerLeaf)
+	if err := os.Mkdir(server, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		log.Printf("Cgroups not used for sessions: %v", err)
+		return
+	}
+	if err := moveProcessesToLeaf(base, server); err != nil {
+		log.Printf("Cgroups not used for sessions: %v", err)
+		return
+	}
+
+	controllers := make(map[string]bool)
+	available, _ := os.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	for _, name := range strings.Fields(string(available)) {
+		if name != "cpu" && name != "memory" && name != "io" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(base, "cgroup.subtree_control"), []byte("+"+name), 0); err != nil {
+			log.Printf("Warning: could not enable the %s controller for sessions: %v", name, err)
+			continue
+		}
+		controllers[name] = true
+	}
+
+	cgroupBase.path = base
+	cgroupBase.controllers = controllers
+	cgroupBase.cloneInto = kernelAtLeast(5, 7)
+	names := make([]string, 0, len(controllers))
+	for name := range controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Printf("Sessions run in cgroups below %s (controllers: %s)", base, strings.Join(names, " "))
+}
+
+// cgroup2Mount returns the mount point of the cgroup v2 hierarchy
+func cgroup2Mount() (string, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Optional fields end with "-", followed by the filesystem type
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" && len(fields) > 4 {
+				return fields[4], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy is mounted")
+}
+
+// ownCgroup returns the cgroup v2 path of the server process
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("the server is not in a cgroup v2 hierarchy")
+}
+
+// cgroupDelegated reports whether the cgroup was handed to this process: owned
+// by its unprivileged user, or marked by systemd (Delegate=yes)
+func cgroupDelegated(path string) bool {
+	for _, attribute := range []string{"trusted.delegate", "user.delegate"} {
+		if _, err := unix.Getxattr(path, attribute, nil); err == nil {
+			return true
+		}
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return false
+	}
+	return os.Geteuid() != 0 && stat.Uid == uint32(os.Geteuid())
+}
+
+// moveProcessesToLeaf moves every process of the cgroup from into to
+func moveProcessesToLeaf(from, to string) error {
+	data, err := os.ReadFile(filepath.Join(from, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, pid := range strings.Fields(string(data)) {
+		if err := os.WriteFile(filepath.Join(to, "cgroup.procs"), []byte(pid), 0); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("could not move process %s into %s: %w", pid, to, err)
+		}
+	}
+	return nil
+}
+
+func kernelAtLeast(major, minor int) bool {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return false
+	}
+	var kernelMajor, kernelMinor int
+	fmt.Sscanf(unix.ByteSliceToString(uname.Release[:]), "%d.%d", &kernelMajor, &kernelMinor)
+	return kernelMajor > major || (kernelMajor == major && kernelMinor >= minor)
+}
+
+// SessionResources reports the resource settings of a session and, with a
+// cgroup, its current usage
+type SessionResources struct {
+	Mode      string       `json:"mode"` // cgroup, nice or none
+	Cgroup    string       `json:"cgroup,omitempty"`
+	CPUWeight int          `json:"cpu_weight,omitempty"`
+	MemoryMax int64        `json:"memory_max,omitempty"` // Bytes; absent without limit
+	IOWeight  int          `json:"io_weight,omitempty"`
+	Nice      *int         `json:"nice,omitempty"`   // Used instead of cpu_weight without cgroup
+	IONice    *int         `json:"ionice,omitempty"` // Best-effort level used instead of io_weight
+	Usage     *CgroupUsage `json:"usage,omitempty"`
+}
+
+// CgroupUsage is read from the cgroup of a session
+type CgroupUsage struct {
+	CPUUsec       uint64 `json:"cpu_usec"`
+	MemoryCurrent uint64 `json:"memory_current"`
+	MemoryPeak    uint64 `json:"memory_peak,omitempty"`
+	IOReadBytes   uint64 `json:"io_read_bytes"`
+	IOWriteBytes  uint64 `json:"io_write_bytes"`
+	Processes     int    `json:"processes"`
+	OOMKills      uint64 `json:"oom_kills,omitempty"`
+}
+
+// sessionResources applies the limits of one session
+type sessionResources struct {
+	info     SessionResources
+	cgroupFD int  // Open while the module starts, -1 otherwise
+	owned    bool // The cgroup was created here and is removed at the end
+}
+
+// newSessionResources creates the cgroup of a session, or prepares the
+// nice/ionice fallback when cgroups are not available
+func newSessionResources(sessionId string, limits ResourceLimits) *sessionResources {
+	memoryMax, _ := parseMemorySize(limits.MemoryMax)
+	r := &sessionResources{
+		info: SessionResources{
+			Mode:      resourceModeNone,
+			CPUWeight: limits.CPUWeight,
+			MemoryMax: memoryMax,
+			IOWeight:  limits.IOWeight,
+		},
+		cgroupFD: -1,
+	}
+
+	if cgroupBase.path != "" {
+		if err := r.createCgroup(sessionId, limits, memoryMax); err != nil {
+			log.Printf("Warning: session %s runs without cgroup: %v", sessionId, err)
+			r.release()
+		}
+	}
+
+	// Approximate the weights the cgroup cannot enforce
+	if limits.CPUWeight != 0 && (r.info.Mode != resourceModeCgroup || !cgroupBase.controllers["cpu"]) {
+		nice := weightToNice(limits.CPUWeight)
+		r.info.Nice = &nice
+	}
+	if limits.IOWeight != 0 && (r.info.Mode != resourceModeCgroup || !cgroupBase.controllers["io"]) {
+		level := weightToIONice(limits.IOWeight)
+		r.info.IONice = &level
+	}
+	if r.info.Mode == resourceModeNone && (r.info.Nice != nil || r.info.IONice != nil) {
+		r.info.Mode = resourceModeNice
+	}
+	if memoryMax > 0 && (r.info.Mode != resourceModeCgroup || !cgroupBase.controllers["memory"]) {
+		log.Printf("Warning: memory_max of session %s is not enforced without the cgroup memory controller", sessionId)
+	}
+	return r
+}
+
+func (r *sessionResources) createCgroup(sessionId string, limits ResourceLimits, memoryMax int64) error {
+	path := filepath.Join(cgroupBase.path, cgroupSessionPrefix+sessionId)
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return err
+	}
+	r.info.Cgroup = path
+	r.owned = true
+
+	if limits.CPUWeight != 0 && cgroupBase.controllers["cpu"] {
+		if err := writeCgroupFile(path, "cpu.weight", strconv.Itoa(limits.CPUWeight)); err != nil {
+			return err
+		}
+	}
+	if memoryMax > 0 && cgroupBase.controllers["memory"] {
+		if err := writeCgroupFile(path, "memory.max", strconv.FormatInt(memoryMax, 10)); err != nil {
+			return err
+		}
+	}
+	if limits.IOWeight != 0 && cgroupBase.controllers["io"] {
+		if err := writeCgroupFile(path, "io.weight", "default "+strconv.Itoa(limits.IOWeight)); err != nil {
+			return err
+		}
+	}
+
+	if cgroupBase.cloneInto {
+		fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		r.cgroupFD = fd
+	}
+	r.info.Mode = resourceModeCgroup
+	return nil
+}
+
+func writeCgroupFile(path, name, value string) error {
+	if err := os.WriteFile(filepath.Join(path, name), []byte(value), 0); err != nil {
+		return fmt.Errorf("could not set %s: %w", name, err)
+	}
+	return nil
+}
+
+// prepare starts cmd inside the cgroup, or below nice/ionice
+func (r *sessionResources) prepare(cmd *exec.Cmd) {
+	if r.cgroupFD >= 0 {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = r.cgroupFD
+	}
+
+	var wrapper []string
+	if r.info.Nice != nil {
+		wrapper = append(wrapper, "nice", "-n", strconv.Itoa(*r.info.Nice))
+	}
+	if r.info.IONice != nil {
+		if _, err := exec.LookPath("ionice"); err == nil {
+			wrapper = append(wrapper, "ionice", "-c", "2", "-n", strconv.Itoa(*r.info.IONice))
+		} else {
+			r.info.IONice = nil
+		}
+	}
+	if len(wrapper) == 0 {
+		return
+	}
+	path, err := exec.LookPath(wrapper[0])
+	if err != nil {
+		log.Printf("Warning: %s not found, session priority unchanged", wrapper[0])
+		r.info.Nice, r.info.IONice = nil, nil
+		return
+	}
+	// nice and ionice exec the module, so it keeps their PID
+	cmd.Path = path
+	cmd.Args = append(wrapper, cmd.Args...)
+}
+
+// started moves the module into its cgroup if the kernel could not start it
+// there directly
+func (r *sessionResources) started(pid int) {
+	if r.cgroupFD >= 0 {
+		unix.Close(r.cgroupFD)
+		r.cgroupFD = -1
+		return
+	}
+	if r.info.Mode == resourceModeCgroup {
+		if err := writeCgroupFile(r.info.Cgroup, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			log.Printf("Warning: could not move process %d into %s: %v", pid, r.info.Cgroup, err)
+		}
+	}
+}
+
+// release removes the cgroup once the module has ended
+func (r *sessionResources) release() {
+	if r == nil {
+		return
+	}
+	if r.cgroupFD >= 0 {
+		unix.Close(r.cgroupFD)
+		r.cgroupFD = -1
+	}
+	if r.owned && r.info.Cgroup != "" {
+		if err := os.Remove(r.info.Cgroup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: could not remove %s: %v", r.info.Cgroup, err)
+		}
+		r.owned = false
+	}
+}
+
+// snapshot returns the settings and, with a cgroup, the current usage; nil
+// if the session runs without limits
+func (r *sessionResources) snapshot() *SessionResources {
+	if r == nil || r.info.Mode == resourceModeNone {
+		return nil
+	}
+	info := r.info
+	if info.Mode == resourceModeCgroup {
+		info.Usage = readCgroupUsage(info.Cgroup)
+	}
+	return &info
+}
+
+// readCgroupUsage reads the usage counters of a cgroup; missing files leave
+// their values at zero
+func readCgroupUsage(path string) *CgroupUsage {
+	procs, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+	usage := &CgroupUsage{Processes: len(strings.Fields(string(procs)))}
+
+	usage.CPUUsec = readCgroupKey(path, "cpu.stat", "usage_usec")
+	usage.MemoryCurrent = readCgroupValue(path, "memory.current")
+	usage.MemoryPeak = readCgroupValue(path, "memory.peak")
+	usage.OOMKills = readCgroupKey(path, "memory.events", "oom_kill")
+
+	// io.stat has one line per device: "8:0 rbytes=... wbytes=... rios=..."
+	if data, err := os.ReadFile(filepath.Join(path, "io.stat")); err == nil {
+		for _, field := range strings.Fields(string(data)) {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			number, _ := strconv.ParseUint(value, 10, 64)
+			switch key {
+			case "rbytes":
+				usage.IOReadBytes += number
+			case "wbytes":
+				usage.IOWriteBytes += number
+			}
+		}
+	}
+	return usage
+}
+
+func readCgroupValue(path, name string) uint64 {
+	data, err := os.ReadFile(filepath.Join(path, name))
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return value
+}
+
+// readCgroupKey reads one value of a flat keyed file such as cpu.stat
+func readCgroupKey(path, name, key string) uint64 {
+	data, err := os.ReadFile(filepath.Join(path, name))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, key+" "); ok {
+			number, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			return number
+		}
+	}
+	return 0
+}
+
+// weightToNice maps a cgroup CPU weight to a nice value: the kernel gives
+// every nice step about 1.25 times the CPU share of the next one, and weight
+// 100 equals nice 0. Unprivileged processes cannot lower their nice value.
+func weightToNice(weight int) int {
+	nice := int(math.Round(-math.Log(float64(weight)/defaultResourceWeight) / math.Log(1.25)))
+	low := -20
+	if os.Geteuid() != 0 {
+		low = 0
+	}
+	return min(max(nice, low), 19)
+}
+
+// weightToIONice maps an IO weight to a best-effort ionice level (0 highest,
+// 7 lowest, 4 default); every level halves or doubles the weight
+func weightToIONice(weight int) int {
+	level := 4 - int(math.Round(math.Log2(float64(weight)/defaultResourceWeight)))
+	return min(max(level, 0), 7)
+}
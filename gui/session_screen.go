@@ -0,0 +1,1160 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	// maxEscapeBytes bounds an unterminated escape sequence; longer ones are dropped
+	maxEscapeBytes = 4096
+
+	screenTabWidth = 8
+)
+
+// Cell attributes set by SGR
+const (
+	attrBold uint8 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrInverse
+	attrHidden
+	attrStrike
+)
+
+// sgrAttributes maps the cell attributes to their SGR codes
+var sgrAttributes = []struct {
+	attr uint8
+	code string
+}{
+	{attrBold, "1"}, {attrDim, "2"}, {attrItalic, "3"}, {attrUnderline, "4"},
+	{attrBlink, "5"}, {attrInverse, "7"}, {attrHidden, "8"}, {attrStrike, "9"},
+}
+
+// Colors of a screenStyle: 0 is the default color, 1-256 the xterm palette
+// (index + 1) and colorRGB|0xRRGGBB a true color
+const colorRGB int32 = 1 << 24
+
+// wideContinuation marks the right half of a double-width character
+const wideContinuation rune = -1
+
+// screenWidth measures characters like xterm.js does by default: ambiguous
+// East Asian characters are narrow
+var screenWidth = &runewidth.Condition{StrictEmojiNeutral: true}
+
+// lineDrawing is the DEC special graphics set selected with ESC ( 0
+var lineDrawing = map[rune]rune{
+	'`': '◆', 'a': '▒', 'f': '°', 'g': '±', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└',
+	'n': '┼', 'o': '⎺', 'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤',
+	'v': '┴', 'w': '┬', 'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£',
+	'~': '·',
+}
+
+type screenStyle struct {
+	fg, bg int32
+	attrs  uint8
+}
+
+// screenCell is one character cell; r is 0 for a cell nothing was written to
+type screenCell struct {
+	r     rune
+	style screenStyle
+}
+
+// savedCursor is the cursor state stored by DECSC
+type savedCursor struct {
+	valid       bool
+	row, col    int
+	wrapPending bool
+	style       screenStyle
+	originMode  bool
+	charsets    [2]bool
+	shifted     bool
+}
+
+// terminalScreen is a VT100/xterm screen model fed with the output of a
+// session. It keeps the character grid of the primary and alternate screen
+// and the lines scrolled off the top, so that a client joining late can be
+// given the current screen instead of a replay of output that may have been
+// cut off. Combining characters are dropped.
+type terminalScreen struct {
+	rows, cols int
+
+	primary   [][]screenCell
+	alternate [][]screenCell // Allocated while the alternate screen is active
+	altActive bool
+
+	row, col    int
+	wrapPending bool // The last column was written; the next character wraps
+	style       screenStyle
+	saved       [2]savedCursor // Of the primary and the alternate screen
+
+	scrollTop, scrollBottom int
+	tabStops                []bool
+
+	autowrap     bool
+	originMode   bool
+	insertMode   bool
+	cursorHidden bool
+	keypad       bool
+	privateModes map[int]bool // Other DEC modes, restored verbatim for new clients
+	charsets     [2]bool      // G0 and G1 select the line drawing set
+	shifted      bool         // Shift out (SO) selected G1
+
+	title string
+
+	history         []string // Lines scrolled off the primary screen, with SGR codes
+	historyBytes    int
+	maxHistoryBytes int
+	scrolledOff     func(line []screenCell) // If set, receives the lines instead of the history
+
+	carry []byte // Incomplete escape sequence or UTF-8 character of the last write
+}
+
+func newTerminalScreen(rows, cols, maxHistoryBytes int) *terminalScreen {
+	t := &terminalScreen{maxHistoryBytes: maxHistoryBytes}
+	t.reset(max(rows, 1), max(cols, 1))
+	return t
+}
+
+// reset puts the terminal into its initial state; the history is kept
+func (t *terminalScreen) reset(rows, cols int) {
+	t.rows, t.cols = rows, cols
+	t.primary = t.newGrid()
+	t.alternate = nil
+	t.altActive = false
+	t.row, t.col, t.wrapPending = 0, 0, false
+	t.saved = [2]savedCursor{}
+	t.privateModes = make(map[int]bool)
+	t.title = ""
+	t.tabStops = make([]bool, cols)
+	for i := range t.tabStops {
+		t.tabStops[i] = i%screenTabWidth == 0
+	}
+	t.softReset()
+}
+
+// softReset applies DECSTR: modes, style and scroll region return to their defaults
+func (t *terminalScreen) softReset() {
+	t.style = screenStyle{}
+	t.scrollTop, t.scrollBottom = 0, t.rows-1
+	t.autowrap = true
+	t.originMode = false
+	t.insertMode = false
+	t.cursorHidden = false
+	t.keypad = false
+	t.charsets = [2]bool{}
+	t.shifted = false
+	delete(t.privateModes, 1) // Application cursor keys
+}
+
+func (t *terminalScreen) grid() [][]screenCell {
+	if t.altActive {
+		return t.alternate
+	}
+	return t.primary
+}
+
+func (t *terminalScreen) newGrid() [][]screenCell {
+	grid := make([][]screenCell, t.rows)
+	for i := range grid {
+		grid[i] = t.blankLine()
+	}
+	return grid
+}
+
+// blankLine returns an empty line; erased cells keep the current background
+// color like xterm does
+func (t *terminalScreen) blankLine() []screenCell {
+	line := make([]screenCell, t.cols)
+	if t.style.bg != 0 {
+		for i := range line {
+			line[i] = t.blankCell()
+		}
+	}
+	return line
+}
+
+func (t *terminalScreen) blankCell() screenCell {
+	return screenCell{style: screenStyle{bg: t.style.bg}}
+}
+
+// Write feeds output to the screen
+func (t *terminalScreen) Write(data []byte) {
+	if len(t.carry) > 0 {
+		data = append(t.carry, data...)
+		t.carry = nil
+	}
+
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b == 0x1b:
+			n, complete := t.escape(data[i:])
+			if !complete {
+				if len(data)-i <= maxEscapeBytes {
+					t.carry = append([]byte(nil), data[i:]...)
+				}
+				return
+			}
+			i += n
+			continue
+		case b < 0x20 || b == 0x7f:
+			t.control(b)
+		default:
+			if !utf8.FullRune(data[i:]) {
+				t.carry = append([]byte(nil), data[i:]...)
+				return
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			t.print(r)
+			i += size
+			continue
+		}
+		i++
+	}
+}
+
+func (t *terminalScreen) control(b byte) {
+	switch b {
+	case '\b':
+		if t.wrapPending {
+			t.wrapPending = false
+		} else if t.col > 0 {
+			t.col--
+		}
+	case '\t':
+		t.wrapPending = false
+		for t.col < t.cols-1 {
+			t.col++
+			if t.tabStops[t.col] {
+				break
+			}
+		}
+	case '\n', '\v', '\f':
+		t.wrapPending = false
+		t.index()
+	case '\r':
+		t.col = 0
+		t.wrapPending = false
+	case 0x0e:
+		t.shifted = true
+	case 0x0f:
+		t.shifted = false
+	}
+}
+
+func (t *terminalScreen) print(r rune) {
+	charset := 0
+	if t.shifted {
+		charset = 1
+	}
+	if t.charsets[charset] {
+		if mapped, ok := lineDrawing[r]; ok {
+			r = mapped
+		}
+	}
+
+	width := screenWidth.RuneWidth(r)
+	if width == 0 {
+		return
+	}
+
+	if t.wrapPending {
+		t.col = 0
+		t.index()
+		t.wrapPending = false
+	}
+	if width == 2 && t.col == t.cols-1 {
+		if !t.autowrap || t.cols < 2 {
+			return
+		}
+		t.clearCells(t.row, t.col, t.col+1)
+		t.col = 0
+		t.index()
+	}
+
+	line := t.grid()[t.row]
+	if t.insertMode {
+		copy(line[t.col+width:], line[t.col:])
+	}
+	t.clearCells(t.row, t.col, t.col+width)
+	line[t.col] = screenCell{r: r, style: t.style}
+	if width == 2 {
+		line[t.col+1] = screenCell{r: wideContinuation, style: t.style}
+	}
+
+	t.col += width
+	if t.col >= t.cols {
+		t.col = t.cols - 1
+		t.wrapPending = t.autowrap
+	}
+}
+
+// clearCells blanks the cells from start up to end of a row, including the
+// other half of double-width characters cut at either edge
+func (t *terminalScreen) clearCells(row, start, end int) {
+	line := t.grid()[row]
+	start, end = max(start, 0), min(end, t.cols)
+	if start >= end {
+		return
+	}
+	if start > 0 && line[start].r == wideContinuation {
+		start--
+	}
+	if end < t.cols && line[end].r == wideContinuation {
+		end++
+	}
+	for i := start; i < end; i++ {
+		line[i] = t.blankCell()
+	}
+}
+
+// index moves the cursor down, scrolling at the bottom of the scroll region
+func (t *terminalScreen) index() {
+	if t.row == t.scrollBottom {
+		t.scrollUp(1)
+	} else if t.row < t.rows-1 {
+		t.row++
+	}
+}
+
+// reverseIndex moves the cursor up, scrolling at the top of the scroll region
+func (t *terminalScreen) reverseIndex() {
+	if t.row == t.scrollTop {
+		t.scrollDown(1)
+	} else if t.row > 0 {
+		t.row--
+	}
+}
+
+// scrollUp moves the lines of the scroll region up; lines leaving the top of
+// the primary screen go to the history
+func (t *terminalScreen) scrollUp(n int) {
+	if t.scrollTop == 0 && !t.altActive {
+		for _, line := range t.primary[:min(n, t.scrollBottom+1)] {
+			t.pushHistory(line)
+		}
+	}
+	t.shiftUp(t.scrollTop, n)
+}
+
+// scrollDown moves the lines of the scroll region down
+func (t *terminalScreen) scrollDown(n int) {
+	t.shiftDown(t.scrollTop, n)
+}
+
+// shiftUp removes n lines at top, moving the lines below it up to the end of
+// the scroll region
+func (t *terminalScreen) shiftUp(top, n int) {
+	grid := t.grid()
+	n = min(n, t.scrollBottom-top+1)
+	copy(grid[top:], grid[top+n:t.scrollBottom+1])
+	for i := t.scrollBottom - n + 1; i <= t.scrollBottom; i++ {
+		grid[i] = t.blankLine()
+	}
+}
+
+// shiftDown inserts n blank lines at top; lines pushed past the end of the
+// scroll region are lost
+func (t *terminalScreen) shiftDown(top, n int) {
+	grid := t.grid()
+	n = min(n, t.scrollBottom-top+1)
+	copy(grid[top+n:t.scrollBottom+1], grid[top:])
+	for i := top; i < top+n; i++ {
+		grid[i] = t.blankLine()
+	}
+}
+
+// cursorUp moves the cursor up, stopping at the top of the scroll region
+func (t *terminalScreen) cursorUp(n int) {
+	top := 0
+	if t.row >= t.scrollTop {
+		top = t.scrollTop
+	}
+	t.row = max(t.row-n, top)
+	t.wrapPending = false
+}
+
+// cursorDown moves the cursor down, stopping at the bottom of the scroll region
+func (t *terminalScreen) cursorDown(n int) {
+	bottom := t.rows - 1
+	if t.row <= t.scrollBottom {
+		bottom = t.scrollBottom
+	}
+	t.row = min(t.row+n, bottom)
+	t.wrapPending = false
+}
+
+func (t *terminalScreen) pushHistory(line []screenCell) {
+	if t.scrolledOff != nil {
+		t.scrolledOff(line)
+		return
+	}
+	text := encodeScreenLine(line)
+	t.history = append(t.history, text)
+	t.historyBytes += len(text) + 2
+	for t.historyBytes > t.maxHistoryBytes && len(t.history) > 0 {
+		t.historyBytes -= len(t.history[0]) + 2
+		t.history[0] = ""
+		t.history = t.history[1:]
+	}
+}
+
+// moveTo places the cursor; rows are relative to the scroll region in origin mode
+func (t *terminalScreen) moveTo(row, col int) {
+	top, bottom := 0, t.rows-1
+	if t.originMode {
+		top, bottom = t.scrollTop, t.scrollBottom
+	}
+	t.row = min(max(row+top, top), bottom)
+	t.col = min(max(col, 0), t.cols-1)
+	t.wrapPending = false
+}
+
+// escape handles the escape sequence at the start of data and returns its
+// length; complete is false if data ends inside the sequence
+func (t *terminalScreen) escape(data []byte) (n int, complete bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+
+	switch data[1] {
+	case '[': // CSI: parameters, intermediates, final byte
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				t.csi(data[2:i], data[i])
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case ']', 'P', '_', '^', 'X': // OSC and other strings end with BEL or ESC \
+		for i := 2; i < len(data); i++ {
+			end := -1
+			if data[i] == 0x07 {
+				end = i + 1
+			} else if data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\' {
+				end = i + 2
+			}
+			if end >= 0 {
+				if data[1] == ']' {
+					t.osc(string(data[2:i]))
+				}
+				return end, true
+			}
+		}
+		return 0, false
+	case '(', ')', '*', '+', '#', '%', ' ': // Character sets and other two-byte sequences
+		if len(data) < 3 {
+			return 0, false
+		}
+		switch data[1] {
+		case '(':
+			t.charsets[0] = data[2] == '0'
+		case ')':
+			t.charsets[1] = data[2] == '0'
+		}
+		return 3, true
+	}
+
+	switch data[1] {
+	case '7':
+		t.saveCursor()
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.wrapPending = false
+		t.index()
+	case 'E':
+		t.col, t.wrapPending = 0, false
+		t.index()
+	case 'M':
+		t.wrapPending = false
+		t.reverseIndex()
+	case 'H':
+		t.tabStops[t.col] = true
+	case 'c':
+		t.reset(t.rows, t.cols)
+	case '=':
+		t.keypad = true
+	case '>':
+		t.keypad = false
+	}
+	return 2, true
+}
+
+// osc handles operating system commands; only the window title is kept
+func (t *terminalScreen) osc(content string) {
+	command, text, _ := strings.Cut(content, ";")
+	if command == "0" || command == "2" {
+		t.title = text
+	}
+}
+
+// csi handles a control sequence
+func (t *terminalScreen) csi(sequence []byte, final byte) {
+	var private byte
+	if len(sequence) > 0 && sequence[0] >= '<' && sequence[0] <= '?' {
+		private = sequence[0]
+		sequence = sequence[1:]
+	}
+	end := len(sequence)
+	for end > 0 && sequence[end-1] >= 0x20 && sequence[end-1] <= 0x2f {
+		end--
+	}
+	params, intermediates := string(sequence[:end]), string(sequence[end:])
+
+	if intermediates != "" {
+		if intermediates == "!" && final == 'p' {
+			t.softReset()
+		}
+		return
+	}
+	if private == '?' {
+		if final == 'h' || final == 'l' {
+			for _, mode := range parseCSIParams(params) {
+				t.setPrivateMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if private != 0 {
+		return
+	}
+	if final == 'm' {
+		t.sgr(params)
+		return
+	}
+
+	args := parseCSIParams(params)
+	arg := func(i, fallback int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return fallback
+	}
+	mode := arg(0, 0)
+
+	switch final {
+	case 'A':
+		t.cursorUp(arg(0, 1))
+	case 'B', 'e':
+		t.cursorDown(arg(0, 1))
+	case 'C', 'a':
+		t.col = min(t.col+arg(0, 1), t.cols-1)
+		t.wrapPending = false
+	case 'D':
+		t.col = max(t.col-arg(0, 1), 0)
+		t.wrapPending = false
+	case 'E':
+		t.cursorDown(arg(0, 1))
+		t.col = 0
+	case 'F':
+		t.cursorUp(arg(0, 1))
+		t.col = 0
+	case 'G', '`':
+		t.col = min(arg(0, 1), t.cols) - 1
+		t.wrapPending = false
+	case 'H', 'f':
+		t.moveTo(arg(0, 1)-1, arg(1, 1)-1)
+	case 'd':
+		t.moveTo(arg(0, 1)-1, t.col)
+	case 'J':
+		t.eraseDisplay(mode)
+	case 'K':
+		switch mode {
+		case 0:
+			t.clearCells(t.row, t.col, t.cols)
+		case 1:
+			t.clearCells(t.row, 0, t.col+1)
+		case 2:
+			t.clearCells(t.row, 0, t.cols)
+		}
+	case 'X':
+		t.clearCells(t.row, t.col, t.col+arg(0, 1))
+	case '@':
+		n := min(arg(0, 1), t.cols-t.col)
+		line := t.grid()[t.row]
+		copy(line[t.col+n:], line[t.col:])
+		t.clearCells(t.row, t.col, t.col+n)
+	case 'P':
+		n := min(arg(0, 1), t.cols-t.col)
+		line := t.grid()[t.row]
+		copy(line[t.col:], line[t.col+n:])
+		for i := t.cols - n; i < t.cols; i++ {
+			line[i] = t.blankCell()
+		}
+	case 'L':
+		if t.row >= t.scrollTop && t.row <= t.scrollBottom {
+			t.shiftDown(t.row, arg(0, 1))
+			t.col, t.wrapPending = 0, false
+		}
+	case 'M':
+		// Deleted lines do not enter the history
+		if t.row >= t.scrollTop && t.row <= t.scrollBottom {
+			t.shiftUp(t.row, arg(0, 1))
+			t.col, t.wrapPending = 0, false
+		}
+	case 'S':
+		t.scrollUp(arg(0, 1))
+	case 'T':
+		if len(args) <= 1 {
+			t.scrollDown(arg(0, 1))
+		}
+	case 'r':
+		top, bottom := arg(0, 1)-1, min(arg(1, t.rows), t.rows)-1
+		if top < bottom {
+			t.scrollTop, t.scrollBottom = top, bottom
+			t.moveTo(0, 0)
+		}
+	case 's':
+		if len(args) == 0 {
+			t.saveCursor()
+		}
+	case 'u':
+		t.restoreCursor()
+	case 'g':
+		switch mode {
+		case 0:
+			t.tabStops[t.col] = false
+		case 3:
+			clear(t.tabStops)
+		}
+	case 'h', 'l':
+		for _, m := range args {
+			if m == 4 {
+				t.insertMode = final == 'h'
+			}
+		}
+	}
+}
+
+func (t *terminalScreen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.clearCells(t.row, t.col, t.cols)
+		for row := t.row + 1; row < t.rows; row++ {
+			t.clearCells(row, 0, t.cols)
+		}
+	case 1:
+		for row := 0; row < t.row; row++ {
+			t.clearCells(row, 0, t.cols)
+		}
+		t.clearCells(t.row, 0, t.col+1)
+	case 2:
+		for row := 0; row < t.rows; row++ {
+			t.clearCells(row, 0, t.cols)
+		}
+	case 3:
+		t.history = nil
+		t.historyBytes = 0
+	}
+}
+
+func (t *terminalScreen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 6:
+		t.originMode = on
+		t.moveTo(0, 0)
+	case 7:
+		t.autowrap = on
+		if !on {
+			t.wrapPending = false
+		}
+	case 25:
+		t.cursorHidden = !on
+	case 47, 1047:
+		t.setAlternate(on)
+	case 1048:
+		if on {
+			t.saveCursor()
+		} else {
+			t.restoreCursor()
+		}
+	case 1049:
+		if on {
+			t.saveCursor()
+			t.setAlternate(true)
+		} else {
+			t.setAlternate(false)
+			t.restoreCursor()
+		}
+	default:
+		if on {
+			t.privateModes[mode] = true
+		} else {
+			delete(t.privateModes, mode)
+		}
+	}
+}
+
+// setAlternate switches between the primary and a cleared alternate screen
+func (t *terminalScreen) setAlternate(on bool) {
+	if on == t.altActive {
+		return
+	}
+	t.altActive = on
+	if on {
+		t.alternate = t.newGrid()
+	} else {
+		t.alternate = nil
+	}
+	t.wrapPending = false
+}
+
+func (t *terminalScreen) savedIndex() int {
+	if t.altActive {
+		return 1
+	}
+	return 0
+}
+
+func (t *terminalScreen) saveCursor() {
+	t.saved[t.savedIndex()] = savedCursor{
+		valid:       true,
+		row:         t.row,
+		col:         t.col,
+		wrapPending: t.wrapPending,
+		style:       t.style,
+		originMode:  t.originMode,
+		charsets:    t.charsets,
+		shifted:     t.shifted,
+	}
+}
+
+func (t *terminalScreen) restoreCursor() {
+	saved := t.saved[t.savedIndex()]
+	if !saved.valid {
+		t.style = screenStyle{}
+		t.originMode = false
+		t.moveTo(0, 0)
+		return
+	}
+	t.row = min(saved.row, t.rows-1)
+	t.col = min(saved.col, t.cols-1)
+	t.wrapPending = saved.wrapPending
+	t.style = saved.style
+	t.originMode = saved.originMode
+	t.charsets = saved.charsets
+	t.shifted = saved.shifted
+}
+
+// sgr applies Select Graphic Rendition parameters
+func (t *terminalScreen) sgr(params string) {
+	if params == "" {
+		t.style = screenStyle{}
+		return
+	}
+
+	fields := strings.Split(params, ";")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.Split(fields[i], ":")
+		code, _ := strconv.Atoi(parts[0])
+		switch {
+		case code == 0:
+			t.style = screenStyle{}
+		case code >= 1 && code <= 9 && code != 6:
+			for _, attribute := range sgrAttributes {
+				if attribute.code == parts[0] {
+					t.style.attrs |= attribute.attr
+				}
+			}
+		case code == 21:
+			t.style.attrs |= attrUnderline
+		case code == 22:
+			t.style.attrs &^= attrBold | attrDim
+		case code == 23:
+			t.style.attrs &^= attrItalic
+		case code == 24:
+			t.style.attrs &^= attrUnderline
+		case code == 25:
+			t.style.attrs &^= attrBlink
+		case code == 27:
+			t.style.attrs &^= attrInverse
+		case code == 28:
+			t.style.attrs &^= attrHidden
+		case code == 29:
+			t.style.attrs &^= attrStrike
+		case code >= 30 && code <= 37:
+			t.style.fg = int32(code-30) + 1
+		case code >= 90 && code <= 97:
+			t.style.fg = int32(code-90) + 9
+		case code == 39:
+			t.style.fg = 0
+		case code >= 40 && code <= 47:
+			t.style.bg = int32(code-40) + 1
+		case code >= 100 && code <= 107:
+			t.style.bg = int32(code-100) + 9
+		case code == 49:
+			t.style.bg = 0
+		case code == 38 || code == 48 || code == 58:
+			// Colors come as 38;5;n or 38;2;r;g;b, or with colons as 38:5:n or
+			// 38:2::r:g:b; underline colors (58) are not kept
+			var color int32
+			if len(parts) > 1 {
+				color, _ = parseSGRColor(parts[1:], true)
+			} else {
+				var used int
+				color, used = parseSGRColor(fields[i+1:], false)
+				i += used
+			}
+			switch {
+			case color < 0:
+			case code == 38:
+				t.style.fg = color
+			case code == 48:
+				t.style.bg = color
+			}
+		}
+	}
+}
+
+// parseSGRColor parses the arguments of an extended color and returns the
+// color (-1 if invalid) and the number of arguments used
+func parseSGRColor(args []string, colons bool) (int32, int) {
+	if len(args) == 0 {
+		return -1, 0
+	}
+	value := func(i int) int {
+		if i >= len(args) {
+			return 0
+		}
+		n, _ := strconv.Atoi(args[i])
+		return min(max(n, 0), 255)
+	}
+
+	switch args[0] {
+	case "5":
+		return int32(value(1)) + 1, min(2, len(args))
+	case "2":
+		// The colon form may carry a color space ID before the components
+		first := 1
+		if colons && len(args) >= 5 {
+			first = 2
+		}
+		color := colorRGB | int32(value(first)<<16|value(first+1)<<8|value(first+2))
+		return color, min(4, len(args))
+	}
+	return -1, 1
+}
+
+// parseCSIParams returns the numeric parameters of a control sequence; empty
+// parameters are 0 and sub-parameters are ignored
+func parseCSIParams(params string) []int {
+	if params == "" {
+		return nil
+	}
+	fields := strings.Split(params, ";")
+	args := make([]int, len(fields))
+	for i, field := range fields {
+		field, _, _ = strings.Cut(field, ":")
+		args[i], _ = strconv.Atoi(field)
+	}
+	return args
+}
+
+// sgr returns the sequence that selects the style from the default style
+func (s screenStyle) sgr() string {
+	codes := []string{"0"}
+	for _, attribute := range sgrAttributes {
+		if s.attrs&attribute.attr != 0 {
+			codes = append(codes, attribute.code)
+		}
+	}
+	codes = appendColorCodes(codes, s.fg, 30, 90, 38)
+	codes = appendColorCodes(codes, s.bg, 40, 100, 48)
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+func appendColorCodes(codes []string, color int32, base, bright, extended int) []string {
+	switch {
+	case color == 0:
+		return codes
+	case color&colorRGB != 0:
+		return append(codes, strconv.Itoa(extended), "2",
+			strconv.Itoa(int(color>>16&0xff)), strconv.Itoa(int(color>>8&0xff)), strconv.Itoa(int(color&0xff)))
+	case color <= 8:
+		return append(codes, strconv.Itoa(base+int(color)-1))
+	case color <= 16:
+		return append(codes, strconv.Itoa(bright+int(color)-9))
+	default:
+		return append(codes, strconv.Itoa(extended), "5", strconv.Itoa(int(color)-1))
+	}
+}
+
+// encodeScreenLine returns a line as text with SGR codes, without trailing blanks
+func encodeScreenLine(line []screenCell) string {
+	end := len(line)
+	for end > 0 && line[end-1] == (screenCell{}) {
+		end--
+	}
+
+	var text strings.Builder
+	var current screenStyle
+	for _, cell := range line[:end] {
+		if cell.r == wideContinuation {
+			continue
+		}
+		if cell.style != current {
+			text.WriteString(cell.style.sgr())
+			current = cell.style
+		}
+		if cell.r == 0 {
+			text.WriteByte(' ')
+		} else {
+			text.WriteRune(cell.r)
+		}
+	}
+	if current != (screenStyle{}) {
+		text.WriteString("\x1b[0m")
+	}
+	return text.String()
+}
+
+// screenLineText returns a line as plain text without trailing spaces
+func screenLineText(line []screenCell) string {
+	var text strings.Builder
+	for _, cell := range line {
+		switch cell.r {
+		case wideContinuation:
+		case 0:
+			text.WriteByte(' ')
+		default:
+			text.WriteRune(cell.r)
+		}
+	}
+	return strings.TrimRight(text.String(), " ")
+}
+
+// Resize changes the screen size. Lines do not reflow: they are cut or padded
+// on the right. When the primary screen loses rows, empty rows below the
+// cursor are dropped first and then rows at the top move to the history.
+func (t *terminalScreen) Resize(rows, cols int) {
+	rows, cols = max(rows, 1), max(cols, 1)
+	if rows == t.rows && cols == t.cols {
+		return
+	}
+
+	primaryRow := &t.row
+	if t.altActive {
+		primaryRow = &t.saved[0].row
+	}
+	t.primary = t.resizeGrid(t.primary, rows, cols, primaryRow, true)
+	if t.altActive {
+		t.alternate = t.resizeGrid(t.alternate, rows, cols, &t.row, false)
+	}
+
+	for len(t.tabStops) < cols {
+		t.tabStops = append(t.tabStops, len(t.tabStops)%screenTabWidth == 0)
+	}
+	t.tabStops = t.tabStops[:cols]
+
+	t.rows, t.cols = rows, cols
+	t.scrollTop, t.scrollBottom = 0, rows-1
+	t.row = min(t.row, rows-1)
+	t.col = min(t.col, cols-1)
+	t.wrapPending = false
+	t.saved[0].row, t.saved[0].col = min(t.saved[0].row, rows-1), min(t.saved[0].col, cols-1)
+	t.saved[1].row, t.saved[1].col = min(t.saved[1].row, rows-1), min(t.saved[1].col, cols-1)
+}
+
+func (t *terminalScreen) resizeGrid(grid [][]screenCell, rows, cols int, cursorRow *int, keepHistory bool) [][]screenCell {
+	for i, line := range grid {
+		if cols < len(line) {
+			if line[cols].r == wideContinuation {
+				line[cols-1] = screenCell{}
+			}
+			grid[i] = line[:cols:cols]
+		} else {
+			grid[i] = append(line, make([]screenCell, cols-len(line))...)
+		}
+	}
+
+	for len(grid) > rows && len(grid)-1 > *cursorRow && encodeScreenLine(grid[len(grid)-1]) == "" {
+		grid = grid[:len(grid)-1]
+	}
+	if excess := len(grid) - rows; excess > 0 {
+		if keepHistory {
+			for _, line := range grid[:excess] {
+				t.pushHistory(line)
+			}
+		}
+		grid = grid[excess:]
+		*cursorRow = max(*cursorRow-excess, 0)
+	}
+	for len(grid) < rows {
+		grid = append(grid, make([]screenCell, cols))
+	}
+	return grid
+}
+
+// Replay returns output that draws the history and the current screen in a
+// newly opened terminal of the same size and restores the cursor and modes
+func (t *terminalScreen) Replay() string {
+	var out strings.Builder
+	if t.title != "" {
+		fmt.Fprintf(&out, "\x1b]0;%s\x07", t.title)
+	}
+	for _, line := range t.history {
+		out.WriteString(line)
+		out.WriteString("\r\n")
+	}
+
+	// Without history the rows below the content are left out; with history
+	// every row is needed so the screen ends up at the top of the terminal
+	lines := t.rows
+	if len(t.history) == 0 {
+		cursorRow := t.row
+		if t.altActive {
+			cursorRow = t.saved[0].row
+		}
+		lines = cursorRow + 1
+		for row := lines; row < t.rows; row++ {
+			if encodeScreenLine(t.primary[row]) != "" {
+				lines = row + 1
+			}
+		}
+	}
+	writeScreenLines(&out, t.primary[:lines])
+	if t.altActive {
+		out.WriteString("\x1b[?1049h\x1b[H")
+		writeScreenLines(&out, t.alternate)
+	}
+
+	if t.scrollTop != 0 || t.scrollBottom != t.rows-1 {
+		fmt.Fprintf(&out, "\x1b[%d;%dr", t.scrollTop+1, t.scrollBottom+1)
+	}
+	modes := make([]int, 0, len(t.privateModes))
+	for mode := range t.privateModes {
+		modes = append(modes, mode)
+	}
+	sort.Ints(modes)
+	for _, mode := range modes {
+		fmt.Fprintf(&out, "\x1b[?%dh", mode)
+	}
+	if !t.autowrap {
+		out.WriteString("\x1b[?7l")
+	}
+	if t.insertMode {
+		out.WriteString("\x1b[4h")
+	}
+	if t.keypad {
+		out.WriteString("\x1b=")
+	}
+	if t.cursorHidden {
+		out.WriteString("\x1b[?25l")
+	}
+	if t.charsets[0] {
+		out.WriteString("\x1b(0")
+	}
+	if t.charsets[1] {
+		out.WriteString("\x1b)0")
+	}
+	if t.shifted {
+		out.WriteString("\x0e")
+	}
+
+	row := t.row
+	if t.originMode {
+		out.WriteString("\x1b[?6h")
+		row -= t.scrollTop
+	}
+	fmt.Fprintf(&out, "\x1b[%d;%dH", row+1, t.col+1)
+	if t.style != (screenStyle{}) {
+		out.WriteString(t.style.sgr())
+	}
+	return out.String()
+}
+
+func writeScreenLines(out *strings.Builder, lines [][]screenCell) {
+	for i, line := range lines {
+		if i > 0 {
+			out.WriteString("\r\n")
+		}
+		out.WriteString(encodeScreenLine(line))
+	}
+}
+
+// ScreenSnapshot is the visible screen of a session as plain text
+type ScreenSnapshot struct {
+	SessionID       string   `json:"session_id"`
+	Rows            int      `json:"rows"`
+	Cols            int      `json:"cols"`
+	CursorRow       int      `json:"cursor_row"` // Zero-based
+	CursorCol       int      `json:"cursor_col"`
+	CursorVisible   bool     `json:"cursor_visible"`
+	AlternateScreen bool     `json:"alternate_screen"` // A full-screen program is running
+	Title           string   `json:"title,omitempty"`
+	Offset          int64    `json:"offset"`               // Stream offset of the output the screen reflects
+	Lines           []string `json:"lines"`                // One entry per row, trailing spaces removed
+	Scrollback      []string `json:"scrollback,omitempty"` // Lines scrolled off the top, oldest first
+}
+
+// Snapshot returns the screen and up to scrollbackLines lines of history
+func (t *terminalScreen) Snapshot(scrollbackLines int) ScreenSnapshot {
+	snapshot := ScreenSnapshot{
+		Rows:            t.rows,
+		Cols:            t.cols,
+		CursorRow:       t.row,
+		CursorCol:       t.col,
+		CursorVisible:   !t.cursorHidden,
+		AlternateScreen: t.altActive,
+		Title:           t.title,
+		Lines:           make([]string, 0, t.rows),
+	}
+	for _, line := range t.grid() {
+		snapshot.Lines = append(snapshot.Lines, screenLineText(line))
+	}
+	if scrollbackLines > 0 {
+		for _, line := range t.history[max(len(t.history)-scrollbackLines, 0):] {
+			snapshot.Scrollback = append(snapshot.Scrollback, ansiSequencePattern.ReplaceAllString(line, ""))
+		}
+	}
+	return snapshot
+}
+
+// getSessionScreen serves GET /api/sessions/:sessionId/screen
+func getSessionScreen(c *fiber.Ctx) error {
+	session, err := sessionManager.lookupSessionForUser(c.Params("sessionId"), requestUser(c))
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+
+	scrollbackLines := c.QueryInt("scrollback", 0)
+	if scrollbackLines < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid scrollback"})
+	}
+
+	snapshot := session.Stream.Screen(scrollbackLines)
+	snapshot.SessionID = session.ID
+
+	switch c.Query("format", "json") {
+	case "json":
+		return c.JSON(snapshot)
+	case "text":
+		lines := append(snapshot.Scrollback, snapshot.Lines...)
+		for len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(strings.Join(lines, "\n") + "\n")
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid format (json or text)"})
+	}
+}
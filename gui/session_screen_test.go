@@ -0,0 +1,217 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkScreen compares the visible lines, the cursor and the scrollback of a screen
+func checkScreen(t *testing.T, screen *terminalScreen, lines []string, row, col int, scrollback []string) {
+	t.Helper()
+	snapshot := screen.Snapshot(100)
+	if strings.Join(snapshot.Lines, "|") != strings.Join(lines, "|") {
+		t.Errorf("lines %q, want %q", snapshot.Lines, lines)
+	}
+	if snapshot.CursorRow != row || snapshot.CursorCol != col {
+		t.Errorf("cursor at %d,%d, want %d,%d", snapshot.CursorRow, snapshot.CursorCol, row, col)
+	}
+	if strings.Join(snapshot.Scrollback, "|") != strings.Join(scrollback, "|") {
+		t.Errorf("scrollback %q, want %q", snapshot.Scrollback, scrollback)
+	}
+}
+
+func TestTerminalScreenWrap(t *testing.T) {
+	screen := newTerminalScreen(3, 5, 1024)
+
+	// Filling the last column leaves the cursor there until the next character
+	screen.Write([]byte("abcde"))
+	checkScreen(t, screen, []string{"abcde", "", ""}, 0, 4, nil)
+	if !screen.wrapPending {
+		t.Fatal("no wrap pending after the last column was written")
+	}
+	screen.Write([]byte("f"))
+	checkScreen(t, screen, []string{"abcde", "f", ""}, 1, 1, nil)
+
+	// A line ending exactly at the last column does not add an empty line
+	screen.Write([]byte("\rvwxyz\r\n"))
+	checkScreen(t, screen, []string{"abcde", "vwxyz", ""}, 2, 0, nil)
+
+	// Backspace cancels a pending wrap instead of moving the cursor
+	screen.Write([]byte("12345\b!"))
+	checkScreen(t, screen, []string{"abcde", "vwxyz", "1234!"}, 2, 4, nil)
+
+	// Without autowrap the last column is overwritten
+	screen.Write([]byte("\x1b[?7l\rABCDEFG"))
+	checkScreen(t, screen, []string{"abcde", "vwxyz", "ABCDG"}, 2, 4, nil)
+	if screen.wrapPending {
+		t.Error("wrap pending with autowrap off")
+	}
+}
+
+func TestTerminalScreenWideCharacters(t *testing.T) {
+	screen := newTerminalScreen(3, 4, 1024)
+
+	// A wide character filling the last two columns sets the pending wrap
+	screen.Write([]byte("ab界"))
+	checkScreen(t, screen, []string{"ab界", "", ""}, 0, 3, nil)
+	if !screen.wrapPending {
+		t.Error("no wrap pending after a wide character in the last columns")
+	}
+
+	// One that does not fit in the last column moves to the next line
+	screen.Write([]byte("\r\nabc界"))
+	checkScreen(t, screen, []string{"ab界", "abc", "界"}, 2, 2, nil)
+	if line := screen.primary[1]; line[3] != screen.blankCell() {
+		t.Errorf("last column holds %q, want it blank", line[3].r)
+	}
+
+	// Overwriting either half clears the whole character
+	screen.Write([]byte("\x1b[1;4Hx\x1b[3;1Hy"))
+	checkScreen(t, screen, []string{"ab x", "abc", "y"}, 2, 1, nil)
+
+	// Without autowrap it is not printed at all
+	screen.Write([]byte("\x1b[?7l\x1b[3;4H界"))
+	checkScreen(t, screen, []string{"ab x", "abc", "y"}, 2, 3, nil)
+}
+
+func TestTerminalScreenScrollRegion(t *testing.T) {
+	screen := newTerminalScreen(4, 10, 1024)
+	screen.Write([]byte("1\r\n2\r\n3\r\n4"))
+
+	// Scrolling inside a region below the top keeps the lines out of the history
+	screen.Write([]byte("\x1b[2;3r"))
+	checkScreen(t, screen, []string{"1", "2", "3", "4"}, 0, 0, nil)
+	screen.Write([]byte("\x1b[3;1H\n\n"))
+	checkScreen(t, screen, []string{"1", "", "", "4"}, 2, 0, nil)
+
+	// Reverse index at the top of the region scrolls it down
+	screen.Write([]byte("\x1b[2;1Hx\x1bM\ry"))
+	checkScreen(t, screen, []string{"1", "y", "x", "4"}, 1, 1, nil)
+
+	// A region starting at the top passes its lines to the history
+	screen.Write([]byte("\x1b[1;2r\x1b[2;1H\n"))
+	checkScreen(t, screen, []string{"y", "", "x", "4"}, 1, 0, []string{"1"})
+
+	// The full screen does too, with the colors kept in the history
+	screen.Write([]byte("\x1b[r\x1b[1;1H\x1b[32my\x1b[m\x1b[4;1H\n\n"))
+	checkScreen(t, screen, []string{"x", "4", "", ""}, 3, 0, []string{"1", "y", ""})
+	if screen.history[1] != "\x1b[0;32my\x1b[0m" {
+		t.Errorf("history line %q lost its color", screen.history[1])
+	}
+}
+
+func TestTerminalScreenHistoryLimit(t *testing.T) {
+	screen := newTerminalScreen(2, 10, 12)
+	screen.Write([]byte("one\r\ntwo\r\nthree\r\nfour\r\nfive"))
+
+	// Each line counts with its line break
+	checkScreen(t, screen, []string{"four", "five"}, 1, 4, []string{"two", "three"})
+	if screen.historyBytes != 12 {
+		t.Errorf("history holds %d bytes, want 12", screen.historyBytes)
+	}
+}
+
+func TestTerminalScreenAlternate(t *testing.T) {
+	screen := newTerminalScreen(3, 10, 1024)
+	screen.Write([]byte("\x1b[1mshell$ "))
+
+	screen.Write([]byte("\x1b[?1049h"))
+	if !screen.Snapshot(0).AlternateScreen {
+		t.Fatal("alternate screen not active")
+	}
+	checkScreen(t, screen, []string{"", "", ""}, 0, 7, nil)
+
+	// Scrolling the alternate screen does not add to the history
+	screen.Write([]byte("\x1b[m\x1b[Hmenu\x1b[3;1H\n\nitem\x1b[31m"))
+	checkScreen(t, screen, []string{"", "", "item"}, 2, 4, nil)
+
+	// Leaving it restores the primary screen, the cursor and the style
+	screen.Write([]byte("\x1b[?1049l"))
+	if screen.Snapshot(0).AlternateScreen {
+		t.Fatal("alternate screen still active")
+	}
+	checkScreen(t, screen, []string{"shell$", "", ""}, 0, 7, nil)
+	if screen.style != (screenStyle{attrs: attrBold}) {
+		t.Errorf("style %+v, want the bold style saved on entry", screen.style)
+	}
+	if screen.alternate != nil {
+		t.Error("alternate screen kept after leaving it")
+	}
+
+	// It starts out empty the next time
+	screen.Write([]byte("\x1b[?1049h"))
+	checkScreen(t, screen, []string{"", "", ""}, 0, 7, nil)
+}
+
+func TestTerminalScreenResize(t *testing.T) {
+	// Empty rows below the cursor are dropped first
+	screen := newTerminalScreen(4, 10, 1024)
+	screen.Write([]byte("a\r\nb"))
+	screen.Resize(2, 10)
+	checkScreen(t, screen, []string{"a", "b"}, 1, 1, nil)
+
+	// Then rows at the top move to the history
+	screen = newTerminalScreen(4, 10, 1024)
+	screen.Write([]byte("a\r\nb\r\nc\r\nd"))
+	screen.Resize(2, 10)
+	checkScreen(t, screen, []string{"c", "d"}, 1, 1, []string{"a", "b"})
+
+	// Growing adds empty rows at the bottom and lines are cut, not reflowed
+	screen.Write([]byte("\x1b[1;1Habcdefg"))
+	screen.Resize(3, 4)
+	checkScreen(t, screen, []string{"abcd", "d", ""}, 0, 3, []string{"a", "b"})
+
+	// A wide character cut in half is removed
+	screen.Write([]byte("\x1b[2;1Hxy界"))
+	screen.Resize(3, 3)
+	checkScreen(t, screen, []string{"abc", "xy", ""}, 1, 2, []string{"a", "b"})
+
+	// Rows of the primary screen move to the history while the alternate screen is active
+	screen = newTerminalScreen(3, 10, 1024)
+	screen.Write([]byte("a\r\nb\r\nc\x1b[?1049h\x1b[Hmenu"))
+	screen.Resize(1, 10)
+	checkScreen(t, screen, []string{"menu"}, 0, 4, []string{"a", "b"})
+	screen.Write([]byte("\x1b[?1049l"))
+	checkScreen(t, screen, []string{"c"}, 0, 1, []string{"a", "b"})
+}
+
+func TestTerminalScreenReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"short output", "hello\r\nworld"},
+		{"history and colors", "\x1b]0;backup\x07" + strings.Repeat("\x1b[1;38;5;208mline\x1b[0m \x1b[48;2;10;20;30mbg\x1b[K\r\n", 8) + "\x1b[7mprompt> "},
+		{"wide characters and pending wrap", "界界界界界"},
+		{"scroll region and origin mode", "1\r\n2\r\n3\r\n4\r\n5\x1b[2;4r\x1b[?6h\x1b[2;3Hx"},
+		{"modes", "\x1b[?25l\x1b[?1h\x1b[?2004h\x1b=\x1b[4h\x1b(0\x1b)0\x0eqqq"},
+		{"alternate screen", "shell$ \x1b[?1049h\x1b[Hmenu\r\n\x1b[44m item \x1b[m"},
+		{"autowrap off", "\x1b[?7l" + strings.Repeat("x", 12)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			screen := newTerminalScreen(5, 10, 4096)
+			screen.Write([]byte(test.output))
+
+			replayed := newTerminalScreen(5, 10, 4096)
+			replayed.Write([]byte(screen.Replay()))
+
+			if got, want := replayed.Snapshot(100), screen.Snapshot(100); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed screen differs:\n got %+v\nwant %+v", got, want)
+			}
+			if got, want := replayed.Replay(), screen.Replay(); got != want {
+				t.Errorf("replay of the replayed screen differs:\n got %q\nwant %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const (
+	defaultScriptStepTimeout = 60 * time.Second
+	maxScriptSteps           = 200
+	maxScriptSendBytes       = maxInputSize - 1 // Room for the newline
+
+	// scriptMatchWindow bounds the output kept for matching the next step
+	scriptMatchWindow = 64 * 1024
+	// scriptTranscriptBytes bounds the output returned with a run result
+	scriptTranscriptBytes = 256 * 1024
+
+	// scriptPromptGrace is how long a menu or prompt may wait for output that
+	// matches the current step; lib_ui.sh announces prompts before printing them
+	scriptPromptGrace = 500 * time.Millisecond
+
+	// Finished runs are kept this long for GET /api/sessions/:id/run
+	scriptResultRetention = time.Hour
+)
+
+// Script run states and failure reasons
+const (
+	scriptStateRunning   = "running"
+	scriptStateSucceeded = "succeeded"
+	scriptStateFailed    = "failed"
+
+	scriptFailUnexpectedPrompt = "unexpected_prompt" // A menu or prompt appeared that no step expects
+	scriptFailStepTimeout      = "step_timeout"      // The expected output did not appear in time
+	scriptFailEndedEarly       = "ended_early"       // The module exited before every step was answered
+	scriptFailModuleFailed     = "module_failed"     // The module exited with an error
+	scriptFailStopped          = "stopped"           // The session was stopped from outside
+
+	stopReasonScript = "script" // The run stopped the session
+)
+
+// Ways a script run finishes after its last step
+const (
+	scriptFinishExit   = "exit"   // Wait for the module to exit with status 0
+	scriptFinishPrompt = "prompt" // Stop the session at the next menu or prompt
+)
+
+// ScriptStep answers one expected prompt
+type ScriptStep struct {
+	Expect         string `json:"expect"`                    // Regular expression matched against the output (ANSI codes removed)
+	Send           string `json:"send"`                      // Answer; a newline is appended
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"` // Time to wait for Expect (defaults to the run's timeout)
+}
+
+// RunModuleRequest is the body of POST /api/modules/:id/run
+type RunModuleRequest struct {
+	StartModuleRequest
+	Steps          []ScriptStep `json:"steps"`
+	TimeoutSeconds int          `json:"timeout_seconds,omitempty"` // Default per-step timeout
+	Finish         string       `json:"finish,omitempty"`          // exit (default) or prompt
+}
+
+// ScriptRunResult describes the progress and outcome of a scripted run
+type ScriptRunResult struct {
+	SessionID  string       `json:"session_id"`
+	Module     string       `json:"module"`
+	State      string       `json:"state"`
+	Reason     string       `json:"reason,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	Answered   int          `json:"answered"` // Steps answered so far
+	Steps      int          `json:"steps"`
+	ExitCode   *int         `json:"exit_code,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	EndedAt    *time.Time   `json:"ended_at,omitempty"`
+	Prompt     *StreamEvent `json:"prompt,omitempty"`     // The unexpected menu or prompt
+	Transcript string       `json:"transcript,omitempty"` // Output of a failed run, ANSI codes removed
+}
+
+// compiledScriptStep is a validated step
+type compiledScriptStep struct {
+	expect  *regexp.Regexp
+	send    string
+	timeout time.Duration
+}
+
+// scriptRun drives one session through its steps
+type scriptRun struct {
+	session *ModuleSession
+	steps   []compiledScriptStep
+	finish  string
+
+	mutex  sync.Mutex
+	result ScriptRunResult
+	done   chan struct{} // Closed once the result is final
+
+	window     strings.Builder // Output since the last answer, for matching
+	transcript strings.Builder // Output of the whole run, for the result
+	filter     plainTextFilter
+}
+
+// plainTextFilter turns PTY output into plain text for matching by removing
+// ANSI sequences and carriage returns
+type plainTextFilter struct {
+	carry string // Incomplete escape sequence at the end of the last write
+}
+
+// Write returns data as plain text. Modules write unbuffered, so escape
+// sequences are often split across reads; an incomplete one is held back.
+func (f *plainTextFilter) Write(data string) string {
+	data = f.carry + data
+	f.carry = ""
+	if i := strings.LastIndexByte(data, '\x1b'); i >= 0 && len(data)-i < 32 {
+		if loc := ansiSequencePattern.FindStringIndex(data[i:]); loc == nil || loc[0] != 0 {
+			f.carry = data[i:]
+			data = data[:i]
+		}
+	}
+	return strings.ReplaceAll(ansiSequencePattern.ReplaceAllString(data, ""), "\r", "")
+}
+
+var scriptRuns = struct {
+	sync.Mutex
+	runs map[string]*scriptRun
+}{runs: make(map[string]*scriptRun)}
+
+// compileScript validates the steps of a run request
+func compileScript(req RunModuleRequest) ([]compiledScriptStep, error) {
+	if len(req.Steps) == 0 {
+		return nil, fmt.Errorf("at least one step is required")
+	}
+	if len(req.Steps) > maxScriptSteps {
+		return nil, fmt.Errorf("too many steps (max %d)", maxScriptSteps)
+	}
+	if req.TimeoutSeconds < 0 {
+		return nil, fmt.Errorf("timeout_seconds must not be negative")
+	}
+
+	defaultTimeout := defaultScriptStepTimeout
+	if req.TimeoutSeconds > 0 {
+		defaultTimeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+
+	steps := make([]compiledScriptStep, 0, len(req.Steps))
+	for i, step := range req.Steps {
+		if step.Expect == "" {
+			return nil, fmt.Errorf("step %d: expect is required", i+1)
+		}
+		expect, err := regexp.Compile(step.Expect)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: invalid expect pattern: %v", i+1, err)
+		}
+		if len(step.Send) > maxScriptSendBytes || strings.ContainsAny(step.Send, "\r\n") {
+			return nil, fmt.Errorf("step %d: send must be a single line of at most %d bytes", i+1, maxScriptSendBytes)
+		}
+		if step.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("step %d: timeout_seconds must not be negative", i+1)
+		}
+
+		timeout := defaultTimeout
+		if step.TimeoutSeconds > 0 {
+			timeout = time.Duration(step.TimeoutSeconds) * time.Second
+		}
+		steps = append(steps, compiledScriptStep{expect: expect, send: step.Send, timeout: timeout})
+	}
+	return steps, nil
+}
+
+// newScriptRun registers a run for a freshly started session
+func newScriptRun(session *ModuleSession, steps []compiledScriptStep, finish string) *scriptRun {
+	run := &scriptRun{
+		session: session,
+		steps:   steps,
+		finish:  finish,
+		done:    make(chan struct{}),
+		result: ScriptRunResult{
+			SessionID: session.ID,
+			Module:    session.Module,
+			State:     scriptStateRunning,
+			Steps:     len(steps),
+			StartedAt: session.CreatedAt,
+		},
+	}
+
+	scriptRuns.Lock()
+	defer scriptRuns.Unlock()
+
+	for id, other := range scriptRuns.runs {
+		if ended := other.snapshot().EndedAt; ended != nil && time.Since(*ended) > scriptResultRetention {
+			delete(scriptRuns.runs, id)
+		}
+	}
+	scriptRuns.runs[session.ID] = run
+	return run
+}
+
+func (r *scriptRun) snapshot() ScriptRunResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.result
+}
+
+// run feeds the session output to the steps until the run succeeds or fails.
+// sub must be subscribed before the module produces output.
+func (r *scriptRun) run(sub *OutputSubscriber) {
+	session := r.session
+	defer session.Stream.Unsubscribe(sub)
+
+	batches := make(chan OutputBatch)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		defer close(batches)
+		for {
+			batch, ok := sub.Next()
+			if !ok {
+				return
+			}
+			select {
+			case batches <- batch:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	step := 0
+	timer := time.NewTimer(r.steps[0].timeout)
+	defer timer.Stop()
+
+	// A menu or prompt that no step answers within scriptPromptGrace is unexpected
+	var unexpected *StreamEvent
+	var graceExpired <-chan time.Time
+	answeredOffset := int64(-1)
+
+	for {
+		select {
+		case batch, ok := <-batches:
+			if !ok {
+				if sub.Lagged() {
+					r.fail(scriptFailStopped, "the run fell behind the module output", nil)
+					return
+				}
+				r.finishWithExit(step)
+				return
+			}
+
+			if batch.Event != nil {
+				// Skip events for output that has already been answered, e.g. a menu
+				// that is announced only after its prompt was printed
+				if (batch.Event.Type == "menu" || batch.Event.Type == "prompt") && batch.Event.Offset > answeredOffset {
+					unexpected = batch.Event
+					graceExpired = time.After(scriptPromptGrace)
+				}
+				continue
+			}
+
+			r.appendOutput(batch.Data)
+			for step < len(r.steps) && r.matchStep(step) {
+				if err := session.writeInput([]byte(r.steps[step].send + "\n")); err != nil {
+					r.fail(scriptFailStopped, fmt.Sprintf("could not answer step %d: %v", step+1, err), nil)
+					return
+				}
+				log.Printf("Script run %s answered step %d of %d", session.ID, step+1, len(r.steps))
+				step++
+				answeredOffset = batch.NextOffset
+				unexpected = nil
+				graceExpired = nil
+				r.mutex.Lock()
+				r.result.Answered = step
+				r.mutex.Unlock()
+				session.Stream.PublishEvent("script_step", fiber.Map{"answered": step, "steps": len(r.steps)})
+
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				if step < len(r.steps) {
+					timer.Reset(r.steps[step].timeout)
+				}
+			}
+
+		case <-graceExpired:
+			if step == len(r.steps) && r.finish == scriptFinishPrompt {
+				r.succeed()
+				session.stop(stopReasonScript)
+				return
+			}
+			r.fail(scriptFailUnexpectedPrompt, fmt.Sprintf("unexpected %s while waiting for step %d", unexpected.Type, step+1), unexpected)
+			return
+
+		case <-timer.C:
+			r.fail(scriptFailStepTimeout, fmt.Sprintf("step %d: %q did not appear within %s", step+1, r.steps[step].expect.String(), r.steps[step].timeout), nil)
+			return
+		}
+	}
+}
+
+// appendOutput adds output to the match window and the transcript
+func (r *scriptRun) appendOutput(data string) {
+	text := r.filter.Write(data)
+
+	r.window.WriteString(text)
+	if r.window.Len() > scriptMatchWindow {
+		tail := r.window.String()[r.window.Len()-scriptMatchWindow:]
+		r.window.Reset()
+		r.window.WriteString(tail)
+	}
+
+	r.transcript.WriteString(text)
+	if r.transcript.Len() > 2*scriptTranscriptBytes {
+		tail := r.transcript.String()[r.transcript.Len()-scriptTranscriptBytes:]
+		r.transcript.Reset()
+		r.transcript.WriteString(tail)
+	}
+}
+
+// matchStep reports whether the output matches the step and, if so, drops the
+// output up to the end of the match so that it cannot answer the next step
+func (r *scriptRun) matchStep(step int) bool {
+	window := r.window.String()
+	match := r.steps[step].expect.FindStringIndex(window)
+	if match == nil {
+		return false
+	}
+	r.window.Reset()
+	r.window.WriteString(window[match[1]:])
+	return true
+}
+
+// finishWithExit decides the outcome once the module has exited
+func (r *scriptRun) finishWithExit(step int) {
+	session := r.session
+
+	sessionManager.mutex.RLock()
+	reason := session.StatusReason
+	status := session.exitStatus
+	sessionManager.mutex.RUnlock()
+
+	var exitCode *int
+	if status != nil && status.Exited() {
+		code := status.ExitStatus()
+		exitCode = &code
+	}
+	r.mutex.Lock()
+	r.result.ExitCode = exitCode
+	r.mutex.Unlock()
+
+	switch {
+	case reason != "" && reason != statusReasonExited && reason != stopReasonScript:
+		r.fail(scriptFailStopped, fmt.Sprintf("session was stopped (%s)", reason), nil)
+	case step < len(r.steps):
+		r.fail(scriptFailEndedEarly, fmt.Sprintf("module ended before step %d was answered", step+1), nil)
+	case exitCode == nil || *exitCode != 0:
+		r.fail(scriptFailModuleFailed, "module did not exit successfully", nil)
+	default:
+		r.succeed()
+	}
+}
+
+func (r *scriptRun) succeed() {
+	r.complete(scriptStateSucceeded, "", "", nil)
+}
+
+// fail records the failure with the transcript and stops the session
+func (r *scriptRun) fail(reason, message string, prompt *StreamEvent) {
+	log.Printf("Script run %s failed: %s", r.session.ID, message)
+	r.complete(scriptStateFailed, reason, message, prompt)
+
+	select {
+	case <-r.session.Done:
+	default:
+		r.session.stop(stopReasonScript)
+	}
+}
+
+func (r *scriptRun) complete(state, reason, message string, prompt *StreamEvent) {
+	endedAt := time.Now()
+
+	r.mutex.Lock()
+	r.result.State = state
+	r.result.Reason = reason
+	r.result.Message = message
+	r.result.Prompt = prompt
+	r.result.EndedAt = &endedAt
+	if state == scriptStateFailed {
+		transcript := r.transcript.String()
+		if len(transcript) > scriptTranscriptBytes {
+			transcript = transcript[len(transcript)-scriptTranscriptBytes:]
+		}
+		r.result.Transcript = transcript
+	}
+	result := r.result
+	r.mutex.Unlock()
+	close(r.done)
+
+	r.session.Stream.PublishEvent("script_finished", result)
+}
+
+// runModule serves POST /api/modules/:id/run
+func runModule(c *fiber.Ctx) error {
+	moduleId := utils.CopyString(c.Params("id"))
+
+	var req RunModuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid run request"})
+	}
+
+	run, startErr := startScriptRun(moduleId, req, requestUser(c))
+	if startErr != nil {
+		return c.Status(startErr.status).JSON(startErr.body)
+	}
+
+	return c.JSON(fiber.Map{
+		"sessionId": run.session.ID,
+		"run":       run.snapshot(),
+	})
+}
+
+// startScriptRun validates the answer script, starts the module and drives
+// the new session through the steps in the background
+func startScriptRun(moduleId string, req RunModuleRequest, user string) (*scriptRun, *moduleStartError) {
+	steps, err := compileScript(req)
+	if err != nil {
+		return nil, newModuleStartError(400, fiber.Map{"error": "Invalid answer script", "message": err.Error()})
+	}
+
+	finish, err := scriptFinish(req.Finish)
+	if err != nil {
+		return nil, newModuleStartError(400, fiber.Map{"error": "Invalid answer script", "message": err.Error()})
+	}
+
+	session, startErr := launchModuleSession(moduleId, req.StartModuleRequest, user)
+	if startErr != nil {
+		return nil, startErr
+	}
+
+	// Subscribe right away; output produced so far is replayed from the scrollback
+	run := newScriptRun(session, steps, finish)
+	go run.run(session.Stream.Subscribe(0))
+	return run, nil
+}
+
+// scriptFinish validates how a run finishes; empty means scriptFinishExit
+func scriptFinish(finish string) (string, error) {
+	switch finish {
+	case "":
+		return scriptFinishExit, nil
+	case scriptFinishExit, scriptFinishPrompt:
+		return finish, nil
+	default:
+		return "", fmt.Errorf("finish must be \"exit\" or \"prompt\"")
+	}
+}
+
+// getScriptRun serves GET /api/sessions/:sessionId/run
+func getScriptRun(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	scriptRuns.Lock()
+	run, exists := scriptRuns.runs[sessionId]
+	scriptRuns.Unlock()
+
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Script run not found"})
+	}
+	if !run.session.canAccess(requestUser(c)) {
+		return sessionErrorResponse(c, errSessionForbidden)
+	}
+	return c.JSON(run.snapshot())
+}
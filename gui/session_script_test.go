@@ -0,0 +1,265 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPlainTextFilterSplitSequences(t *testing.T) {
+	var filter plainTextFilter
+
+	reads := []struct {
+		data string
+		want string
+	}{
+		{"Name\x1b[1", "Name"},
+		{";31m: \x1b", ": "},
+		{"[0m\r\n", "\n"},
+		{"Done.\x1b[K", "Done."},
+	}
+	for _, read := range reads {
+		if got := filter.Write(read.data); got != read.want {
+			t.Errorf("Write(%q) = %q, want %q", read.data, got, read.want)
+		}
+	}
+}
+
+// scriptTestSession is a session without a module: output is published to its
+// stream by the test and answers are read back from its PTY
+type scriptTestSession struct {
+	session *ModuleSession
+	answers chan string
+}
+
+func newScriptTestSession(t *testing.T) *scriptTestSession {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		reader.Close()
+		writer.Close()
+	})
+
+	stream := newOutputStream(minScrollbackBytes, 24, 80)
+	session := &ModuleSession{
+		ID:     "script-test",
+		Module: "test",
+		Status: "running",
+		PTY:    writer,
+		Done:   make(chan struct{}),
+		Stream: stream,
+		events: newGUIEventParser("script-test", stream),
+	}
+
+	answers := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			answers <- scanner.Text()
+		}
+		close(answers)
+	}()
+	return &scriptTestSession{session: session, answers: answers}
+}
+
+// start runs the steps against the session in the background
+func (s *scriptTestSession) start(finish string, steps ...compiledScriptStep) *scriptRun {
+	run := newScriptRun(s.session, steps, finish)
+	go run.run(s.session.Stream.Subscribe(0))
+	return run
+}
+
+// exit ends the session as if the module exited with code
+func (s *scriptTestSession) exit(code int) {
+	status := syscall.WaitStatus(code << 8)
+	sessionManager.mutex.Lock()
+	s.session.StatusReason = statusReasonExited
+	s.session.exitStatus = &status
+	sessionManager.mutex.Unlock()
+	s.session.finish()
+}
+
+// expectAnswer fails unless want is the next answer written to the PTY
+func (s *scriptTestSession) expectAnswer(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-s.answers:
+		if got != want {
+			t.Fatalf("answered %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%q was not answered", want)
+	}
+}
+
+// stopReason waits until the run has closed the PTY and returns the reason
+// the session was stopped for
+func (s *scriptTestSession) stopReason(t *testing.T) string {
+	t.Helper()
+	for {
+		select {
+		case _, ok := <-s.answers:
+			if !ok {
+				sessionManager.mutex.RLock()
+				defer sessionManager.mutex.RUnlock()
+				return s.session.StatusReason
+			}
+		case <-time.After(time.Second):
+			t.Fatal("session was not stopped")
+		}
+	}
+}
+
+func scriptStep(expect, send string, timeout time.Duration) compiledScriptStep {
+	return compiledScriptStep{expect: regexp.MustCompile(expect), send: send, timeout: timeout}
+}
+
+// waitForResult returns the final result of run
+func waitForResult(t *testing.T, run *scriptRun) ScriptRunResult {
+	t.Helper()
+	select {
+	case <-run.done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("script run did not finish")
+	}
+	return run.snapshot()
+}
+
+func TestScriptRunMatchConsumesOutput(t *testing.T) {
+	s := newScriptTestSession(t)
+	run := s.start(scriptFinishExit,
+		scriptStep(`Name:`, "alice", time.Second),
+		scriptStep(`Name:`, "bob", 200*time.Millisecond),
+	)
+
+	s.session.Stream.Publish("test", "Name: ")
+	s.expectAnswer(t, "alice")
+
+	// The prompt answered by the first step must not answer the second one
+	result := waitForResult(t, run)
+	if result.Reason != scriptFailStepTimeout || result.Answered != 1 {
+		t.Errorf("got %s/%s after %d answers, want a step_timeout after 1", result.State, result.Reason, result.Answered)
+	}
+}
+
+func TestScriptRunStepTimerReset(t *testing.T) {
+	s := newScriptTestSession(t)
+	run := s.start(scriptFinishExit,
+		scriptStep(`first\?`, "1", 300*time.Millisecond),
+		scriptStep(`second\?`, "2", 300*time.Millisecond),
+		scriptStep(`third\?`, "3", 300*time.Millisecond),
+	)
+
+	// Each prompt comes within its own timeout, but the run takes longer than one
+	for i, prompt := range []string{"first? ", "second? ", "third? "} {
+		time.Sleep(200 * time.Millisecond)
+		s.session.Stream.Publish("test", prompt)
+		s.expectAnswer(t, string(rune('1'+i)))
+	}
+	s.exit(0)
+
+	if result := waitForResult(t, run); result.State != scriptStateSucceeded {
+		t.Errorf("got %s/%s (%s), want success", result.State, result.Reason, result.Message)
+	}
+}
+
+func TestScriptRunUnexpectedPrompt(t *testing.T) {
+	s := newScriptTestSession(t)
+	run := s.start(scriptFinishExit,
+		scriptStep(`Name:`, "alice", 5*time.Second),
+		scriptStep(`Continue\?`, "y", 5*time.Second),
+	)
+
+	// lib_ui.sh announces a prompt before printing it
+	s.session.Stream.PublishState(stateSlotInteraction, "prompt", PromptEvent{Kind: "input", Message: "Name:"})
+	time.Sleep(scriptPromptGrace / 5)
+	s.session.Stream.Publish("test", "Name: ")
+	s.expectAnswer(t, "alice")
+
+	s.session.Stream.Publish("test", "\r\n")
+	s.session.Stream.PublishState(stateSlotInteraction, "prompt", PromptEvent{Kind: "input", Message: "Password:"})
+	s.session.Stream.Publish("test", "Password: ")
+
+	started := time.Now()
+	result := waitForResult(t, run)
+	if result.Reason != scriptFailUnexpectedPrompt || result.Answered != 1 || result.Prompt == nil {
+		t.Fatalf("got %s/%s after %d answers, want an unexpected_prompt after 1", result.State, result.Reason, result.Answered)
+	}
+	if elapsed := time.Since(started); elapsed < scriptPromptGrace/2 {
+		t.Errorf("run failed after %s, before the prompt grace period", elapsed)
+	}
+	if reason := s.stopReason(t); reason != stopReasonScript {
+		t.Errorf("session stopped with reason %q, want %q", reason, stopReasonScript)
+	}
+}
+
+func TestScriptRunFinishAtPrompt(t *testing.T) {
+	s := newScriptTestSession(t)
+	run := s.start(scriptFinishPrompt, scriptStep(`Name:`, "alice", time.Second))
+
+	s.session.Stream.Publish("test", "Name: ")
+	s.expectAnswer(t, "alice")
+	s.session.Stream.Publish("test", "alice\r\n")
+	s.session.Stream.PublishState(stateSlotInteraction, "menu", MenuEvent{Options: []PromptOption{{Value: "0", Label: "Exit"}}})
+
+	if result := waitForResult(t, run); result.State != scriptStateSucceeded || result.Answered != 1 {
+		t.Errorf("got %s/%s after %d answers, want success after 1", result.State, result.Reason, result.Answered)
+	}
+	if reason := s.stopReason(t); reason != stopReasonScript {
+		t.Errorf("session stopped with reason %q, want %q", reason, stopReasonScript)
+	}
+}
+
+func TestScriptRunExitOutcomes(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		code   int
+		state  string
+		reason string
+	}{
+		{"succeeded", "Name: ", 0, scriptStateSucceeded, ""},
+		{"module failed", "Name: ", 1, scriptStateFailed, scriptFailModuleFailed},
+		{"ended early", "Nothing to do\r\n", 0, scriptStateFailed, scriptFailEndedEarly},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScriptTestSession(t)
+			run := s.start(scriptFinishExit, scriptStep(`Name:`, "alice", time.Second))
+
+			s.session.Stream.Publish("test", test.output)
+			if test.reason != scriptFailEndedEarly {
+				s.expectAnswer(t, "alice")
+			}
+			s.exit(test.code)
+
+			result := waitForResult(t, run)
+			if result.State != test.state || result.Reason != test.reason {
+				t.Errorf("got %s/%s, want %s/%s", result.State, result.Reason, test.state, test.reason)
+			}
+			if result.ExitCode == nil || *result.ExitCode != test.code {
+				t.Errorf("got exit code %v, want %d", result.ExitCode, test.code)
+			}
+			if test.state == scriptStateFailed && !strings.Contains(result.Transcript, strings.TrimSpace(test.output)) {
+				t.Errorf("transcript %q does not hold the module output", result.Transcript)
+			}
+		})
+	}
+}
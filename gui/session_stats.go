@@ -0,0 +1,228 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStatsIntervalSeconds = 5
+
+	// clockTicksPerSecond is USER_HZ, the unit of the CPU times in /proc/<pid>/stat.
+	// It is 100 on every architecture Linux supports today.
+	clockTicksPerSecond = 100
+)
+
+// statsIntervalSeconds is how often running sessions are sampled; 0 disables
+// the stats
+var statsIntervalSeconds = defaultStatsIntervalSeconds
+
+// SessionStats is the resource usage of the process tree of a session, sent
+// to subscribers as "stats" and listed by GET /api/sessions. Rates and CPU
+// usage cover the time since the previous sample; byte totals add up the IO
+// of all processes seen since the session started, including exited ones.
+type SessionStats struct {
+	SampledAt        time.Time      `json:"sampled_at"`
+	CPUPercent       float64        `json:"cpu_percent"` // 100 is one fully used core
+	CPUSeconds       float64        `json:"cpu_seconds"`
+	RSSBytes         uint64         `json:"rss_bytes"`
+	ReadBytes        uint64         `json:"read_bytes"`
+	WriteBytes       uint64         `json:"write_bytes"`
+	ReadBytesPerSec  uint64         `json:"read_bytes_per_sec"`
+	WriteBytesPerSec uint64         `json:"write_bytes_per_sec"`
+	Processes        []ProcessStats `json:"processes"`
+}
+
+// ProcessStats is the usage of one process of the session. IO counters are
+// absent for processes the server may not inspect, e.g. modules started by
+// the root helper.
+type ProcessStats struct {
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	State      string  `json:"state"`
+	Command    string  `json:"command"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSSBytes   uint64  `json:"rss_bytes"`
+	ReadBytes  *uint64 `json:"read_bytes,omitempty"`
+	WriteBytes *uint64 `json:"write_bytes,omitempty"`
+}
+
+// processKey identifies a process across samples even if its PID is reused
+type processKey struct {
+	pid       int
+	startTime uint64
+}
+
+// processCounters are the cumulative counters of a process at one sample
+type processCounters struct {
+	cpuTicks   uint64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+// sessionStats samples the process tree of one session
+type sessionStats struct {
+	mutex     sync.Mutex
+	previous  map[processKey]processCounters
+	sampledAt time.Time
+
+	cpuTicks   uint64 // Totals over all processes seen so far
+	readBytes  uint64
+	writeBytes uint64
+
+	latest *SessionStats
+}
+
+// sample reads /proc for every process of the session led by leaderPid
+func (s *sessionStats) sample(leaderPid int) *SessionStats {
+	now := time.Now()
+	processes := sessionProcesses(leaderPid)
+	pageSize := uint64(os.Getpagesize())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elapsed := now.Sub(s.sampledAt).Seconds()
+	if s.sampledAt.IsZero() {
+		elapsed = 0
+	}
+
+	stats := &SessionStats{SampledAt: now, Processes: make([]ProcessStats, 0, len(processes))}
+	current := make(map[processKey]processCounters, len(processes))
+	var intervalTicks, intervalRead, intervalWrite uint64
+	for _, info := range processes {
+		key := processKey{pid: info.PID, startTime: info.startTime}
+		counters := processCounters{cpuTicks: info.cpuTicks}
+		readBytes, writeBytes, ioErr := readProcessIO(info.PID)
+		if ioErr == nil {
+			counters.readBytes, counters.writeBytes = readBytes, writeBytes
+		}
+		current[key] = counters
+
+		// A process missing from the previous sample started after it, so
+		// everything it used counts towards this interval
+		before := s.previous[key]
+		deltaTicks := counterDelta(counters.cpuTicks, before.cpuTicks)
+		intervalTicks += deltaTicks
+		intervalRead += counterDelta(counters.readBytes, before.readBytes)
+		intervalWrite += counterDelta(counters.writeBytes, before.writeBytes)
+
+		process := ProcessStats{
+			PID:      info.PID,
+			PPID:     info.PPID,
+			State:    info.State,
+			Command:  info.Command,
+			RSSBytes: info.rssPages * pageSize,
+		}
+		if elapsed > 0 {
+			process.CPUPercent = cpuPercent(deltaTicks, elapsed)
+		}
+		if ioErr == nil {
+			process.ReadBytes, process.WriteBytes = &readBytes, &writeBytes
+		}
+		stats.RSSBytes += process.RSSBytes
+		stats.Processes = append(stats.Processes, process)
+	}
+
+	s.cpuTicks += intervalTicks
+	s.readBytes += intervalRead
+	s.writeBytes += intervalWrite
+	s.previous = current
+	s.sampledAt = now
+
+	stats.CPUSeconds = float64(s.cpuTicks) / clockTicksPerSecond
+	stats.ReadBytes = s.readBytes
+	stats.WriteBytes = s.writeBytes
+	if elapsed > 0 {
+		stats.CPUPercent = cpuPercent(intervalTicks, elapsed)
+		stats.ReadBytesPerSec = uint64(float64(intervalRead) / elapsed)
+		stats.WriteBytesPerSec = uint64(float64(intervalWrite) / elapsed)
+	}
+	s.latest = stats
+	return stats
+}
+
+// Latest returns the most recent sample, or nil before the first one
+func (s *sessionStats) Latest() *SessionStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest
+}
+
+func counterDelta(current, previous uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// cpuPercent rounds to one decimal place
+func cpuPercent(ticks uint64, seconds float64) float64 {
+	percent := float64(ticks) / clockTicksPerSecond / seconds * 100
+	return float64(int64(percent*10+0.5)) / 10
+}
+
+// readProcessIO returns the bytes a process caused to be read from and
+// written to storage, from /proc/<pid>/io
+func readProcessIO(pid int) (uint64, uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	var readBytes, writeBytes uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		number, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		switch key {
+		case "read_bytes":
+			readBytes = number
+		case "write_bytes":
+			writeBytes = number
+		}
+	}
+	return readBytes, writeBytes, nil
+}
+
+// watchStats samples the session every statsIntervalSeconds and publishes
+// the result to subscribers until the module exits
+func (s *ModuleSession) watchStats() {
+	if statsIntervalSeconds <= 0 {
+		return
+	}
+
+	// The first sample is the baseline for CPU usage and rates
+	if pid := s.pid(); pid > 0 {
+		s.stats.sample(pid)
+	}
+
+	ticker := time.NewTicker(time.Duration(statsIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.Done:
+			return
+		case <-ticker.C:
+		}
+
+		pid := s.pid()
+		if pid <= 0 {
+			continue
+		}
+		s.Stream.PublishState(stateSlotStats, "stats", s.stats.sample(pid))
+	}
+}
@@ -0,0 +1,509 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultScrollbackBytes is the default size of the per-session replay buffer
+	defaultScrollbackBytes = 1 << 20
+	// minScrollbackBytes and maxScrollbackBytes bound CFG_LH_GUI_SCROLLBACK_BYTES
+	minScrollbackBytes = 4 << 10
+	maxScrollbackBytes = 64 << 20
+	// maxPendingBytes is the amount of undelivered output a subscriber may queue
+	// before the PTY reader pauses and waits for it
+	maxPendingBytes = 1 << 20
+)
+
+var (
+	// scrollbackBytes is the replay buffer size used for new sessions
+	scrollbackBytes = defaultScrollbackBytes
+
+	// subscriberStallTimeout is how long the PTY reader waits for a subscriber
+	// above maxPendingBytes before that subscriber is disconnected as lagging
+	subscriberStallTimeout = 15 * time.Second
+)
+
+// OutputBatch is a run of consecutive output coalesced into a single message.
+// Offset is the stream position of its first byte, NextOffset the position
+// right after its last byte. A batch carrying an Event has no output.
+//
+// A Snapshot batch starts with a redraw of the screen and its history as of
+// Offset, followed by the output published after Offset.
+type OutputBatch struct {
+	Offset     int64
+	NextOffset int64
+	Data       string
+	Event      *StreamEvent
+	Snapshot   bool
+}
+
+// StreamEvent is a control message delivered to subscribers in order with the
+// output, e.g. a timeout warning. Events are not kept in the scrollback.
+type StreamEvent struct {
+	Type    string      `json:"type"`
+	Content interface{} `json:"content"`
+	Offset  int64       `json:"offset"` // End of the output published before the event
+}
+
+// pendingItem is queued output or an event waiting for a subscriber
+type pendingItem struct {
+	offset     int64
+	nextOffset int64
+	data       strings.Builder
+	event      *StreamEvent
+	snapshot   bool
+}
+
+// ScrollbackBuffer is a fixed-size ring of the most recent session output.
+// Positions are absolute byte offsets since the session started, so a client
+// can ask for everything after the last offset it has seen.
+type ScrollbackBuffer struct {
+	data  []byte
+	head  int   // Index in data where the next byte is written
+	start int64 // Offset of the oldest retained byte
+	end   int64 // Offset right after the newest byte
+}
+
+func newScrollbackBuffer(capacity int) *ScrollbackBuffer {
+	return &ScrollbackBuffer{data: make([]byte, capacity)}
+}
+
+// Write appends p and returns the offset of its first byte
+func (r *ScrollbackBuffer) Write(p []byte) int64 {
+	offset := r.end
+	r.end += int64(len(p))
+
+	capacity := len(r.data)
+	if len(p) >= capacity {
+		copy(r.data, p[len(p)-capacity:])
+		r.head = 0
+	} else {
+		n := copy(r.data[r.head:], p)
+		copy(r.data, p[n:])
+		r.head = (r.head + len(p)) % capacity
+	}
+
+	if r.end-r.start > int64(capacity) {
+		r.start = r.end - int64(capacity)
+	}
+	return offset
+}
+
+// ReadFrom returns the retained output from offset onwards. If offset is no
+// longer retained, the result starts at the oldest retained byte; from reports
+// the offset actually used.
+func (r *ScrollbackBuffer) ReadFrom(offset int64) (data []byte, from int64) {
+	if offset < r.start {
+		offset = r.start
+	}
+	if offset >= r.end {
+		return nil, r.end
+	}
+
+	length := int(r.end - offset)
+	capacity := len(r.data)
+	begin := (r.head - length + capacity) % capacity
+
+	data = make([]byte, length)
+	n := copy(data, r.data[begin:min(begin+length, capacity)])
+	copy(data[n:], r.data[:length-n])
+	return data, offset
+}
+
+// Start returns the offset of the oldest retained byte
+func (r *ScrollbackBuffer) Start() int64 {
+	return r.start
+}
+
+// End returns the offset right after the newest byte
+func (r *ScrollbackBuffer) End() int64 {
+	return r.end
+}
+
+// OutputStream fans the output of one session out to any number of subscribers.
+// Every subscriber has its own queue, so one browser tab can no longer steal
+// output from another, and the end of the stream is signalled to all of them.
+//
+// Delivery is lossless: output that a subscriber has not picked up yet is
+// coalesced into its pending batch, and when that batch grows beyond
+// maxPendingBytes, Publish blocks. Since Publish runs on the PTY reader, the
+// module is paused by the kernel until the subscriber catches up.
+type OutputStream struct {
+	mutex       sync.Mutex
+	scrollback  *ScrollbackBuffer
+	screen      *terminalScreen // The terminal as it looks after the published output
+	subscribers map[*OutputSubscriber]struct{}
+	states      []streamState // Latest state events, replayed to new subscribers
+	closed      bool
+}
+
+// streamState is the latest event published for a state slot
+type streamState struct {
+	slot  string
+	event *StreamEvent
+}
+
+// OutputSubscriber receives the output of a session through Next
+type OutputSubscriber struct {
+	stream       *OutputStream
+	notify       chan struct{} // Signalled when output is pending or the subscriber ends
+	drained      chan struct{} // Signalled when pending output has been taken
+	pending      []*pendingItem
+	pendingBytes int // Undelivered output in pending
+	ended        bool
+	lagged       bool
+}
+
+func newOutputStream(capacity int, rows, cols uint16) *OutputStream {
+	return &OutputStream{
+		scrollback:  newScrollbackBuffer(capacity),
+		screen:      newTerminalScreen(int(rows), int(cols), capacity),
+		subscribers: make(map[*OutputSubscriber]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber. Retained output from sinceOffset
+// onwards is queued as its first batch under the same lock as Publish, so
+// replay and live output neither overlap nor leave a gap. A negative
+// sinceOffset, one beyond the end of the stream or one that is no longer
+// retained gets a snapshot of the screen and its history instead.
+func (s *OutputStream) Subscribe(sinceOffset int64) *OutputSubscriber {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub := &OutputSubscriber{
+		stream:  s,
+		notify:  make(chan struct{}, 1),
+		drained: make(chan struct{}, 1),
+	}
+	if sinceOffset < s.scrollback.Start() || sinceOffset > s.scrollback.End() {
+		sub.queueSnapshot(s.scrollback.End(), s.screen.Replay())
+	} else {
+		data, from := s.scrollback.ReadFrom(sinceOffset)
+		sub.queue(from, string(data))
+	}
+	for _, state := range s.states {
+		sub.queueEvent(state.event)
+	}
+
+	if s.closed {
+		sub.end()
+		return sub
+	}
+
+	s.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes the subscriber; it is safe to call more than once
+func (s *OutputStream) Unsubscribe(sub *OutputSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.subscribers, sub)
+	sub.end()
+}
+
+// Publish stores output in the scrollback buffer and queues it for every
+// subscriber. It blocks while a subscriber has too much undelivered output.
+func (s *OutputStream) Publish(sessionId, data string) {
+	if data == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+
+	offset := s.scrollback.Write([]byte(data))
+	s.screen.Write([]byte(data))
+	for sub := range s.subscribers {
+		sub.queue(offset, data)
+	}
+	s.mutex.Unlock()
+
+	s.waitForSlowSubscribers(sessionId)
+}
+
+// PublishEvent queues a control message for every subscriber behind the
+// output published so far. Events do not count towards backpressure.
+func (s *OutputStream) PublishEvent(eventType string, content interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	event := &StreamEvent{Type: eventType, Content: content, Offset: s.scrollback.End()}
+	for sub := range s.subscribers {
+		sub.queueEvent(event)
+	}
+}
+
+// PublishState publishes an event that describes the current state of the
+// session, e.g. the menu waiting for a choice. The latest event of every slot
+// is kept and queued for later subscribers right after the replayed output.
+func (s *OutputStream) PublishState(slot, eventType string, content interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	event := &StreamEvent{Type: eventType, Content: content, Offset: s.scrollback.End()}
+	replaced := false
+	for i := range s.states {
+		if s.states[i].slot == slot {
+			s.states[i].event = event
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.states = append(s.states, streamState{slot: slot, event: event})
+	}
+
+	for sub := range s.subscribers {
+		sub.queueEvent(event)
+	}
+}
+
+// State returns the latest event of a slot, or nil if there is none
+func (s *OutputStream) State(slot string) *StreamEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, state := range s.states {
+		if state.slot == slot {
+			return state.event
+		}
+	}
+	return nil
+}
+
+// ClearState forgets the state of a slot; it is not announced to subscribers
+func (s *OutputStream) ClearState(slot string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.states {
+		if s.states[i].slot == slot {
+			s.states = append(s.states[:i], s.states[i+1:]...)
+			return
+		}
+	}
+}
+
+// waitForSlowSubscribers applies backpressure until every subscriber is below
+// maxPendingBytes. Subscribers that stay above it for subscriberStallTimeout
+// are disconnected so that one stalled client cannot freeze the module.
+func (s *OutputStream) waitForSlowSubscribers(sessionId string) {
+	deadline := time.Now().Add(subscriberStallTimeout)
+
+	for {
+		s.mutex.Lock()
+		var slow *OutputSubscriber
+		for sub := range s.subscribers {
+			if sub.pendingBytes > maxPendingBytes {
+				slow = sub
+				break
+			}
+		}
+		s.mutex.Unlock()
+
+		if slow == nil {
+			return
+		}
+
+		remaining := time.Until(deadline)
+		if remaining > 0 {
+			timer := time.NewTimer(remaining)
+			select {
+			case <-slow.drained:
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+		}
+
+		s.mutex.Lock()
+		for sub := range s.subscribers {
+			if sub.pendingBytes > maxPendingBytes {
+				log.Printf("Subscriber for session %s did not keep up, disconnecting it", sessionId)
+				delete(s.subscribers, sub)
+				sub.lagged = true
+				sub.end()
+			}
+		}
+		s.mutex.Unlock()
+		return
+	}
+}
+
+// Close ends the stream. Subscribers receive what is already queued and then
+// see Next report the end of the stream.
+func (s *OutputStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		sub.end()
+	}
+}
+
+// Resize applies a new terminal size to the screen model
+func (s *OutputStream) Resize(rows, cols uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.screen.Resize(int(rows), int(cols))
+}
+
+// Screen returns the current screen with up to scrollbackLines lines of history
+func (s *OutputStream) Screen(scrollbackLines int) ScreenSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := s.screen.Snapshot(scrollbackLines)
+	snapshot.Offset = s.scrollback.End()
+	return snapshot
+}
+
+// EndOffset returns the offset right after the most recent output
+func (s *OutputStream) EndOffset() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.scrollback.End()
+}
+
+// Recent returns up to maxBytes of the most recent output
+func (s *OutputStream) Recent(maxBytes int) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, _ := s.scrollback.ReadFrom(s.scrollback.End() - int64(maxBytes))
+	return string(data)
+}
+
+// SubscriberCount returns the number of attached subscribers
+func (s *OutputStream) SubscriberCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.subscribers)
+}
+
+// queue appends output at offset to the pending batch; the stream lock must be held
+func (sub *OutputSubscriber) queue(offset int64, data string) {
+	if sub.ended || data == "" {
+		return
+	}
+
+	// Coalesce with the last pending output unless an event was queued after it
+	var item *pendingItem
+	if n := len(sub.pending); n > 0 && sub.pending[n-1].event == nil {
+		item = sub.pending[n-1]
+	} else {
+		item = &pendingItem{offset: offset}
+		sub.pending = append(sub.pending, item)
+	}
+	item.data.WriteString(data)
+	item.nextOffset = offset + int64(len(data))
+	sub.pendingBytes += len(data)
+	signal(sub.notify)
+}
+
+// queueSnapshot queues a redraw of the screen as of offset; the stream lock
+// must be held. Output published later is appended to the same batch.
+func (sub *OutputSubscriber) queueSnapshot(offset int64, data string) {
+	if sub.ended || data == "" {
+		return
+	}
+	item := &pendingItem{offset: offset, nextOffset: offset, snapshot: true}
+	item.data.WriteString(data)
+	sub.pending = append(sub.pending, item)
+	sub.pendingBytes += len(data)
+	signal(sub.notify)
+}
+
+// queueEvent appends a control message; the stream lock must be held
+func (sub *OutputSubscriber) queueEvent(event *StreamEvent) {
+	if sub.ended {
+		return
+	}
+	sub.pending = append(sub.pending, &pendingItem{event: event})
+	signal(sub.notify)
+}
+
+// end marks the subscriber as finished; the stream lock must be held
+func (sub *OutputSubscriber) end() {
+	sub.ended = true
+	signal(sub.notify)
+	signal(sub.drained)
+}
+
+// Next blocks until output is available and returns it as one coalesced batch,
+// or the next event when one was queued before further output.
+// It returns false once the subscriber has ended and everything queued before
+// that point has been delivered.
+func (sub *OutputSubscriber) Next() (OutputBatch, bool) {
+	for {
+		sub.stream.mutex.Lock()
+		if len(sub.pending) > 0 && !sub.lagged {
+			item := sub.pending[0]
+			sub.pending[0] = nil
+			sub.pending = sub.pending[1:]
+
+			batch := OutputBatch{Event: item.event, Snapshot: item.snapshot}
+			if item.event == nil {
+				batch.Offset = item.offset
+				batch.NextOffset = item.nextOffset
+				batch.Data = item.data.String()
+				sub.pendingBytes -= len(batch.Data)
+			}
+			sub.stream.mutex.Unlock()
+			signal(sub.drained)
+			return batch, true
+		}
+		if sub.ended {
+			sub.stream.mutex.Unlock()
+			return OutputBatch{}, false
+		}
+		sub.stream.mutex.Unlock()
+
+		<-sub.notify
+	}
+}
+
+// Lagged reports whether the subscriber was disconnected for falling behind
+func (sub *OutputSubscriber) Lagged() bool {
+	sub.stream.mutex.Lock()
+	defer sub.stream.mutex.Unlock()
+	return sub.lagged
+}
+
+// signal performs a non-blocking send on a buffered notification channel
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrollbackBufferWraparound(t *testing.T) {
+	buffer := newScrollbackBuffer(8)
+
+	if offset := buffer.Write([]byte("abcde")); offset != 0 {
+		t.Fatalf("first write at offset %d, want 0", offset)
+	}
+	if offset := buffer.Write([]byte("fghij")); offset != 5 {
+		t.Fatalf("second write at offset %d, want 5", offset)
+	}
+	if buffer.Start() != 2 || buffer.End() != 10 {
+		t.Fatalf("retained %d-%d, want 2-10", buffer.Start(), buffer.End())
+	}
+
+	data, from := buffer.ReadFrom(4)
+	if string(data) != "efghij" || from != 4 {
+		t.Errorf("ReadFrom(4) = %q at %d, want \"efghij\" at 4", data, from)
+	}
+
+	// Longer than the ring: only the tail is kept
+	buffer.Write([]byte("0123456789"))
+	data, from = buffer.ReadFrom(0)
+	if string(data) != "23456789" || from != 12 {
+		t.Errorf("after an oversized write ReadFrom(0) = %q at %d, want \"23456789\" at 12", data, from)
+	}
+}
+
+func TestScrollbackBufferEvictedOffset(t *testing.T) {
+	buffer := newScrollbackBuffer(4)
+	buffer.Write([]byte("abcdefgh"))
+
+	// The gap shows in from being later than the requested offset
+	data, from := buffer.ReadFrom(1)
+	if string(data) != "efgh" || from != 4 {
+		t.Errorf("ReadFrom(1) = %q at %d, want \"efgh\" at 4", data, from)
+	}
+
+	data, from = buffer.ReadFrom(20)
+	if len(data) != 0 || from != 8 {
+		t.Errorf("ReadFrom beyond the end = %q at %d, want nothing at 8", data, from)
+	}
+}
+
+// nextBatch returns the next batch of sub or fails after a second
+func nextBatch(t *testing.T, sub *OutputSubscriber) (OutputBatch, bool) {
+	t.Helper()
+
+	type result struct {
+		batch OutputBatch
+		ok    bool
+	}
+	results := make(chan result, 1)
+	go func() {
+		batch, ok := sub.Next()
+		results <- result{batch, ok}
+	}()
+
+	select {
+	case r := <-results:
+		return r.batch, r.ok
+	case <-time.After(time.Second):
+		t.Fatal("no batch within a second")
+		return OutputBatch{}, false
+	}
+}
+
+func TestOutputStreamResumeSinceOffset(t *testing.T) {
+	stream := newOutputStream(minScrollbackBytes, 24, 80)
+	stream.Publish("test", "first line\r\n")
+	stream.Publish("test", "second line\r\n")
+
+	sub := stream.Subscribe(int64(len("first line\r\n")))
+	defer stream.Unsubscribe(sub)
+
+	batch, _ := nextBatch(t, sub)
+	if batch.Snapshot || batch.Data != "second line\r\n" || batch.Offset != 12 || batch.NextOffset != 25 {
+		t.Fatalf("resumed batch = %+v, want the second line at 12-25", batch)
+	}
+
+	stream.Publish("test", "third")
+	batch, _ = nextBatch(t, sub)
+	if batch.Data != "third" || batch.Offset != 25 {
+		t.Errorf("live batch = %+v, want \"third\" at 25", batch)
+	}
+}
+
+func TestOutputStreamSnapshotForEvictedOffset(t *testing.T) {
+	stream := newOutputStream(minScrollbackBytes, 24, 80)
+	for i := 0; i < 10; i++ {
+		stream.Publish("test", strings.Repeat("x", 1000)+"\r\n")
+	}
+
+	sub := stream.Subscribe(0)
+	defer stream.Unsubscribe(sub)
+
+	batch, _ := nextBatch(t, sub)
+	if !batch.Snapshot || batch.Offset != stream.EndOffset() {
+		t.Errorf("batch for an evicted offset = snapshot %v at %d, want a snapshot at %d", batch.Snapshot, batch.Offset, stream.EndOffset())
+	}
+}
+
+func TestOutputStreamEventsKeepOrder(t *testing.T) {
+	stream := newOutputStream(minScrollbackBytes, 24, 80)
+	stream.PublishState("menu", "menu", "main")
+
+	sub := stream.Subscribe(0)
+	defer stream.Unsubscribe(sub)
+
+	stream.Publish("test", "before")
+	stream.PublishEvent("warning", nil)
+	stream.Publish("test", "after")
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		batch, _ := nextBatch(t, sub)
+		if batch.Event != nil {
+			got = append(got, "event:"+batch.Event.Type)
+		} else {
+			got = append(got, batch.Data)
+		}
+	}
+	want := []string{"event:menu", "before", "event:warning", "after"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOutputStreamDisconnectsLaggingSubscriber(t *testing.T) {
+	previous := subscriberStallTimeout
+	subscriberStallTimeout = 50 * time.Millisecond
+	defer func() { subscriberStallTimeout = previous }()
+
+	stream := newOutputStream(minScrollbackBytes, 24, 80)
+	slow := stream.Subscribe(0)
+	fast := stream.Subscribe(0)
+	defer stream.Unsubscribe(fast)
+
+	// Publish blocks for the stall timeout and then drops the slow subscriber
+	published := make(chan struct{})
+	go func() {
+		stream.Publish("test", strings.Repeat("x", maxPendingBytes+1))
+		close(published)
+	}()
+
+	if batch, _ := nextBatch(t, fast); len(batch.Data) != maxPendingBytes+1 {
+		t.Fatalf("fast subscriber got %d bytes, want %d", len(batch.Data), maxPendingBytes+1)
+	}
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish did not return after the stall timeout")
+	}
+
+	if !slow.Lagged() {
+		t.Error("slow subscriber is not marked as lagged")
+	}
+	if _, ok := nextBatch(t, slow); ok {
+		t.Error("lagged subscriber still receives output")
+	}
+	if stream.SubscriberCount() != 1 {
+		t.Errorf("%d subscribers left, want 1", stream.SubscriberCount())
+	}
+}
+
+func TestOutputStreamCloseDeliversQueuedOutput(t *testing.T) {
+	stream := newOutputStream(minScrollbackBytes, 24, 80)
+	sub := stream.Subscribe(0)
+
+	stream.Publish("test", "last words")
+	stream.Close()
+
+	if batch, ok := nextBatch(t, sub); !ok || batch.Data != "last words" {
+		t.Fatalf("got %+v, %v; want the queued output", batch, ok)
+	}
+	if _, ok := nextBatch(t, sub); ok {
+		t.Error("subscriber did not end after Close")
+	}
+}
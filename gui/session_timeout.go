@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	defaultTimeoutWarningSeconds = 60
+	timeoutCheckInterval         = time.Second
+)
+
+// Reasons a session was stopped by the GUI, reported as status_reason
+const (
+	stopReasonUser       = "user"         // DELETE /api/sessions/:id
+	stopReasonShutdown   = "shutdown"     // The GUI server shut down
+	stopReasonIdle       = "idle_timeout" // No input and no output for too long
+	stopReasonMaxRuntime = "max_runtime"  // The session ran longer than allowed
+	statusReasonExited   = "exited"       // The module ended on its own
+)
+
+// Global session timeouts from general.d/30-gui.conf (0 disables a timeout)
+var (
+	idleTimeoutMinutes    = 0
+	maxRuntimeMinutes     = 0
+	timeoutWarningSeconds = defaultTimeoutWarningSeconds
+)
+
+// TimeoutInfo overrides the global session timeouts for one module. A missing
+// value uses the global setting, 0 disables the timeout for the module.
+type TimeoutInfo struct {
+	IdleMinutes       *int `json:"idle_minutes,omitempty"`
+	MaxRuntimeMinutes *int `json:"max_runtime_minutes,omitempty"`
+}
+
+// sessionTimeouts returns the idle timeout and maximum runtime of a module
+func sessionTimeouts(overrides *TimeoutInfo) (time.Duration, time.Duration) {
+	idle, runtime := idleTimeoutMinutes, maxRuntimeMinutes
+	if overrides != nil {
+		if overrides.IdleMinutes != nil {
+			idle = *overrides.IdleMinutes
+		}
+		if overrides.MaxRuntimeMinutes != nil {
+			runtime = *overrides.MaxRuntimeMinutes
+		}
+	}
+	return time.Duration(max(idle, 0)) * time.Minute, time.Duration(max(runtime, 0)) * time.Minute
+}
+
+// TimeoutWarning is sent to subscribers as "timeout_warning" before a session
+// is stopped, and with SecondsRemaining 0 as "session_timeout" when it is
+type TimeoutWarning struct {
+	Reason           string    `json:"reason"`
+	SecondsRemaining int       `json:"seconds_remaining"`
+	Deadline         time.Time `json:"deadline"`
+}
+
+// touch records input or output as activity for the idle timeout
+func (s *ModuleSession) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// nextDeadline returns the earliest timeout of the session and its reason
+func (s *ModuleSession) nextDeadline() (time.Time, string) {
+	var deadline time.Time
+	var reason string
+
+	if s.MaxRuntime > 0 {
+		deadline = s.CreatedAt.Add(s.MaxRuntime)
+		reason = stopReasonMaxRuntime
+	}
+	if s.IdleTimeout > 0 {
+		idleDeadline := time.Unix(0, s.lastActivity.Load()).Add(s.IdleTimeout)
+		if reason == "" || idleDeadline.Before(deadline) {
+			deadline = idleDeadline
+			reason = stopReasonIdle
+		}
+	}
+	return deadline, reason
+}
+
+// watchTimeouts stops the session once it has been idle or running for too
+// long. Subscribers are warned timeoutWarningSeconds ahead; the warning is
+// withdrawn with "timeout_cleared" when activity pushes the idle deadline back.
+func (s *ModuleSession) watchTimeouts() {
+	if s.IdleTimeout <= 0 && s.MaxRuntime <= 0 {
+		return
+	}
+
+	warningPeriod := time.Duration(timeoutWarningSeconds) * time.Second
+	ticker := time.NewTicker(timeoutCheckInterval)
+	defer ticker.Stop()
+
+	warned := ""
+	for {
+		select {
+		case <-s.Done:
+			return
+		case <-ticker.C:
+		}
+
+		deadline, reason := s.nextDeadline()
+		remaining := time.Until(deadline)
+
+		if remaining <= 0 {
+			log.Printf("Stopping session %s (%s): %s", s.ID, s.ModuleName, reason)
+			s.Stream.PublishEvent("session_timeout", TimeoutWarning{Reason: reason, Deadline: deadline})
+			if survivors := s.stop(reason); len(survivors) > 0 {
+				log.Printf("Session %s: %d processes could not be stopped", s.ID, len(survivors))
+			}
+			return
+		}
+
+		if remaining <= warningPeriod {
+			if warned != reason {
+				warned = reason
+				s.Stream.PublishEvent("timeout_warning", TimeoutWarning{
+					Reason:           reason,
+					SecondsRemaining: int(remaining.Round(time.Second) / time.Second),
+					Deadline:         deadline,
+				})
+			}
+		} else if warned != "" {
+			s.Stream.PublishEvent("timeout_cleared", TimeoutWarning{Reason: warned, Deadline: deadline})
+			warned = ""
+		}
+	}
+}
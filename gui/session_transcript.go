@@ -0,0 +1,613 @@
+/*
+Copyright (c) 2025 maschkef
+SPDX-License-Identifier: Apache-2.0
+
+This project is part of the 'little-linux-helper' collection.
+Licensed under the Apache License 2.0. See the LICENSE file in the project root for more information.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	transcriptMetaSuffix   = ".json"
+	transcriptEventsSuffix = ".events.jsonl"
+	transcriptFlushPeriod  = time.Second
+	transcriptPrunePeriod  = time.Hour
+
+	defaultTranscriptRetentionDays = 30
+	defaultTranscriptMaxBytes      = 50 << 20
+)
+
+// Transcript settings, configured from general.d/30-gui.conf
+var (
+	transcriptsEnabled      = true
+	transcriptRetentionDays = defaultTranscriptRetentionDays
+	transcriptMaxBytes      = int64(defaultTranscriptMaxBytes)
+)
+
+var transcriptIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// TranscriptMeta describes a stored session transcript
+type TranscriptMeta struct {
+	SessionID  string     `json:"session_id"`
+	Module     string     `json:"module"`
+	ModuleName string     `json:"module_name"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Status     string     `json:"status"`
+	Rows       uint16     `json:"rows"`
+	Cols       uint16     `json:"cols"`
+	Term       string     `json:"term"`
+	Bytes      int64      `json:"bytes"`                 // Output bytes recorded
+	Truncated  bool       `json:"truncated,omitempty"`   // Recording stopped at the size limit
+	User       string     `json:"user,omitempty"`        // Owner of the session
+	SharedWith []string   `json:"shared_with,omitempty"` // Users with access when the session ended
+}
+
+// errTranscriptForbidden is returned for transcripts of sessions the user may not access
+var errTranscriptForbidden = errors.New("Access to transcript denied")
+
+// TranscriptEvent is one timed entry of a transcript. It is stored as a JSON
+// array [time, type, data] where time is seconds since the session started and
+// type is "o" for output or "r" for a resize to "COLSxROWS".
+type TranscriptEvent struct {
+	Time float64
+	Type string
+	Data string
+}
+
+func (e TranscriptEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+func (e *TranscriptEvent) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("transcript event must have 3 fields, got %d", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &e.Type); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[2], &e.Data)
+}
+
+// TranscriptWriter records the output of one session to disk. All methods are
+// safe to call on a nil writer, which is what sessions get when transcripts are
+// disabled or the store is not writable.
+type TranscriptWriter struct {
+	mutex     sync.Mutex
+	meta      TranscriptMeta
+	file      *os.File
+	writer    *bufio.Writer
+	stopFlush chan struct{}
+	closed    bool
+}
+
+func transcriptDir() string {
+	return filepath.Join(lhRootDir, "logs", "transcripts")
+}
+
+func transcriptPaths(sessionId string) (metaPath string, eventsPath string, ok bool) {
+	if !transcriptIDPattern.MatchString(sessionId) || strings.Contains(sessionId, "..") {
+		return "", "", false
+	}
+	dir := transcriptDir()
+	return filepath.Join(dir, sessionId+transcriptMetaSuffix), filepath.Join(dir, sessionId+transcriptEventsSuffix), true
+}
+
+// newTranscriptWriter creates the transcript files for a session
+func newTranscriptWriter(session *ModuleSession) (*TranscriptWriter, error) {
+	if !transcriptsEnabled {
+		return nil, nil
+	}
+
+	metaPath, eventsPath, ok := transcriptPaths(session.ID)
+	if !ok {
+		return nil, fmt.Errorf("invalid session ID for transcript: %s", session.ID)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(eventsPath), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %w", err)
+	}
+
+	file, err := os.OpenFile(eventsPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript: %w", err)
+	}
+
+	rows, cols := session.size()
+	t := &TranscriptWriter{
+		meta: TranscriptMeta{
+			SessionID:  session.ID,
+			Module:     session.Module,
+			ModuleName: session.ModuleName,
+			StartedAt:  session.CreatedAt,
+			Status:     "running",
+			Rows:       rows,
+			Cols:       cols,
+			Term:       session.Term,
+			User:       session.User,
+		},
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		stopFlush: make(chan struct{}),
+	}
+
+	if err := writeTranscriptMeta(metaPath, t.meta); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	go t.flushPeriodically()
+
+	return t, nil
+}
+
+func (t *TranscriptWriter) flushPeriodically() {
+	ticker := time.NewTicker(transcriptFlushPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.mutex.Lock()
+			if !t.closed {
+				if err := t.writer.Flush(); err != nil {
+					log.Printf("Failed to flush transcript for session %s: %v", t.meta.SessionID, err)
+				}
+			}
+			t.mutex.Unlock()
+		case <-t.stopFlush:
+			return
+		}
+	}
+}
+
+// writeEvent appends an event; the caller must hold the mutex
+func (t *TranscriptWriter) writeEvent(eventType, data string) {
+	event := TranscriptEvent{
+		Time: time.Since(t.meta.StartedAt).Seconds(),
+		Type: eventType,
+		Data: data,
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	if _, err := t.writer.Write(line); err != nil {
+		log.Printf("Failed to write transcript for session %s: %v", t.meta.SessionID, err)
+	}
+}
+
+// WriteOutput records a chunk of PTY output
+func (t *TranscriptWriter) WriteOutput(data string) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed || t.meta.Truncated {
+		return
+	}
+
+	if transcriptMaxBytes > 0 && t.meta.Bytes+int64(len(data)) > transcriptMaxBytes {
+		t.meta.Truncated = true
+		log.Printf("Transcript for session %s reached %d bytes, recording stopped", t.meta.SessionID, transcriptMaxBytes)
+		return
+	}
+
+	t.meta.Bytes += int64(len(data))
+	t.writeEvent("o", data)
+}
+
+// WriteResize records a terminal size change
+func (t *TranscriptWriter) WriteResize(rows, cols uint16) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed || t.meta.Truncated {
+		return
+	}
+	t.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Flush writes buffered events to disk so the file can be read while the
+// session is running
+func (t *TranscriptWriter) Flush() {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return
+	}
+	if err := t.writer.Flush(); err != nil {
+		log.Printf("Failed to flush transcript for session %s: %v", t.meta.SessionID, err)
+	}
+}
+
+// Close flushes the transcript and stores the final session status together
+// with the users who had access to the session
+func (t *TranscriptWriter) Close(status string, sharedWith []string) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return
+	}
+	t.closed = true
+	close(t.stopFlush)
+
+	if err := t.writer.Flush(); err != nil {
+		log.Printf("Failed to flush transcript for session %s: %v", t.meta.SessionID, err)
+	}
+	if err := t.file.Close(); err != nil {
+		log.Printf("Failed to close transcript for session %s: %v", t.meta.SessionID, err)
+	}
+
+	endedAt := time.Now()
+	t.meta.EndedAt = &endedAt
+	t.meta.Status = status
+	t.meta.SharedWith = sharedWith
+
+	if metaPath, _, ok := transcriptPaths(t.meta.SessionID); ok {
+		if err := writeTranscriptMeta(metaPath, t.meta); err != nil {
+			log.Printf("Failed to finalize transcript for session %s: %v", t.meta.SessionID, err)
+		}
+	}
+}
+
+func writeTranscriptMeta(path string, meta TranscriptMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write transcript metadata: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write transcript metadata: %w", err)
+	}
+	return nil
+}
+
+func loadTranscriptMeta(sessionId string) (TranscriptMeta, error) {
+	var meta TranscriptMeta
+
+	metaPath, _, ok := transcriptPaths(sessionId)
+	if !ok {
+		return meta, os.ErrNotExist
+	}
+
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse transcript metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// canAccess reports whether user may read the transcript. While the session
+// runs its current grants apply.
+func (m *TranscriptMeta) canAccess(user string) bool {
+	if session, running := sessionManager.lookupSession(m.SessionID); running {
+		return session.canAccess(user)
+	}
+	return canAccessRecord(user, m.User, m.SharedWith)
+}
+
+// loadTranscriptForUser returns the metadata of a transcript if user may read
+// it. The output of a running session is flushed first, so reads include it.
+func loadTranscriptForUser(sessionId, user string) (TranscriptMeta, error) {
+	if session, running := sessionManager.lookupSession(sessionId); running {
+		session.Transcript.Flush()
+	}
+	meta, err := loadTranscriptMeta(sessionId)
+	if err != nil {
+		return meta, err
+	}
+	if !meta.canAccess(user) {
+		return meta, errTranscriptForbidden
+	}
+	return meta, nil
+}
+
+// transcriptErrorResponse answers a failed loadTranscriptForUser
+func transcriptErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return c.Status(404).JSON(fiber.Map{"error": "Transcript not found"})
+	case errors.Is(err, errTranscriptForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	default:
+		log.Printf("Error loading transcript: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load transcript"})
+	}
+}
+
+// listTranscripts returns the metadata of all stored transcripts, newest first
+func listTranscripts() ([]TranscriptMeta, error) {
+	entries, err := os.ReadDir(transcriptDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []TranscriptMeta{}, nil
+		}
+		return nil, err
+	}
+
+	transcripts := make([]TranscriptMeta, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, transcriptMetaSuffix) {
+			continue
+		}
+
+		meta, err := loadTranscriptMeta(strings.TrimSuffix(name, transcriptMetaSuffix))
+		if err != nil {
+			log.Printf("Warning: skipping transcript %s: %v", name, err)
+			continue
+		}
+		transcripts = append(transcripts, meta)
+	}
+
+	sort.Slice(transcripts, func(i, j int) bool {
+		return transcripts[i].StartedAt.After(transcripts[j].StartedAt)
+	})
+
+	return transcripts, nil
+}
+
+// readTranscriptEvents loads the recorded events of a transcript. A partially
+// written last line of a running session is skipped.
+func readTranscriptEvents(sessionId string) ([]TranscriptEvent, error) {
+	_, eventsPath, ok := transcriptPaths(sessionId)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	file, err := os.Open(eventsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := make([]TranscriptEvent, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var event TranscriptEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return events, err
+	}
+	return events, nil
+}
+
+func deleteTranscriptFiles(sessionId string) error {
+	metaPath, eventsPath, ok := transcriptPaths(sessionId)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	metaErr := os.Remove(metaPath)
+	eventsErr := os.Remove(eventsPath)
+	if errors.Is(metaErr, os.ErrNotExist) && errors.Is(eventsErr, os.ErrNotExist) {
+		return os.ErrNotExist
+	}
+	if metaErr != nil && !errors.Is(metaErr, os.ErrNotExist) {
+		return metaErr
+	}
+	if eventsErr != nil && !errors.Is(eventsErr, os.ErrNotExist) {
+		return eventsErr
+	}
+	return nil
+}
+
+// pruneTranscriptsPeriodically prunes the store at startup and every
+// transcriptPrunePeriod, so it stays bounded on servers that run for a long time
+func pruneTranscriptsPeriodically() {
+	ticker := time.NewTicker(transcriptPrunePeriod)
+	defer ticker.Stop()
+
+	for {
+		pruneTranscripts()
+		<-ticker.C
+	}
+}
+
+// pruneTranscripts removes finished transcripts older than the retention period
+func pruneTranscripts() {
+	if transcriptRetentionDays <= 0 {
+		return
+	}
+
+	transcripts, err := listTranscripts()
+	if err != nil {
+		log.Printf("Warning: could not list transcripts for pruning: %v", err)
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -transcriptRetentionDays)
+	removed := 0
+	for _, meta := range transcripts {
+		if meta.EndedAt == nil || meta.EndedAt.After(cutoff) {
+			continue
+		}
+		if _, running := sessionManager.lookupSession(meta.SessionID); running {
+			continue
+		}
+		if err := deleteTranscriptFiles(meta.SessionID); err != nil {
+			log.Printf("Warning: could not remove transcript %s: %v", meta.SessionID, err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("Removed %d transcripts older than %d days", removed, transcriptRetentionDays)
+	}
+}
+
+// getTranscripts lists the transcripts the user may read
+func getTranscripts(c *fiber.Ctx) error {
+	transcripts, err := listTranscripts()
+	if err != nil {
+		log.Printf("Error listing transcripts: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list transcripts"})
+	}
+
+	user := requestUser(c)
+	module := c.Query("module")
+	filtered := make([]TranscriptMeta, 0, len(transcripts))
+	for _, meta := range transcripts {
+		if (module == "" || meta.Module == module) && meta.canAccess(user) {
+			filtered = append(filtered, meta)
+		}
+	}
+
+	return c.JSON(filtered)
+}
+
+func getTranscript(c *fiber.Ctx) error {
+	meta, err := loadTranscriptForUser(c.Params("sessionId"), requestUser(c))
+	if err != nil {
+		return transcriptErrorResponse(c, err)
+	}
+
+	return c.JSON(meta)
+}
+
+// getTranscriptOutput returns the recorded output as one raw text document
+func getTranscriptOutput(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+	if _, err := loadTranscriptForUser(sessionId, requestUser(c)); err != nil {
+		return transcriptErrorResponse(c, err)
+	}
+
+	events, err := readTranscriptEvents(sessionId)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.Status(404).JSON(fiber.Map{"error": "Transcript not found"})
+		}
+		log.Printf("Error reading transcript: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read transcript"})
+	}
+
+	var output strings.Builder
+	for _, event := range events {
+		if event.Type == "o" {
+			output.WriteString(event.Data)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; charset=utf-8")
+	return c.SendString(output.String())
+}
+
+// getTranscriptEvents returns the timed events for client-side replay. The
+// optional "since" query parameter (seconds) skips earlier events.
+func getTranscriptEvents(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+
+	meta, err := loadTranscriptForUser(sessionId, requestUser(c))
+	if err != nil {
+		return transcriptErrorResponse(c, err)
+	}
+
+	events, err := readTranscriptEvents(sessionId)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error reading transcript: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read transcript"})
+	}
+
+	if raw := c.Query("since"); raw != "" {
+		since, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid since parameter"})
+		}
+		start := sort.Search(len(events), func(i int) bool { return events[i].Time >= since })
+		events = events[start:]
+	}
+
+	return c.JSON(fiber.Map{
+		"transcript": meta,
+		"events":     events,
+	})
+}
+
+// deleteTranscript removes the transcript of an ended session; only its owner may
+func deleteTranscript(c *fiber.Ctx) error {
+	sessionId := c.Params("sessionId")
+	user := requestUser(c)
+
+	meta, err := loadTranscriptForUser(sessionId, user)
+	if err != nil {
+		return transcriptErrorResponse(c, err)
+	}
+	if currentAuthSettings.Mode != authModeNone && user != meta.User {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner can delete a transcript"})
+	}
+
+	if _, running := sessionManager.lookupSession(sessionId); running {
+		return c.Status(409).JSON(fiber.Map{"error": "Session is still active"})
+	}
+
+	if err := deleteTranscriptFiles(sessionId); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.Status(404).JSON(fiber.Map{"error": "Transcript not found"})
+		}
+		log.Printf("Error deleting transcript: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete transcript"})
+	}
+
+	return c.JSON(fiber.Map{"status": "deleted", "session_id": sessionId})
+}
@@ -128,6 +128,7 @@ while true; do
 
     # Build dynamic menu from registry
     declare -A module_menu_map
+    declare -A module_menu_ids
     menu_counter=1
     
     # Get all categories
@@ -176,6 +177,7 @@ while true; do
             
             # Store mapping for later execution
             module_menu_map[$menu_counter]="$module_entry"
+            module_menu_ids[$menu_counter]="$module_id"
             ((menu_counter++))
         done
     done
@@ -198,7 +200,12 @@ while true; do
     # Handle module execution
     if [[ -n "${module_menu_map[$option]}" ]]; then
         module_script="${LH_ROOT_DIR}/${module_menu_map[$option]}"
-        bash "$module_script"
+        module_rc=0
+        lh_run_module_locked "${module_menu_ids[$option]}" "$module_script" || module_rc=$?
+        # A refused run lock (75) has already been reported; keep the menu running
+        if [[ $module_rc -ne 0 && $module_rc -ne 75 ]]; then
+            exit "$module_rc"
+        fi
     else
         lh_log_msg "WARN" "$(lh_msg "LOG_INVALID_SELECTION" "$option")"
         echo -e "${LH_COLOR_WARNING}$(lh_msg "INVALID_SELECTION")${LH_COLOR_RESET}"
@@ -104,6 +104,8 @@ MSG_DE[LIB_SESSION_UNREGISTERED]="Sitzung beendet: %s"
 MSG_DE[LIB_SESSION_DEBUG_NONE]="Keine weiteren Sitzungen aktiv (Modul: %s)"
 MSG_DE[LIB_SESSION_DEBUG_LIST_HEADER]="Aktive Sitzungen vor Start von %s (%d insgesamt):"
 MSG_DE[LIB_SESSION_DEBUG_ENTRY]="%s [%s] %s (%s)"
+MSG_DE[LIB_RUN_LOCK_CONFLICT]="%s kann nicht gestartet werden: blockiert durch %s."
+MSG_DE[LIB_RUN_LOCK_UNAVAILABLE]="Ausführungssperren für %s konnten nicht geprüft werden, Start ohne Sperre."
 
 # Blocking categories and conflict management
 MSG_DE[LIB_BLOCK_FILESYSTEM_WRITE]="Dateioperationen die laufende I/O-Vorgänge stören könnten"
@@ -104,6 +104,8 @@ MSG_EN[LIB_SESSION_UNREGISTERED]="Session ended: %s"
 MSG_EN[LIB_SESSION_DEBUG_NONE]="No other sessions active (module: %s)"
 MSG_EN[LIB_SESSION_DEBUG_LIST_HEADER]="Active sessions before starting %s (%d total):"
 MSG_EN[LIB_SESSION_DEBUG_ENTRY]="%s [%s] %s (%s)"
+MSG_EN[LIB_RUN_LOCK_CONFLICT]="Cannot start %s: it is blocked by %s."
+MSG_EN[LIB_RUN_LOCK_UNAVAILABLE]="Could not check run locks for %s, starting without them."
 
 # Blocking categories and conflict management
 MSG_EN[LIB_BLOCK_FILESYSTEM_WRITE]="File operations that could interfere with ongoing I/O"
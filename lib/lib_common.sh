@@ -24,6 +24,8 @@ LH_LOG_DIR="$LH_LOG_DIR_BASE/$(date '+%Y-%m')"
 LH_SESSION_REGISTRY_DIR="${LH_SESSION_REGISTRY_DIR:-$LH_LOG_DIR_BASE/sessions}"
 LH_SESSION_REGISTRY_FILE="$LH_SESSION_REGISTRY_DIR/registry.tsv"
 LH_SESSION_REGISTRY_LOCK="$LH_SESSION_REGISTRY_DIR/registry.lock"
+LH_RUN_LOCK_DIR="${LH_RUN_LOCK_DIR:-$LH_SESSION_REGISTRY_DIR/run-locks}"
+LH_RUN_LOCK_GUARD="$LH_SESSION_REGISTRY_DIR/run-locks.lock"
 
 # The current log file is set during initialization
 LH_LOG_FILE="${LH_LOG_FILE:-}" # Ensures it exists, but does not overwrite it if it was already set/exported externally.
@@ -642,6 +644,181 @@ lh_end_module_session() {
     lh_unregister_session
 }
 
+# --- Module run locks ----------------------------------------------------------
+# Concurrency rules from the module metadata ("concurrency": single_instance,
+# max_instances, exclusive_groups) and CFG_LH_MODULES_MAX_SESSIONS are enforced
+# through one lock file per running module in $LH_RUN_LOCK_DIR. The GUI server
+# uses the same files, so CLI and GUI sessions block each other.
+
+lh__module_concurrency_rules() {
+    # Prints "<instance limit>\t<space separated exclusive groups>" for a module
+    local module_id="$1"
+    local module_json=""
+
+    if [[ -f "${LH_MODULE_REGISTRY_CACHE_FILE:-}" ]]; then
+        module_json=$(lh_modules_get_module_by_id "$module_id" 2>/dev/null)
+    fi
+    if [[ -z "$module_json" || "$module_json" == "null" ]]; then
+        printf '0\t\n'
+        return 0
+    fi
+
+    echo "$module_json" | jq -r '(.concurrency // {}) |
+        [ (if .single_instance then 1 else (.max_instances // 0) end),
+          ((.exclusive_groups // []) | join(" ")) ] | @tsv' 2>/dev/null || printf '0\t\n'
+}
+
+lh__run_lock_field() {
+    local file="$1"
+    local field="$2"
+    sed -n "s/^${field}=//p" "$file" 2>/dev/null | head -n 1
+}
+
+lh_acquire_run_lock() {
+    # Usage: lh_acquire_run_lock <module_id> [module_name]
+    # Sets LH_RUN_LOCK_FILE on success. On conflict returns 1 and describes the
+    # holding session in LH_RUN_LOCK_CONFLICT.
+    local module_id="$1"
+    local module_name="${2:-$1}"
+    LH_RUN_LOCK_FILE=""
+    LH_RUN_LOCK_CONFLICT=""
+
+    [[ -z "$module_id" ]] && return 1
+
+    local limit groups
+    IFS=$'\t' read -r limit groups < <(lh__module_concurrency_rules "$module_id")
+    [[ "$limit" =~ ^[0-9]+$ ]] || limit=0
+
+    local max_sessions="${CFG_LH_MODULES_MAX_SESSIONS:-0}"
+    [[ "$max_sessions" =~ ^[0-9]+$ ]] || max_sessions=0
+
+    mkdir -p "$LH_RUN_LOCK_DIR"
+    lh_fix_ownership "$LH_SESSION_REGISTRY_DIR" >/dev/null 2>&1 || true
+
+    exec 202>>"$LH_RUN_LOCK_GUARD"
+    if ! flock -w 5 202; then
+        lh_log_msg "WARN" "$(lh_msg 'LIB_SESSION_LOCK_TIMEOUT')"
+        exec 202>&-
+        return 2
+    fi
+
+    local lock_file holder_pid holder_module holder_groups holder_parent
+    local instances=0 top_level=0 conflict_file="" oldest_top_level=""
+    for lock_file in "$LH_RUN_LOCK_DIR"/*.lock; do
+        [[ -f "$lock_file" ]] || continue
+
+        holder_pid=$(lh__run_lock_field "$lock_file" pid)
+        if [[ ! "$holder_pid" =~ ^[0-9]+$ || ! -d "/proc/$holder_pid" ]]; then
+            rm -f "$lock_file"
+            continue
+        fi
+
+        holder_module=$(lh__run_lock_field "$lock_file" module_id)
+        holder_groups=$(lh__run_lock_field "$lock_file" groups)
+        holder_parent=$(lh__run_lock_field "$lock_file" parent)
+
+        if [[ "$holder_module" == "$module_id" ]]; then
+            instances=$((instances + 1))
+            if [[ "$limit" -gt 0 && "$instances" -ge "$limit" && -z "$conflict_file" ]]; then
+                conflict_file="$lock_file"
+            fi
+        fi
+
+        local group
+        for group in $groups; do
+            if [[ " $holder_groups " == *" $group "* && -z "$conflict_file" ]]; then
+                conflict_file="$lock_file"
+            fi
+        done
+
+        if [[ -z "$holder_parent" ]]; then
+            top_level=$((top_level + 1))
+            [[ -z "$oldest_top_level" ]] && oldest_top_level="$lock_file"
+        fi
+    done
+
+    # Modules launched from within another module belong to that session
+    if [[ -z "$conflict_file" && -z "${LH_RUN_LOCK_ID:-}" && "$max_sessions" -gt 0 && "$top_level" -ge "$max_sessions" ]]; then
+        conflict_file="$oldest_top_level"
+    fi
+
+    if [[ -n "$conflict_file" ]]; then
+        LH_RUN_LOCK_CONFLICT="$(lh__run_lock_field "$conflict_file" module_name) ($(lh__run_lock_field "$conflict_file" context), session $(lh__run_lock_field "$conflict_file" session_id), started $(lh__run_lock_field "$conflict_file" started))"
+        flock -u 202
+        exec 202>&-
+        return 1
+    fi
+
+    local session_id started
+    session_id="cli-$(lh_session_generate_id "$module_id")"
+    started=$(date --iso-8601=seconds 2>/dev/null || date '+%Y-%m-%dT%H:%M:%S%z')
+    LH_RUN_LOCK_FILE="$LH_RUN_LOCK_DIR/$session_id.lock"
+
+    {
+        printf 'session_id=%s\n' "$session_id"
+        printf 'module_id=%s\n' "$module_id"
+        printf 'module_name=%s\n' "${module_name//$'\n'/ }"
+        printf 'pid=%s\n' "$BASHPID"
+        printf 'context=%s\n' "CLI"
+        printf 'user=%s\n' "${SUDO_USER:-${USER:-}}"
+        printf 'started=%s\n' "$started"
+        printf 'groups=%s\n' "$groups"
+        printf 'parent=%s\n' "${LH_RUN_LOCK_ID:-}"
+    } >"$LH_RUN_LOCK_FILE"
+    lh_fix_ownership "$LH_RUN_LOCK_FILE" >/dev/null 2>&1 || true
+
+    flock -u 202
+    exec 202>&-
+    return 0
+}
+
+lh_release_run_lock() {
+    local lock_file="${1:-${LH_RUN_LOCK_FILE:-}}"
+    [[ -n "$lock_file" ]] && rm -f "$lock_file"
+    return 0
+}
+
+lh_run_module_locked() {
+    # Usage: lh_run_module_locked <module_id> <script> [args...]
+    # Runs a module script after checking its concurrency rules. Returns 75
+    # (EX_TEMPFAIL) without starting the module when another session holds the lock.
+    local module_id="$1"
+    local module_script="$2"
+    shift 2
+
+    local module_name="$module_id"
+    local module_json
+    module_json=$(lh_modules_get_module_by_id "$module_id" 2>/dev/null)
+    if [[ -n "$module_json" && "$module_json" != "null" ]]; then
+        module_name=$(echo "$module_json" | jq -r '.display.fallback_name // .id' 2>/dev/null || echo "$module_id")
+    fi
+
+    local lock_rc=0
+    lh_acquire_run_lock "$module_id" "$module_name" || lock_rc=$?
+    case $lock_rc in
+        0) ;;
+        1)
+            lh_log_msg "WARN" "$(lh_msg 'LIB_RUN_LOCK_CONFLICT' "$module_name" "$LH_RUN_LOCK_CONFLICT")"
+            echo -e "${LH_COLOR_WARNING}$(lh_msg 'LIB_RUN_LOCK_CONFLICT' "$module_name" "$LH_RUN_LOCK_CONFLICT")${LH_COLOR_RESET}"
+            return 75
+            ;;
+        *)
+            # Lock store unavailable: do not block the user, but leave a trace
+            lh_log_msg "WARN" "$(lh_msg 'LIB_RUN_LOCK_UNAVAILABLE' "$module_name")"
+            ;;
+    esac
+
+    local lock_file="$LH_RUN_LOCK_FILE"
+    local session_id=""
+    [[ -n "$lock_file" ]] && session_id=$(basename "$lock_file" .lock)
+
+    local rc=0
+    LH_RUN_LOCK_ID="${session_id:-${LH_RUN_LOCK_ID:-}}" bash "$module_script" "$@" || rc=$?
+
+    lh_release_run_lock "$lock_file"
+    return $rc
+}
+
 # At the end of the file lib_common.sh
 function lh_finalize_initialization() {
     # Only load general config if not already initialized
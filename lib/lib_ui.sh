@@ -18,6 +18,8 @@ function lh_print_header() {
         dashes="${dashes}-"
     done
 
+    lh_gui_emit_event "{\"type\":\"header\",\"title\":$(lh__gui_json_string "$title")}"
+
     echo ""
     echo -e "${LH_COLOR_HEADER}${dashes}${LH_COLOR_RESET}"
     echo -e "${LH_COLOR_HEADER}| $title |${LH_COLOR_RESET}"
@@ -205,6 +207,8 @@ function lh_print_menu_item() {
     local number="$1"
     local text="$2"
 
+    lh_gui_emit_event "{\"type\":\"menu_item\",\"value\":$(lh__gui_json_string "$number"),\"label\":$(lh__gui_json_string "$text")}"
+
     printf "  ${LH_COLOR_MENU_NUMBER}%2s.${LH_COLOR_RESET} ${LH_COLOR_MENU_TEXT}%s${LH_COLOR_RESET}\n" "$number" "$text"
 }
 
@@ -213,6 +217,54 @@ function lh_gui_mode_active() {
     [[ "${LH_GUI_MODE:-false}" == "true" ]]
 }
 
+# Escapes a string and prints it as a JSON string literal (including quotes)
+# $1: String to escape
+function lh__gui_json_string() {
+    local value="$1"
+
+    value="${value//\\/\\\\}"
+    value="${value//\"/\\\"}"
+    value="${value//$'\n'/\\n}"
+    value="${value//$'\r'/\\r}"
+    value="${value//$'\t'/\\t}"
+    value="${value//$'\e'/\\u001b}"
+    value="${value//$'\a'/}"
+
+    printf '"%s"' "$value"
+}
+
+# Sends a structured event to the GUI. The event travels in-band as an OSC
+# escape sequence (ESC ] 7700 ; llh ; <json> BEL); the GUI backend removes it
+# from the terminal output and forwards it as a typed WebSocket message.
+# Does nothing outside GUI mode.
+# $1: JSON object with a "type" field (header, menu_item, prompt or progress)
+function lh_gui_emit_event() {
+    if ! lh_gui_mode_active; then
+        return 0
+    fi
+
+    printf '\033]7700;llh;%s\a' "$1"
+}
+
+# Reports the progress of a long-running operation to the GUI (GUI mode only)
+# $1: Completed steps
+# $2: Total steps (0 or empty if unknown)
+# $3: (Optional) Description of the current step
+function lh_report_progress() {
+    local current="${1:-0}"
+    local total="${2:-0}"
+    local label="${3:-}"
+
+    if ! lh_gui_mode_active; then
+        return 0
+    fi
+    if ! [[ "$current" =~ ^[0-9]+$ && "$total" =~ ^[0-9]+$ ]]; then
+        return 1
+    fi
+
+    lh_gui_emit_event "{\"type\":\"progress\",\"current\":$current,\"total\":$total,\"label\":$(lh__gui_json_string "$label")}"
+}
+
 # Prints the "Back to Main Menu" entry only for CLI sessions
 # $1: Menu item number (usually 0)
 # $2: Display text for the menu entry
@@ -243,6 +295,9 @@ function lh_confirm_action() {
         prompt_suffix="[${LH_COLOR_PROMPT}y${LH_COLOR_RESET}/${LH_COLOR_BOLD_WHITE}N${LH_COLOR_RESET}]"
     fi
 
+    # The prompt of read -p goes to stderr, so the event does as well
+    lh_gui_emit_event "{\"type\":\"prompt\",\"kind\":\"confirm\",\"message\":$(lh__gui_json_string "$prompt_message"),\"default\":$(lh__gui_json_string "$default_choice"),\"options\":[{\"value\":\"y\",\"label\":$(lh__gui_json_string "${MSG[YES]:-Yes}")},{\"value\":\"n\",\"label\":$(lh__gui_json_string "${MSG[NO]:-No}")}]}" >&2
+
     read -r -p "$(echo -e "${LH_COLOR_PROMPT}${prompt_message}${LH_COLOR_RESET} ${prompt_suffix}: ")" response
 
 
@@ -285,6 +340,8 @@ function lh_ask_for_input() {
     local user_input=""
 
     while true; do
+        # Callers capture stdout, so the event goes to stderr like the prompt
+        lh_gui_emit_event "{\"type\":\"prompt\",\"kind\":\"input\",\"message\":$(lh__gui_json_string "$prompt_message"),\"pattern\":$(lh__gui_json_string "$validation_regex")}" >&2
         read -r -p "$(echo -e "${LH_COLOR_PROMPT}${prompt_message}${LH_COLOR_RESET}: ")" user_input
 
         # If no regex specified, accept any input
@@ -95,12 +95,12 @@ restore_menu() {
             1)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg 'RESTORE_MENU_TAR')")"
                 lh_log_msg "DEBUG" "Taking path: TAR restore"
-                bash "$LH_ROOT_DIR/modules/backup/mod_restore_tar.sh"
+                lh_run_module_locked restore_tar "$LH_ROOT_DIR/modules/backup/mod_restore_tar.sh"
                 ;;
             2)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg 'RESTORE_MENU_RSYNC')")"
                 lh_log_msg "DEBUG" "Taking path: RSYNC restore"
-                bash "$LH_ROOT_DIR/modules/backup/mod_restore_rsync.sh"
+                lh_run_module_locked restore_rsync "$LH_ROOT_DIR/modules/backup/mod_restore_rsync.sh"
                 ;;
             0)
                 lh_log_msg "DEBUG" "User chose to return to previous menu"
@@ -420,17 +420,17 @@ backup_menu() {
             1)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg "MENU_BTRFS_OPERATIONS")")"
                 lh_log_msg "DEBUG" "Taking path: BTRFS operations"
-                bash "$LH_ROOT_DIR/modules/backup/mod_btrfs_backup.sh"
+                lh_run_module_locked btrfs_backup "$LH_ROOT_DIR/modules/backup/mod_btrfs_backup.sh"
                 ;;
             2)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg "MENU_TAR_BACKUP")")"
                 lh_log_msg "DEBUG" "Taking path: TAR backup"
-                bash "$LH_ROOT_DIR/modules/backup/mod_backup_tar.sh"
+                lh_run_module_locked backup_tar "$LH_ROOT_DIR/modules/backup/mod_backup_tar.sh"
                 ;;
             3)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg "MENU_RSYNC_BACKUP")")"
                 lh_log_msg "DEBUG" "Taking path: RSYNC backup"
-                bash "$LH_ROOT_DIR/modules/backup/mod_backup_rsync.sh"
+                lh_run_module_locked backup_rsync "$LH_ROOT_DIR/modules/backup/mod_backup_rsync.sh"
                 ;;
             4)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg "MENU_RESTORE")")"
@@ -450,7 +450,7 @@ backup_menu() {
             7)
                 lh_update_module_session "$(lh_msg 'LIB_SESSION_ACTIVITY_SECTION' "$(lh_msg "BTRFS_MENU_MAINTENANCE")")"
                 lh_log_msg "DEBUG" "Taking path: BTRFS maintenance"
-                bash "$LH_ROOT_DIR/modules/backup/mod_btrfs_backup.sh" --maintenance
+                lh_run_module_locked btrfs_backup "$LH_ROOT_DIR/modules/backup/mod_btrfs_backup.sh" --maintenance
                 ;;
             0)
                 if lh_gui_mode_active; then